@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"order-service/config"
+	"order-service/internal/bench"
+	"order-service/internal/breaker"
+	"order-service/internal/cache"
+	"order-service/internal/database"
+)
+
+// Load test of GET /api/v1/orders/{order_uid} of a running service. Orders
+// are sampled from PostgreSQL (POSTGRES_CONN_STR) unless given with -uids;
+// cold mode evicts the order before every request through the cache
+// configured by the usual environment variables. The service drops its
+// in-memory copy when the invalidation reaches it, so a request that gets
+// there first is still answered from memory and reported as such.
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "base URL of the service")
+	sample := flag.Int("sample", 100, "number of random orders to request")
+	concurrency := flag.Int("concurrency", 4, "parallel clients")
+	duration := flag.Duration("duration", 0, "how long to run (default 10s)")
+	mode := flag.String("mode", bench.ModeWarm, "cache mode: warm or cold")
+	uids := flag.String("uids", "", "comma-separated order uids to use instead of sampling the database")
+	asJSON := flag.Bool("json", false, "print the result as JSON")
+	flag.Parse()
+
+	cfg := config.LoadConfig()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var sampler bench.Sampler
+	if *uids != "" {
+		sampler = staticSampler(strings.Split(*uids, ","))
+	} else {
+		dbBreaker := breaker.New("postgres", cfg.DBBreakerThreshold, cfg.DBBreakerOpenTimeout, cfg.DBCallTimeout)
+		db, err := database.NewPostgresRepository(ctx, cfg.DatabaseOptions(), dbBreaker)
+		if err != nil {
+			log.Fatalf("Failed to initialize database: %v", err)
+		}
+		defer db.Close()
+		sampler = db
+	}
+
+	var invalidator bench.Invalidator
+	if *mode == bench.ModeCold {
+		orderCache, err := cache.New(cfg.CacheOptions())
+		if err != nil {
+			log.Fatalf("Failed to initialize %s cache: %v", cfg.CacheBackend, err)
+		}
+		defer orderCache.Close()
+		invalidator = orderCache
+	}
+
+	runner := bench.NewRunner(bench.NewHTTPTarget(*baseURL, *concurrency), sampler, invalidator)
+	result, err := runner.Run(ctx, bench.Options{
+		Sample:      *sample,
+		Concurrency: *concurrency,
+		Duration:    *duration,
+		Mode:        *mode,
+	})
+	if err != nil {
+		log.Fatalf("Benchmark failed: %v", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(result)
+		return
+	}
+
+	printResult(result)
+}
+
+func printResult(result *bench.Result) {
+	fmt.Printf("%s cache, %d orders, %d clients: %d requests in %s, %.0f rps, %d not found, %d errors\n\n",
+		result.Mode, result.Sample, result.Concurrency, result.Requests, result.Elapsed,
+		result.Throughput, result.NotFound, result.Errors)
+
+	sources := make([]string, 0, len(result.Sources))
+	for source := range result.Sources {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "source\tcount\tmin ms\tmean ms\tp50 ms\tp95 ms\tp99 ms\tmax ms\t")
+	row := func(name string, l bench.Latency) {
+		fmt.Fprintf(tw, "%s\t%d\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\t\n", name, l.Count, l.Min, l.Mean, l.P50, l.P95, l.P99, l.Max)
+	}
+	for _, source := range sources {
+		row(source, result.Sources[source])
+	}
+	row("all", result.Overall)
+	tw.Flush()
+}
+
+// staticSampler serves the uids given on the command line.
+type staticSampler []string
+
+func (s staticSampler) SampleOrderUIDs(ctx context.Context, n int) ([]string, error) {
+	if n < len(s) {
+		return s[:n], nil
+	}
+	return s, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"order-service/config"
+	"order-service/internal/breaker"
+	"order-service/internal/database"
+	"order-service/internal/generator"
+	orderkafka "order-service/internal/kafka"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Synthetic order traffic for load and chaos testing. Orders go to Kafka
+// (KAFKA_BROKERS, KAFKA_TOPIC), to an NDJSON file or straight into
+// PostgreSQL (POSTGRES_CONN_STR).
+func main() {
+	seed := flag.Uint64("seed", 1, "random seed; the same seed gives the same orders")
+	count := flag.Int("count", 1000, "number of records to produce, 0 for no limit")
+	rate := flag.Float64("rate", 0, "records per second, 0 for as fast as possible")
+	customers := flag.Int("customers", 1000, "number of distinct customers")
+	skew := flag.Float64("skew", 0, "Zipf exponent (> 1) for hot customers and resent orders, 0 for uniform")
+	duplicates := flag.Float64("duplicates", 0, "percent of records resending an earlier order unchanged")
+	updates := flag.Float64("updates", 0, "percent of records updating an earlier order")
+	invalid := flag.Float64("invalid", 0, "percent of records with a payload the consumer must reject")
+	out := flag.String("out", "kafka", "destination: kafka, ndjson or postgres")
+	file := flag.String("file", "-", "NDJSON file to write, - for stdout")
+	now := flag.String("now", "", "orders are created within 90 days before this date (YYYY-MM-DD, default today)")
+	flag.Parse()
+
+	if *duplicates+*updates+*invalid > 100 {
+		log.Fatal("duplicates, updates and invalid add up to more than 100 percent")
+	}
+
+	// a fixed reference date keeps the output reproducible within a day
+	end := time.Now().UTC().Truncate(24 * time.Hour)
+	if *now != "" {
+		var err error
+		if end, err = time.Parse(time.DateOnly, *now); err != nil {
+			log.Fatalf("Invalid -now: %v", err)
+		}
+	}
+
+	cfg := config.LoadConfig()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var s sink
+	switch *out {
+	case "kafka":
+		dialer, err := orderkafka.NewDialer(cfg.KafkaSecurity())
+		if err != nil {
+			log.Fatalf("Failed to configure Kafka connections: %v", err)
+		}
+		s = newKafkaSink(cfg.KafkaBrokers, cfg.KafkaTopic, orderkafka.NewTransport(dialer))
+	case "ndjson":
+		var err error
+		if s, err = newFileSink(*file); err != nil {
+			log.Fatalf("Failed to open %s: %v", *file, err)
+		}
+	case "postgres":
+		dbBreaker := breaker.New("postgres", cfg.DBBreakerThreshold, cfg.DBBreakerOpenTimeout, cfg.DBCallTimeout)
+		db, err := database.NewPostgresRepository(ctx, cfg.DatabaseOptions(), dbBreaker)
+		if err != nil {
+			log.Fatalf("Failed to initialize database: %v", err)
+		}
+		s = &postgresSink{db: db}
+	default:
+		log.Fatalf("Unknown output %q", *out)
+	}
+
+	gen := generator.New(generator.Options{
+		Seed:       *seed,
+		Skew:       *skew,
+		Customers:  *customers,
+		Duplicates: *duplicates,
+		Updates:    *updates,
+		Invalid:    *invalid,
+		Now:        end,
+	})
+
+	var tick <-chan time.Time
+	if *rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / *rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	counts := make(map[string]int)
+	start := time.Now()
+	for n := 0; *count == 0 || n < *count; n++ {
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		record := gen.Next()
+		if err := s.Write(ctx, record); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Fatalf("Failed to write record %d: %v", n, err)
+		}
+		counts[record.Kind]++
+	}
+
+	if err := s.Close(); err != nil {
+		log.Fatalf("Failed to flush output: %v", err)
+	}
+
+	log.Printf("Produced %d new, %d duplicate, %d update, %d invalid records in %s",
+		counts[generator.KindNew], counts[generator.KindDuplicate], counts[generator.KindUpdate],
+		counts[generator.KindInvalid], time.Since(start).Round(time.Millisecond))
+}
+
+type sink interface {
+	Write(ctx context.Context, record generator.Record) error
+	Close() error
+}
+
+// kafkaSink batches asynchronously; the order uid is the message key so
+// updates of one order stay in one partition.
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+func newKafkaSink(brokers []string, topic string, transport *kafka.Transport) *kafkaSink {
+	return &kafkaSink{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Transport:    transport,
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: 10 * time.Millisecond,
+	}}
+}
+
+func (s *kafkaSink) Write(ctx context.Context, record generator.Record) error {
+	return s.writer.WriteMessages(ctx, kafka.Message{Key: []byte(record.Key), Value: record.Payload})
+}
+
+func (s *kafkaSink) Close() error {
+	return s.writer.Close()
+}
+
+type fileSink struct {
+	w      *bufio.Writer
+	closer io.Closer
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	if path == "-" {
+		return &fileSink{w: bufio.NewWriter(os.Stdout)}, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{w: bufio.NewWriter(f), closer: f}, nil
+}
+
+func (s *fileSink) Write(ctx context.Context, record generator.Record) error {
+	// a truncated invalid payload must not swallow the next line
+	line := strings.ReplaceAll(string(record.Payload), "\n", " ")
+	_, err := fmt.Fprintln(s.w, line)
+	return err
+}
+
+func (s *fileSink) Close() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
+
+// postgresSink saves orders the way the consumer would. Invalid payloads
+// never reach the database, so they are skipped.
+type postgresSink struct {
+	db *database.PostgresRepository
+}
+
+func (s *postgresSink) Write(ctx context.Context, record generator.Record) error {
+	if record.Order == nil {
+		return nil
+	}
+	_, err := s.db.SaveOrder(ctx, record.Order)
+	return err
+}
+
+func (s *postgresSink) Close() error {
+	s.db.Close()
+	return nil
+}
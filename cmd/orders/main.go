@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"order-service/config"
+	"order-service/internal/breaker"
+	"order-service/internal/cache"
+	"order-service/internal/database"
+	"order-service/internal/kafka"
+	"order-service/internal/models"
+	"order-service/internal/orderio"
+)
+
+const usage = `Usage:
+  orders export [flags]          write stored orders to NDJSON, CSV or Parquet
+  orders import [flags] FILE...  load NDJSON files through the consumer's validation
+  orders rebalance [flags]       move orders to the shard their shard key maps to
+  orders migrate                 create or upgrade the tables without starting the server
+
+Run "orders export -h", "orders import -h" or "orders rebalance -h" for the flags.
+`
+
+// Moves orders in and out of PostgreSQL (POSTGRES_CONN_STR) without Kafka.
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = runExport(ctx, os.Args[2:])
+	case "import":
+		err = runImport(ctx, os.Args[2:])
+	case "rebalance":
+		err = runRebalance(ctx, os.Args[2:])
+	case "migrate":
+		err = runMigrate(ctx)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func openDatabase(ctx context.Context, cfg *config.Config) (*database.PostgresRepository, error) {
+	return openDatabaseWith(ctx, cfg, cfg.DatabaseOptions())
+}
+
+func openDatabaseWith(ctx context.Context, cfg *config.Config, opts database.Options) (*database.PostgresRepository, error) {
+	dbBreaker := breaker.New("postgres", cfg.DBBreakerThreshold, cfg.DBBreakerOpenTimeout, cfg.DBCallTimeout)
+	db, err := database.NewPostgresRepository(ctx, opts, dbBreaker)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initialize database: %w", err)
+	}
+	return db, nil
+}
+
+// parseDate accepts a date or a full RFC 3339 timestamp.
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func runExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	out := fs.String("o", "-", "output file, - for stdout")
+	format := fs.String("format", "", "ndjson, csv or parquet (default from the -o extension, else ndjson)")
+	from := fs.String("from", "", "only orders created at or after this date (YYYY-MM-DD or RFC 3339)")
+	to := fs.String("to", "", "only orders created before this date (YYYY-MM-DD or RFC 3339)")
+	customer := fs.String("customer", "", "only orders of this customer")
+	batch := fs.Int("batch", 500, "orders fetched per query")
+	fs.Parse(args)
+
+	var filter database.OrderFilter
+	var err error
+	if filter.CreatedFrom, err = parseDate(*from); err != nil {
+		return fmt.Errorf("Invalid -from: %w", err)
+	}
+	if filter.CreatedTo, err = parseDate(*to); err != nil {
+		return fmt.Errorf("Invalid -to: %w", err)
+	}
+	filter.CustomerID = *customer
+
+	if *format == "" {
+		*format = orderio.FormatFromPath(*out)
+	}
+
+	db, err := openDatabase(ctx, config.LoadConfig())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var dst io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("Failed to create %s: %w", *out, err)
+		}
+		defer f.Close()
+		dst = f
+	}
+
+	w, err := orderio.NewWriter(*format, dst)
+	if err != nil {
+		return err
+	}
+
+	// keyset pagination keeps memory flat however many orders there are
+	start := time.Now()
+	exported := 0
+	after := ""
+	for {
+		orders, err := db.ListOrders(ctx, filter, after, *batch)
+		if err != nil {
+			return fmt.Errorf("Failed to list orders after %q: %w", after, err)
+		}
+
+		for i := range orders {
+			if err := w.Write(&orders[i]); err != nil {
+				return fmt.Errorf("Failed to write order %s: %w", orders[i].OrderUID, err)
+			}
+		}
+		exported += len(orders)
+
+		if len(orders) < *batch {
+			break
+		}
+		after = orders[len(orders)-1].OrderUID
+		log.Printf("Exported %d orders", exported)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("Failed to finish %s output: %w", *format, err)
+	}
+
+	log.Printf("Exported %d orders as %s in %s", exported, *format, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// importState is the checkpoint of one file, stored next to it, so an
+// interrupted import continues where it stopped.
+type importState struct {
+	Offset   int64 `json:"offset"`
+	Line     int   `json:"line"`
+	Imported int   `json:"imported"`
+	Rejected int   `json:"rejected"`
+}
+
+// rejection is a line of the -errors file.
+type rejection struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Error   string `json:"error"`
+	Payload string `json:"payload"`
+}
+
+type importer struct {
+	processor  *kafka.Processor
+	errors     *json.Encoder
+	resume     bool
+	checkpoint int
+}
+
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	resume := fs.Bool("resume", false, "continue from the checkpoint (FILE.import-state) of an interrupted run")
+	errorsPath := fs.String("errors", "", "append rejected lines as NDJSON to this file")
+	checkpoint := fs.Int("checkpoint", 1000, "lines between checkpoints")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return errors.New("no files to import")
+	}
+	if *checkpoint < 1 {
+		return errors.New("-checkpoint must be at least 1")
+	}
+
+	cfg := config.LoadConfig()
+	db, err := openDatabase(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	imp := &importer{resume: *resume, checkpoint: *checkpoint}
+
+	// the in-memory cache lives in the server process, only shared caches
+	// can hold stale copies of re-imported orders
+	var orderCache cache.Cache
+	if cfg.CacheBackend != cache.BackendMemory {
+		shared, err := cache.New(cfg.CacheOptions())
+		if err != nil {
+			log.Printf("Failed to initialize %s cache, imported orders will not be invalidated: %v", cfg.CacheBackend, err)
+		} else {
+			defer shared.Close()
+			orderCache = shared
+		}
+	}
+	// saved the way the consumer saves them, without events: the stream
+	// is for live changes
+	imp.processor = kafka.NewProcessor(db, orderCache, nil, nil)
+
+	if *errorsPath != "" {
+		f, err := os.OpenFile(*errorsPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("Failed to open %s: %w", *errorsPath, err)
+		}
+		defer f.Close()
+		imp.errors = json.NewEncoder(f)
+	}
+
+	for _, path := range fs.Args() {
+		if err := imp.importFile(ctx, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (imp *importer) importFile(ctx context.Context, path string) error {
+	statePath := path + ".import-state"
+
+	var state importState
+	if imp.resume {
+		data, err := os.ReadFile(statePath)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(data, &state); err != nil {
+				return fmt.Errorf("Failed to read checkpoint %s: %w", statePath, err)
+			}
+			log.Printf("%s: resuming at line %d", path, state.Line+1)
+		case !errors.Is(err, os.ErrNotExist):
+			return fmt.Errorf("Failed to read checkpoint %s: %w", statePath, err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(state.Offset, io.SeekStart); err != nil {
+		return fmt.Errorf("Failed to seek %s: %w", path, err)
+	}
+
+	save := func() error {
+		data, _ := json.Marshal(state)
+		if err := os.WriteFile(statePath, data, 0o644); err != nil {
+			return fmt.Errorf("Failed to write checkpoint %s: %w", statePath, err)
+		}
+		return nil
+	}
+
+	start := time.Now()
+	lastReport := start
+	reader := orderio.NewNDJSONReader(f, state.Offset, state.Line)
+	for {
+		line, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			save()
+			return fmt.Errorf("Failed to read %s: %w", path, err)
+		}
+
+		order, err := models.ParseOrder(line.Data)
+		if err != nil {
+			state.Rejected++
+			imp.reject(path, line, err)
+		} else {
+			if err := imp.processor.Apply(ctx, order); err != nil {
+				// the database, not the line, is at fault: stop so the
+				// line is retried on -resume
+				save()
+				return fmt.Errorf("%s:%d: order %s: %w", path, line.Number, order.OrderUID, err)
+			}
+			state.Imported++
+		}
+
+		state.Offset, state.Line = line.Offset, line.Number
+		if line.Number%imp.checkpoint == 0 {
+			if err := save(); err != nil {
+				return err
+			}
+		}
+		if time.Since(lastReport) >= 5*time.Second {
+			lastReport = time.Now()
+			log.Printf("%s: line %d, %d imported, %d rejected", path, state.Line, state.Imported, state.Rejected)
+		}
+	}
+
+	// a finished file needs no checkpoint, a later -resume starts it over
+	if err := os.Remove(statePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to remove checkpoint %s: %v", statePath, err)
+	}
+
+	log.Printf("%s: %d imported, %d rejected in %s", path, state.Imported, state.Rejected, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func (imp *importer) reject(path string, line orderio.Line, err error) {
+	log.Printf("%s:%d: %v", path, line.Number, err)
+	if imp.errors == nil {
+		return
+	}
+	imp.errors.Encode(rejection{File: path, Line: line.Number, Error: err.Error(), Payload: string(line.Data)})
+}
+
+// runRebalance moves orders after POSTGRES_SHARD_CONN_STRS changed. Orders
+// are copied unchanged, so cached copies stay valid.
+func runRebalance(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("rebalance", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "only count the orders that would move")
+	batch := fs.Int("batch", 500, "orders read per query")
+	fs.Parse(args)
+
+	db, err := openDatabase(ctx, config.LoadConfig())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	start := time.Now()
+	lastReport := start
+	done, err := db.Rebalance(ctx, *batch, *dryRun, func(shard int, done database.Rebalancing) {
+		if time.Since(lastReport) >= 5*time.Second {
+			lastReport = time.Now()
+			log.Printf("Shard %d: %d orders checked, %d moved, %d stale copies removed", shard, done.Checked, done.Moved, done.Stale)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		log.Printf("%d of %d orders would move between %d shards", done.Moved, done.Checked, db.Shards())
+		return nil
+	}
+	log.Printf("Checked %d orders on %d shards in %s: %d moved, %d stale copies removed",
+		done.Checked, db.Shards(), time.Since(start).Round(time.Millisecond), done.Moved, done.Stale)
+	return nil
+}
+
+// runMigrate creates the schema the server would on start, for databases
+// the commands are run against before the server ever was.
+func runMigrate(ctx context.Context) error {
+	cfg := config.LoadConfig()
+	opts := cfg.DatabaseOptions()
+	opts.Migrate = true
+	db, err := openDatabaseWith(ctx, cfg, opts)
+	if err != nil {
+		return err
+	}
+	db.Close()
+	return nil
+}
@@ -6,17 +6,25 @@ import (
     "log"
     "time"
 
+    "order-service/config"
+    orderkafka "order-service/internal/kafka"
     "order-service/internal/models"
 
     "github.com/segmentio/kafka-go"
 )
 
 func main() {
+    cfg := config.LoadConfig()
+    dialer, err := orderkafka.NewDialer(cfg.KafkaSecurity())
+    if err != nil {
+        log.Fatalf("Failed to configure Kafka connections: %v", err)
+    }
     writer := &kafka.Writer{
-        Addr:         kafka.TCP("localhost:9092"),
-        Topic:        "orders",
+        Addr:         kafka.TCP(cfg.KafkaBrokers...),
+        Topic:        cfg.KafkaTopic,
         Balancer:     &kafka.LeastBytes{},
         BatchTimeout: 10 * time.Millisecond,
+        Transport:    orderkafka.NewTransport(dialer),
     }
     defer writer.Close()
 
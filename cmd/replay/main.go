@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"order-service/config"
+	"order-service/internal/breaker"
+	"order-service/internal/cache"
+	"order-service/internal/database"
+	"order-service/internal/decoder"
+	"order-service/internal/events"
+	"order-service/internal/kafka"
+	"order-service/internal/replay"
+)
+
+// Reprocesses a range of the orders topic (KAFKA_BROKERS, KAFKA_ORDERS_TOPIC) into
+// PostgreSQL (POSTGRES_CONN_STR), a shadow table, or nowhere with -dry-run.
+func main() {
+	partitions := flag.String("partitions", "", "comma-separated partitions (default all)")
+	fromOffset := flag.Int64("from-offset", -1, "first offset to replay in every partition")
+	toOffset := flag.Int64("to-offset", -1, "offset to stop before in every partition")
+	since := flag.String("since", "", "replay messages written at or after this time (YYYY-MM-DD or RFC 3339)")
+	until := flag.String("until", "", "stop at messages written at or after this time (YYYY-MM-DD or RFC 3339)")
+	dryRun := flag.Bool("dry-run", false, "write nothing, report what would change in the orders table")
+	shadow := flag.String("shadow", "", "write to this table (created like orders) instead of the orders table")
+	asJSON := flag.Bool("json", false, "print the result as JSON")
+	flag.Parse()
+
+	opts := replay.Options{DryRun: *dryRun, Shadow: *shadow}
+	if *fromOffset >= 0 {
+		opts.FromOffset = fromOffset
+	}
+	if *toOffset >= 0 {
+		opts.ToOffset = toOffset
+	}
+	var err error
+	if opts.Since, err = parseTime(*since); err != nil {
+		log.Fatalf("Invalid -since: %v", err)
+	}
+	if opts.Until, err = parseTime(*until); err != nil {
+		log.Fatalf("Invalid -until: %v", err)
+	}
+	if *partitions != "" {
+		for _, p := range strings.Split(*partitions, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil {
+				log.Fatalf("Invalid partition %q", p)
+			}
+			opts.Partitions = append(opts.Partitions, id)
+		}
+	}
+	if err := opts.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	cfg := config.LoadConfig()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	dbBreaker := breaker.New("postgres", cfg.DBBreakerThreshold, cfg.DBBreakerOpenTimeout, cfg.DBCallTimeout)
+	db, err := database.NewPostgresRepository(ctx, cfg.DatabaseOptions(), dbBreaker)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	schemas, err := decoder.NewLocalSchemas(cfg.SchemaDir)
+	if err != nil {
+		log.Fatalf("Failed to load order schemas: %v", err)
+	}
+
+	// messages are decoded like the consumer does; replays into the live
+	// table also invalidate a shared cache and relay the events to the
+	// servers
+	var orderCache cache.Cache
+	var broker *events.Broker
+	if !opts.DryRun && opts.Shadow == "" && cfg.CacheBackend != cache.BackendMemory {
+		c, err := cache.New(cfg.CacheOptions())
+		if err != nil {
+			log.Fatalf("Failed to initialize %s cache: %v", cfg.CacheBackend, err)
+		}
+		defer c.Close()
+		orderCache = c
+		broker = events.NewBroker(0, c)
+	}
+	processor := kafka.NewProcessor(db, orderCache, broker, decoder.NewRegistry(schemas))
+
+	dialer, err := kafka.NewDialer(cfg.KafkaSecurity())
+	if err != nil {
+		log.Fatalf("Failed to configure Kafka connections: %v", err)
+	}
+	replayer := replay.NewReplayer(cfg.KafkaBrokers, cfg.KafkaHandlers[config.HandlerOrders].Topic, dialer, db, processor)
+	result, err := replayer.Run(ctx, opts, func(progress *replay.Result) {
+		log.Printf("%d messages, %d invalid, %d applied", progress.Messages, progress.Invalid, progress.Applied)
+	})
+	if result != nil {
+		if *asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(result)
+		} else {
+			printResult(result)
+		}
+	}
+	if err != nil {
+		log.Fatalf("Replay failed: %v", err)
+	}
+}
+
+// parseTime accepts a date or a full RFC 3339 timestamp.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func printResult(result *replay.Result) {
+	fmt.Printf("target %s, %d messages, %d invalid, %d applied\n\n", result.Target, result.Messages, result.Invalid, result.Applied)
+
+	ids := make([]int, 0, len(result.Partitions))
+	for id := range result.Partitions {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "partition\tstart\tend\treached\t")
+	for _, id := range ids {
+		p := result.Partitions[id]
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t\n", id, p.Start, p.End, p.Next)
+	}
+	tw.Flush()
+
+	if result.DryRun {
+		fmt.Printf("\n%d orders: %d new, %d changed, %d unchanged\n", result.Orders, result.New, result.Changed, result.Unchanged)
+		for _, change := range result.Changes {
+			fmt.Printf("  %-8s %s %s\n", change.Status, change.OrderUID, strings.Join(change.Fields, ", "))
+		}
+	}
+
+	if len(result.Errors) > 0 {
+		fmt.Println("\ninvalid messages:")
+		for _, e := range result.Errors {
+			fmt.Printf("  partition %d offset %d: %s\n", e.Partition, e.Offset, e.Error)
+		}
+	}
+}
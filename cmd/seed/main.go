@@ -7,6 +7,8 @@ import (
 	"log"
 	"time"
 
+	"order-service/config"
+	orderkafka "order-service/internal/kafka"
 	"order-service/internal/models"
 
 	"github.com/segmentio/kafka-go"
@@ -14,10 +16,16 @@ import (
 
 func main() {
 	// Connect Kafka
+	cfg := config.LoadConfig()
+	dialer, err := orderkafka.NewDialer(cfg.KafkaSecurity())
+	if err != nil {
+		log.Fatalf("Failed to configure Kafka connections: %v", err)
+	}
 	writer := &kafka.Writer{
-		Addr:     kafka.TCP("localhost:9092"),
-		Topic:    "orders",
-		Balancer: &kafka.LeastBytes{},
+		Addr:      kafka.TCP(cfg.KafkaBrokers...),
+		Topic:     cfg.KafkaTopic,
+		Balancer:  &kafka.LeastBytes{},
+		Transport: orderkafka.NewTransport(dialer),
 	}
 	defer writer.Close()
 
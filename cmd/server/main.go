@@ -9,10 +9,18 @@ import (
 	"time"
 
 	"order-service/config"
+	"order-service/internal/bench"
+	"order-service/internal/breaker"
 	"order-service/internal/cache"
 	"order-service/internal/database"
+	"order-service/internal/decoder"
+	"order-service/internal/events"
+	"order-service/internal/grpc"
 	"order-service/internal/http"
 	"order-service/internal/kafka"
+	"order-service/internal/money"
+	"order-service/internal/replay"
+	"order-service/internal/service"
 )
 
 func main() {
@@ -22,25 +30,31 @@ func main() {
 	ctx := context.Background()
 
 	// db init
-	db, err := database.NewPostgresRepository(ctx, cfg.PostgresConnStr)
+	dbBreaker := breaker.New("postgres", cfg.DBBreakerThreshold, cfg.DBBreakerOpenTimeout, cfg.DBCallTimeout)
+	dbOptions := cfg.DatabaseOptions()
+	dbOptions.Migrate = true
+	db, err := database.NewPostgresRepository(ctx, dbOptions, dbBreaker)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
 
 	// cache init
-	redisCache, err := cache.NewRedisCache(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB, cfg.CacheTTL)
+	orderCache, err := cache.New(cfg.CacheOptions())
 	if err != nil {
-		log.Fatalf("Failed to initialize Redis cache: %v", err)
+		log.Fatalf("Failed to initialize %s cache: %v", cfg.CacheBackend, err)
 	}
-	defer redisCache.Close()
+	defer orderCache.Close()
+
+	cacheBreaker := breaker.New("cache", cfg.CacheBreakerThreshold, cfg.CacheBreakerOpenTimeout, cfg.CacheCallTimeout)
+	orderCache = cache.NewBreakerCache(orderCache, cacheBreaker)
 
 	// cache preload
 	orders, err := db.GetAllOrders(ctx)
 	if err != nil {
 		log.Printf("Failed to get orders for preloading cache: %v", err)
 	} else {
-		err = redisCache.PreloadOrders(ctx, orders)
+		err = orderCache.PreloadOrders(ctx, orders)
 		if err != nil {
 			log.Printf("Failed to preload cache: %v", err)
 		} else {
@@ -48,12 +62,59 @@ func main() {
 		}
 	}
 
+	// background cache writes
+	filler := cache.NewFiller(orderCache, cfg.CacheFillQueueSize, cfg.CacheFillWorkers)
+	defer filler.Close()
+
+	// in-process cache in front of Redis
+	var localCache *cache.LocalCache
+	if cfg.LocalCacheSize > 0 {
+		localCache = cache.NewLocalCache(cfg.LocalCacheSize, cfg.LocalCacheMaxBytes, cfg.LocalCacheTTL)
+		go orderCache.SubscribeInvalidations(ctx, localCache.Delete)
+	}
+
+	// order updates for streaming clients
+	broker := events.NewBroker(cfg.StreamHistory, orderCache)
+	go broker.Run(ctx)
+
+	// message formats and schema versions the consumer understands
+	schemas, err := decoder.NewLocalSchemas(cfg.SchemaDir)
+	if err != nil {
+		log.Fatalf("Failed to load order schemas: %v", err)
+	}
+
 	// kafka consumer init
-	consumer := kafka.NewConsumer(
-		cfg.KafkaBrokers,
-		cfg.KafkaTopic,
-		db,
-	)
+	dialer, err := kafka.NewDialer(cfg.KafkaSecurity())
+	if err != nil {
+		log.Fatalf("Failed to configure Kafka connections: %v", err)
+	}
+	processor := kafka.NewProcessor(db, orderCache, broker, decoder.NewRegistry(schemas))
+	handlers := kafka.NewHandlers()
+	for name, handle := range map[string]kafka.HandlerFunc{
+		config.HandlerOrders:        processor.Process,
+		config.HandlerOrderStatus:   processor.ProcessStatus,
+		config.HandlerPaymentEvents: processor.ProcessPayment,
+		config.HandlerCancellations: processor.ProcessCancellation,
+	} {
+		hc := cfg.KafkaHandlers[name]
+		if hc.Topic == "" {
+			continue
+		}
+		handler := kafka.Handler{
+			Name:   name,
+			Handle: handle,
+			Policy: kafka.Policy{
+				MaxAttempts: hc.MaxAttempts,
+				Backoff:     hc.Backoff,
+				MaxBackoff:  hc.MaxBackoff,
+				DLQTopic:    hc.DLQTopic,
+			},
+		}
+		handlers.HandleTopic(hc.Topic, handler)
+		// events of any kind may also share a topic, tagged by type
+		handlers.HandleType(name, handler)
+	}
+	consumer := kafka.NewConsumer(cfg.KafkaBrokers, cfg.KafkaGroupID, dialer, handlers, db)
 	defer consumer.Close()
 
 	go func() {
@@ -62,8 +123,57 @@ func main() {
 		consumer.Start(ctx)
 	}()
 
+	orderService := service.NewOrders(orderCache, localCache, db, filler)
+
+	// grpc server init
+	if cfg.GRPCAddr != "" {
+		grpcServer := grpc.NewServer(orderService, broker)
+		defer grpcServer.Stop()
+
+		go func() {
+			if err := grpcServer.Start(cfg.GRPCAddr); err != nil {
+				log.Fatalf("Failed to start gRPC server: %v", err)
+			}
+		}()
+	}
+
+	// load tests started through the admin API
+	benchRunner := bench.NewRunner(bench.NewServiceTarget(orderService), db, orderService)
+	benchJobs := bench.NewJobs(ctx, benchRunner)
+
+	// topic replays started through the admin API
+	replayer := replay.NewReplayer(cfg.KafkaBrokers, cfg.KafkaHandlers[config.HandlerOrders].Topic, dialer, db, processor)
+	replayJobs := replay.NewJobs(ctx, replayer)
+
+	// amounts in the reporting currency
+	var converter *money.Converter
+	if cfg.ReportingCurrency != "" {
+		reporting, err := money.Lookup(cfg.ReportingCurrency)
+		if err != nil {
+			log.Fatalf("Invalid REPORTING_CURRENCY: %v", err)
+		}
+		converter = money.NewConverter(reporting, db.ListExchangeRates)
+		if err := converter.Refresh(ctx); err != nil {
+			log.Printf("Failed to load exchange rates: %v", err)
+		}
+		go converter.Run(ctx, cfg.ExchangeRatesRefresh)
+	}
+
+	// monthly partitions of orders, created ahead and archived after the
+	// retention
+	if cfg.PartitionMaintenance > 0 {
+		partitions := service.NewPartitions(db, cfg.PartitionsAhead, cfg.RetentionMonths)
+		go partitions.Run(ctx, cfg.PartitionMaintenance)
+	}
+
+	// analytics reports, recomputed on a schedule
+	reports := service.NewReports(db)
+	if cfg.ReportsRefresh > 0 {
+		go reports.Run(ctx, cfg.ReportsRefresh)
+	}
+
 	// http server init
-	httpServer := http.NewServer(redisCache, db)
+	httpServer := http.NewServer(orderService, broker, benchJobs, replayJobs, reports, converter, cfg.StreamHeartbeat, cfg.DevMode, cfg.HTTPCacheControl, cfg.HTTPCompression, cfg.AdminToken)
 	go func() {
 		log.Printf("Starting HTTP server on %s", cfg.HTTPAddr)
 		if err := httpServer.Start(cfg.HTTPAddr); err != nil {
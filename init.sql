@@ -1,5 +1,5 @@
 CREATE TABLE orders (
-    order_uid VARCHAR(255) PRIMARY KEY,
+    order_uid VARCHAR(255) NOT NULL,
     track_number VARCHAR(255),
     entry VARCHAR(255),
     delivery JSONB NOT NULL,
@@ -11,6 +11,24 @@ CREATE TABLE orders (
     delivery_service VARCHAR(255),
     shardkey VARCHAR(255),
     sm_id INTEGER,
-    date_created TIMESTAMP WITH TIME ZONE,
-    oof_shard VARCHAR(255)
+    date_created TIMESTAMP WITH TIME ZONE NOT NULL,
+    oof_shard VARCHAR(255),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (order_uid, date_created)
+) PARTITION BY RANGE (date_created);
+
+CREATE TABLE orders_default PARTITION OF orders DEFAULT;
+
+CREATE TABLE archived_orders (
+    order_uid VARCHAR(255) PRIMARY KEY,
+    date_created TIMESTAMP WITH TIME ZONE NOT NULL,
+    file TEXT NOT NULL
+);
+
+CREATE TABLE exchange_rates (
+    base CHAR(3) NOT NULL,
+    quote CHAR(3) NOT NULL,
+    rate NUMERIC(24, 12) NOT NULL CHECK (rate > 0),
+    valid_from DATE NOT NULL,
+    PRIMARY KEY (base, quote, valid_from)
 );
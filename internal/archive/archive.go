@@ -0,0 +1,158 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+
+	"order-service/internal/models"
+	"order-service/internal/orderio"
+)
+
+// Extension of the archive files: NDJSON in the format of `orders export`,
+// compressed with zstd.
+const Extension = ".ndjson.zst"
+
+// Archive keeps orders removed from the database as files in a directory.
+type Archive struct {
+	dir string
+}
+
+func New(dir string) *Archive {
+	return &Archive{dir: dir}
+}
+
+// File is an archive file being written. It only appears under its name
+// once committed, so a file that is there is complete.
+type File struct {
+	name    string
+	path    string
+	tmp     *os.File
+	zw      *zstd.Encoder
+	w       *orderio.NDJSONWriter
+	written int
+}
+
+// Create starts the file name, replacing a previous file of that name on
+// Commit.
+func (a *Archive) Create(name string) (*File, error) {
+	if err := os.MkdirAll(a.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("Failed to create archive directory: %w", err)
+	}
+
+	path := filepath.Join(a.dir, name)
+	tmp, err := os.CreateTemp(a.dir, "."+name+".*")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create archive file: %w", err)
+	}
+	zw, err := zstd.NewWriter(tmp, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return &File{name: name, path: path, tmp: tmp, zw: zw, w: orderio.NewNDJSONWriter(zw)}, nil
+}
+
+// Written is the number of orders written so far.
+func (f *File) Written() int {
+	return f.written
+}
+
+func (f *File) Write(order *models.Order) error {
+	if err := f.w.Write(order); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", f.name, err)
+	}
+	f.written++
+	return nil
+}
+
+// Commit flushes the file to disk and moves it in place.
+func (f *File) Commit() error {
+	err := f.w.Close()
+	if err == nil {
+		err = f.zw.Close()
+	}
+	if err == nil {
+		err = f.tmp.Sync()
+	}
+	if closeErr := f.tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.tmp.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.tmp.Name())
+		return fmt.Errorf("Failed to write %s: %w", f.name, err)
+	}
+	return nil
+}
+
+// Abort throws away what was written.
+func (f *File) Abort() {
+	f.zw.Close()
+	f.tmp.Close()
+	os.Remove(f.tmp.Name())
+}
+
+// Find reads the orders with the given uids from file name. Orders that are
+// not in the file are absent from the result.
+func (a *Archive) Find(name string, orderUIDs []string) ([]models.Order, error) {
+	file, err := os.Open(filepath.Join(a.dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open archive file: %w", err)
+	}
+	defer file.Close()
+
+	zr, err := zstd.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", name, err)
+	}
+	defer zr.Close()
+
+	// lines are only parsed when they mention one of the uids
+	wanted := make(map[string][]byte, len(orderUIDs))
+	for _, uid := range orderUIDs {
+		quoted, _ := json.Marshal(uid)
+		wanted[uid] = quoted
+	}
+
+	var orders []models.Order
+	reader := orderio.NewNDJSONReader(zr, 0, 0)
+	for len(wanted) > 0 {
+		line, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Failed to read %s: %w", name, err)
+		}
+
+		mentioned := false
+		for _, quoted := range wanted {
+			if bytes.Contains(line.Data, quoted) {
+				mentioned = true
+				break
+			}
+		}
+		if !mentioned {
+			continue
+		}
+
+		var order models.Order
+		if err := json.Unmarshal(line.Data, &order); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line.Number, err)
+		}
+		if _, ok := wanted[order.OrderUID]; ok {
+			orders = append(orders, order)
+			delete(wanted, order.OrderUID)
+		}
+	}
+	return orders, nil
+}
@@ -0,0 +1,375 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Cache modes of a run.
+const (
+	// ModeWarm requests every sampled order once before measuring
+	ModeWarm = "warm"
+	// ModeCold evicts the order from the caches before every request, so
+	// the whole run measures misses
+	ModeCold = "cold"
+)
+
+// SourceError groups the requests that failed.
+const SourceError = "error"
+
+// Options describe one run.
+type Options struct {
+	Sample      int           `json:"sample"`
+	Concurrency int           `json:"concurrency"`
+	Duration    time.Duration `json:"-"`
+	Mode        string        `json:"mode"`
+}
+
+// Validate fills in defaults and rejects impossible values.
+func (o *Options) Validate() error {
+	if o.Sample == 0 {
+		o.Sample = 100
+	}
+	if o.Concurrency == 0 {
+		o.Concurrency = 4
+	}
+	if o.Duration == 0 {
+		o.Duration = 10 * time.Second
+	}
+	if o.Mode == "" {
+		o.Mode = ModeWarm
+	}
+
+	switch {
+	case o.Sample < 1 || o.Sample > 100000:
+		return fmt.Errorf("sample must be between 1 and 100000")
+	case o.Concurrency < 1 || o.Concurrency > 256:
+		return fmt.Errorf("concurrency must be between 1 and 256")
+	case o.Duration < time.Second || o.Duration > 10*time.Minute:
+		return fmt.Errorf("duration must be between 1s and 10m")
+	case o.Mode != ModeWarm && o.Mode != ModeCold:
+		return fmt.Errorf("unknown mode %q", o.Mode)
+	}
+	return nil
+}
+
+// Target is what gets measured: a lookup reports which tier answered and
+// whether the order exists.
+type Target interface {
+	Lookup(ctx context.Context, orderUID string) (source string, found bool, err error)
+}
+
+// Sampler picks the orders to request.
+type Sampler interface {
+	SampleOrderUIDs(ctx context.Context, n int) ([]string, error)
+}
+
+// Invalidator evicts orders from the caches for cold runs. The eviction is
+// not part of the measured time.
+type Invalidator interface {
+	InvalidateOrder(ctx context.Context, orderUID string) error
+}
+
+// Latency is a summary of one source, in milliseconds.
+type Latency struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min_ms"`
+	Mean  float64 `json:"mean_ms"`
+	P50   float64 `json:"p50_ms"`
+	P95   float64 `json:"p95_ms"`
+	P99   float64 `json:"p99_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+// Result is the outcome of a run. Requests cut short by the end of the run
+// are not counted.
+type Result struct {
+	Mode        string             `json:"mode"`
+	Sample      int                `json:"sample"`
+	Concurrency int                `json:"concurrency"`
+	Elapsed     string             `json:"elapsed"`
+	Requests    int                `json:"requests"`
+	NotFound    int                `json:"not_found"`
+	Errors      int                `json:"errors"`
+	Throughput  float64            `json:"throughput_rps"`
+	Overall     Latency            `json:"overall"`
+	Sources     map[string]Latency `json:"sources"`
+}
+
+// Runner samples orders and measures lookups of them.
+type Runner struct {
+	target      Target
+	sampler     Sampler
+	invalidator Invalidator
+}
+
+// NewRunner creates a runner. The invalidator may be nil when cold runs are
+// not needed.
+func NewRunner(target Target, sampler Sampler, invalidator Invalidator) *Runner {
+	return &Runner{target: target, sampler: sampler, invalidator: invalidator}
+}
+
+// Run samples the orders and measures them.
+func (r *Runner) Run(ctx context.Context, opts Options) (*Result, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	uids, err := r.sampler.SampleOrderUIDs(ctx, opts.Sample)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to sample orders: %w", err)
+	}
+	if len(uids) == 0 {
+		return nil, errors.New("no orders to benchmark")
+	}
+
+	return r.RunUIDs(ctx, uids, opts)
+}
+
+// RunUIDs measures the given orders for opts.Duration.
+func (r *Runner) RunUIDs(ctx context.Context, uids []string, opts Options) (*Result, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := r.prepare(ctx, uids, opts.Mode); err != nil {
+		return nil, err
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, opts.Duration)
+	defer cancel()
+
+	// each worker keeps its own samples so the hot loop doesn't share a lock
+	workers := make([]*samples, opts.Concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+
+	for i := range workers {
+		workers[i] = newSamples()
+		wg.Add(1)
+		go func(s *samples) {
+			defer wg.Done()
+			for runCtx.Err() == nil {
+				uid := uids[rand.IntN(len(uids))]
+
+				if opts.Mode == ModeCold {
+					evictStart := time.Now()
+					if err := r.invalidator.InvalidateOrder(runCtx, uid); err != nil {
+						if runCtx.Err() != nil {
+							return
+						}
+						s.add(SourceError, time.Since(evictStart), false)
+						continue
+					}
+				}
+
+				callStart := time.Now()
+				source, found, err := r.target.Lookup(runCtx, uid)
+				elapsed := time.Since(callStart)
+
+				if runCtx.Err() != nil {
+					// cut short by the end of the run, not a real failure
+					return
+				}
+				if err != nil {
+					source = SourceError
+				}
+				s.add(source, elapsed, err == nil && !found)
+			}
+		}(workers[i])
+	}
+
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	all := newSamples()
+	for _, s := range workers {
+		all.merge(s)
+	}
+
+	result := all.summarize()
+	result.Mode = opts.Mode
+	result.Sample = len(uids)
+	result.Concurrency = opts.Concurrency
+	result.Elapsed = elapsed.String()
+	result.Throughput = float64(result.Requests) / elapsed.Seconds()
+
+	log.Printf("Benchmark finished: %d requests in %s (%.0f rps), p99 %.3fms",
+		result.Requests, result.Elapsed, result.Throughput, result.Overall.P99)
+	return result, nil
+}
+
+func (r *Runner) prepare(ctx context.Context, uids []string, mode string) error {
+	switch mode {
+	case ModeWarm:
+		for _, uid := range uids {
+			if _, _, err := r.target.Lookup(ctx, uid); err != nil {
+				return fmt.Errorf("Failed to warm up order %s: %w", uid, err)
+			}
+		}
+	case ModeCold:
+		if r.invalidator == nil {
+			return errors.New("cold mode needs access to the cache")
+		}
+	}
+	return nil
+}
+
+// samples collects latencies by source.
+type samples struct {
+	bySource map[string]*histogram
+	notFound int
+}
+
+func newSamples() *samples {
+	return &samples{bySource: make(map[string]*histogram)}
+}
+
+func (s *samples) add(source string, d time.Duration, missing bool) {
+	h, ok := s.bySource[source]
+	if !ok {
+		h = newHistogram()
+		s.bySource[source] = h
+	}
+	h.add(d)
+
+	if missing {
+		s.notFound++
+	}
+}
+
+func (s *samples) merge(other *samples) {
+	for source, oh := range other.bySource {
+		h, ok := s.bySource[source]
+		if !ok {
+			h = newHistogram()
+			s.bySource[source] = h
+		}
+		h.merge(oh)
+	}
+	s.notFound += other.notFound
+}
+
+func (s *samples) summarize() *Result {
+	result := &Result{
+		NotFound: s.notFound,
+		Sources:  make(map[string]Latency, len(s.bySource)),
+	}
+
+	all := newHistogram()
+	for source, h := range s.bySource {
+		result.Sources[source] = h.latency()
+		result.Requests += h.count
+		if source == SourceError {
+			result.Errors += h.count
+		}
+		all.merge(h)
+	}
+	result.Overall = all.latency()
+
+	return result
+}
+
+// Buckets grow by 1%, so percentiles are off by at most that much while a
+// run of any length takes constant memory.
+const (
+	bucketGrowth = 1.01
+	bucketCount  = 3000 // up to about 2.5 hours
+)
+
+var logGrowth = math.Log(bucketGrowth)
+
+type histogram struct {
+	counts   []uint64
+	count    int
+	sum      time.Duration
+	min, max time.Duration
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, bucketCount)}
+}
+
+func bucket(d time.Duration) int {
+	if d < 1 {
+		return 0
+	}
+	b := int(math.Log(float64(d)) / logGrowth)
+	if b >= bucketCount {
+		return bucketCount - 1
+	}
+	return b
+}
+
+func (h *histogram) add(d time.Duration) {
+	h.counts[bucket(d)]++
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+}
+
+func (h *histogram) merge(other *histogram) {
+	if other.count == 0 {
+		return
+	}
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	if h.count == 0 || other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+	h.count += other.count
+	h.sum += other.sum
+}
+
+// percentile uses the nearest rank and reports the upper bound of its bucket.
+func (h *histogram) percentile(p float64) time.Duration {
+	rank := uint64(math.Ceil(p * float64(h.count)))
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			upper := time.Duration(math.Pow(bucketGrowth, float64(i+1)))
+			return max(h.min, min(upper, h.max))
+		}
+	}
+	return h.max
+}
+
+func (h *histogram) latency() Latency {
+	if h.count == 0 {
+		return Latency{}
+	}
+
+	return Latency{
+		Count: h.count,
+		Min:   millis(h.min),
+		Mean:  millis(h.sum / time.Duration(h.count)),
+		P50:   millis(h.percentile(0.50)),
+		P95:   millis(h.percentile(0.95)),
+		P99:   millis(h.percentile(0.99)),
+		Max:   millis(h.max),
+	}
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,153 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Job states.
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// keepJobs is how many finished jobs are remembered for polling.
+const keepJobs = 20
+
+// ErrBusy is returned when a job is started while another one runs: two
+// load tests at once would only measure each other.
+var ErrBusy = errors.New("a benchmark is already running")
+
+// Job is a benchmark run in the background.
+type Job struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Options    Options    `json:"options"`
+	Duration   string     `json:"duration"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Result     *Result    `json:"result,omitempty"`
+	Error      string     `json:"error,omitempty"`
+
+	cancel context.CancelFunc
+}
+
+// Jobs runs benchmarks one at a time and keeps their outcome.
+type Jobs struct {
+	ctx    context.Context
+	runner *Runner
+
+	mu     sync.Mutex
+	jobs   []*Job // oldest first
+	nextID atomic.Uint64
+}
+
+// NewJobs creates the job manager. Running jobs are canceled with ctx.
+func NewJobs(ctx context.Context, runner *Runner) *Jobs {
+	return &Jobs{ctx: ctx, runner: runner}
+}
+
+// Start validates opts and launches a job.
+func (j *Jobs) Start(opts Options) (Job, error) {
+	if err := opts.Validate(); err != nil {
+		return Job{}, err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, job := range j.jobs {
+		if job.Status == StatusRunning {
+			return Job{}, ErrBusy
+		}
+	}
+
+	ctx, cancel := context.WithCancel(j.ctx)
+	job := &Job{
+		ID:        fmt.Sprintf("bench-%d", j.nextID.Add(1)),
+		Status:    StatusRunning,
+		Options:   opts,
+		Duration:  opts.Duration.String(),
+		StartedAt: time.Now(),
+		cancel:    cancel,
+	}
+
+	j.jobs = append(j.jobs, job)
+	if len(j.jobs) > keepJobs {
+		j.jobs = j.jobs[len(j.jobs)-keepJobs:]
+	}
+
+	go j.run(ctx, job)
+
+	log.Printf("Benchmark %s started: %d orders, %d workers, %s, %s cache", job.ID, opts.Sample, opts.Concurrency, opts.Duration, opts.Mode)
+	return *job, nil
+}
+
+func (j *Jobs) run(ctx context.Context, job *Job) {
+	result, err := j.runner.Run(ctx, job.Options)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	job.FinishedAt = &now
+
+	switch {
+	case ctx.Err() != nil:
+		job.Status = StatusCanceled
+	case err != nil:
+		job.Status = StatusFailed
+		job.Error = err.Error()
+		log.Printf("Benchmark %s failed: %v", job.ID, err)
+	default:
+		job.Status = StatusSucceeded
+		job.Result = result
+	}
+	job.cancel()
+}
+
+// Get returns a copy of the job.
+func (j *Jobs) Get(id string) (Job, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, job := range j.jobs {
+		if job.ID == id {
+			return *job, true
+		}
+	}
+	return Job{}, false
+}
+
+// List returns copies of the remembered jobs, newest first.
+func (j *Jobs) List() []Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	list := make([]Job, 0, len(j.jobs))
+	for i := len(j.jobs) - 1; i >= 0; i-- {
+		list = append(list, *j.jobs[i])
+	}
+	return list
+}
+
+// Cancel stops a running job. It reports false for unknown ids.
+func (j *Jobs) Cancel(id string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, job := range j.jobs {
+		if job.ID == id {
+			job.cancel()
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"order-service/internal/service"
+)
+
+// ServiceTarget measures the lookup path in-process, without HTTP.
+type ServiceTarget struct {
+	orders *service.Orders
+}
+
+func NewServiceTarget(orders *service.Orders) *ServiceTarget {
+	return &ServiceTarget{orders: orders}
+}
+
+func (t *ServiceTarget) Lookup(ctx context.Context, orderUID string) (string, bool, error) {
+	order, source, _, err := t.orders.GetOrder(ctx, orderUID)
+	return source, order != nil, err
+}
+
+// HTTPTarget measures GET /api/v1/orders/{order_uid} of a running service,
+// taking the source from the X-Data-Source header.
+type HTTPTarget struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewHTTPTarget(baseURL string, concurrency int) *HTTPTarget {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = concurrency
+
+	return &HTTPTarget{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Transport: transport},
+	}
+}
+
+func (t *HTTPTarget) Lookup(ctx context.Context, orderUID string) (string, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.baseURL+"/api/v1/orders/"+url.PathEscape(orderUID), nil)
+	if err != nil {
+		return "", false, err
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+
+	// read the body so the connection is reused and the transfer is measured
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return "", false, err
+	}
+
+	source := resp.Header.Get("X-Data-Source")
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return source, true, nil
+	case http.StatusNotFound:
+		return source, false, nil
+	default:
+		return "", false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
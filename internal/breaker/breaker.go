@@ -0,0 +1,193 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned without calling the wrapped function while the
+// breaker is open or a half-open probe is already in flight.
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// outcome is what a call tells about the dependency.
+type outcome int
+
+const (
+	succeeded outcome = iota
+	failed
+	abandoned // no verdict: counts stay as they were
+)
+
+// Breaker opens after Threshold consecutive failures, rejects calls for
+// OpenTimeout, then lets a single probe through. A successful probe closes
+// it again, a failed one reopens it. Every call is limited to CallTimeout.
+type Breaker struct {
+	name        string
+	threshold   int
+	openTimeout time.Duration
+	callTimeout time.Duration
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func New(name string, threshold int, openTimeout time.Duration, callTimeout time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = 1
+	}
+
+	return &Breaker{
+		name:        name,
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		callTimeout: callTimeout,
+	}
+}
+
+// Execute runs fn unless the breaker is open. A nil Breaker just calls fn.
+func (b *Breaker) Execute(ctx context.Context, fn func(ctx context.Context) error) error {
+	if b == nil {
+		return fn(ctx)
+	}
+
+	if !b.acquire() {
+		return fmt.Errorf("%s: %w", b.name, ErrOpen)
+	}
+
+	callCtx := ctx
+	if b.callTimeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, b.callTimeout)
+		defer cancel()
+	}
+
+	err := fn(callCtx)
+
+	switch {
+	case err == nil:
+		b.release(succeeded)
+	case ctx.Err() != nil:
+		// the caller giving up says nothing about the dependency
+		b.release(abandoned)
+	default:
+		b.release(failed)
+	}
+
+	return err
+}
+
+// Available reports whether a call would currently be let through.
+func (b *Breaker) Available() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		return time.Since(b.openedAt) >= b.openTimeout
+	case HalfOpen:
+		return !b.probing
+	default:
+		return true
+	}
+}
+
+func (b *Breaker) State() State {
+	if b == nil {
+		return Closed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Breaker) acquire() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false
+		}
+		b.state = HalfOpen
+		log.Printf("Circuit breaker %s is half-open, probing", b.name)
+		fallthrough
+	case HalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+	}
+
+	return true
+}
+
+func (b *Breaker) release(result outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == HalfOpen {
+		// an abandoned probe leaves the breaker half-open for the next one
+		b.probing = false
+		switch result {
+		case succeeded:
+			b.state = Closed
+			b.failures = 0
+			log.Printf("Circuit breaker %s is closed", b.name)
+		case failed:
+			b.trip()
+		}
+		return
+	}
+
+	switch result {
+	case succeeded:
+		b.failures = 0
+		return
+	case abandoned:
+		return
+	}
+
+	b.failures++
+	if b.state == Closed && b.failures >= b.threshold {
+		b.trip()
+	}
+}
+
+func (b *Breaker) trip() {
+	b.state = Open
+	b.openedAt = time.Now()
+	b.failures = 0
+	log.Printf("Circuit breaker %s is open for %s", b.name, b.openTimeout)
+}
@@ -0,0 +1,75 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errDown = errors.New("down")
+
+func fail(ctx context.Context) error    { return errDown }
+func succeed(ctx context.Context) error { return nil }
+
+func TestBreakerOpensAndCloses(t *testing.T) {
+	b := New("test", 2, time.Millisecond, 0)
+	ctx := context.Background()
+
+	b.Execute(ctx, fail)
+	if b.State() != Closed {
+		t.Fatalf("open after one failure")
+	}
+	b.Execute(ctx, fail)
+	if b.State() != Open {
+		t.Fatalf("state is %s after two failures", b.State())
+	}
+	if err := b.Execute(ctx, succeed); !errors.Is(err, ErrOpen) {
+		t.Fatalf("call let through while open: %v", err)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if err := b.Execute(ctx, succeed); err != nil {
+		t.Fatal(err)
+	}
+	if b.State() != Closed {
+		t.Fatalf("state is %s after a successful probe", b.State())
+	}
+}
+
+func TestBreakerIgnoresAbandonedProbe(t *testing.T) {
+	b := New("test", 1, time.Millisecond, 0)
+	b.Execute(context.Background(), fail)
+	time.Sleep(2 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := b.Execute(ctx, func(ctx context.Context) error {
+		cancel()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+	if b.State() != HalfOpen || !b.Available() {
+		t.Fatalf("state is %s after an abandoned probe, want a half-open breaker ready to probe", b.State())
+	}
+
+	b.Execute(context.Background(), fail)
+	if b.State() != Open {
+		t.Fatalf("state is %s after a failed probe", b.State())
+	}
+}
+
+func TestBreakerIgnoresAbandonedCalls(t *testing.T) {
+	b := New("test", 2, time.Minute, 0)
+	b.Execute(context.Background(), fail)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b.Execute(ctx, func(ctx context.Context) error { return ctx.Err() })
+
+	b.Execute(context.Background(), fail)
+	if b.State() != Open {
+		t.Fatalf("state is %s, an abandoned call reset the failures", b.State())
+	}
+}
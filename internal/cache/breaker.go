@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+
+	"order-service/internal/breaker"
+	"order-service/internal/models"
+)
+
+// BreakerCache guards per-order calls to another Cache with a circuit
+// breaker, so a slow or unavailable Redis fails fast instead of delaying
+// every request. Invalidations always go through: skipping one while the
+// breaker is open would leave the old order cached for the whole TTL and
+// other replicas would never hear of the change.
+type BreakerCache struct {
+	Cache
+	breaker *breaker.Breaker
+}
+
+func NewBreakerCache(cache Cache, b *breaker.Breaker) *BreakerCache {
+	return &BreakerCache{Cache: cache, breaker: b}
+}
+
+func (c *BreakerCache) GetOrder(ctx context.Context, orderUID string) (*models.Order, error) {
+	var order *models.Order
+	var notFound bool
+	err := c.breaker.Execute(ctx, func(ctx context.Context) error {
+		var err error
+		order, err = c.Cache.GetOrder(ctx, orderUID)
+		if err == ErrNotFound {
+			// a negative entry is a successful answer
+			notFound = true
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if notFound {
+		return nil, ErrNotFound
+	}
+	return order, nil
+}
+
+func (c *BreakerCache) GetOrders(ctx context.Context, orderUIDs []string) (map[string]*models.Order, error) {
+	var orders map[string]*models.Order
+	err := c.breaker.Execute(ctx, func(ctx context.Context) error {
+		var err error
+		orders, err = c.Cache.GetOrders(ctx, orderUIDs)
+		return err
+	})
+	return orders, err
+}
+
+func (c *BreakerCache) SetOrder(ctx context.Context, order *models.Order) error {
+	return c.breaker.Execute(ctx, func(ctx context.Context) error {
+		return c.Cache.SetOrder(ctx, order)
+	})
+}
+
+func (c *BreakerCache) FillVersions(ctx context.Context, orderUIDs []string) ([]string, error) {
+	var versions []string
+	err := c.breaker.Execute(ctx, func(ctx context.Context) error {
+		var err error
+		versions, err = c.Cache.FillVersions(ctx, orderUIDs)
+		return err
+	})
+	return versions, err
+}
+
+func (c *BreakerCache) FillOrder(ctx context.Context, order *models.Order, version string) error {
+	return c.breaker.Execute(ctx, func(ctx context.Context) error {
+		return c.Cache.FillOrder(ctx, order, version)
+	})
+}
+
+func (c *BreakerCache) SetNotFound(ctx context.Context, orderUID, version string) error {
+	return c.breaker.Execute(ctx, func(ctx context.Context) error {
+		return c.Cache.SetNotFound(ctx, orderUID, version)
+	})
+}
+
+func (c *BreakerCache) GetLookup(ctx context.Context, key string) ([]string, bool, string, error) {
+	var orderUIDs []string
+	var ok bool
+	var version string
+	err := c.breaker.Execute(ctx, func(ctx context.Context) error {
+		var err error
+		orderUIDs, ok, version, err = c.Cache.GetLookup(ctx, key)
+		return err
+	})
+	return orderUIDs, ok, version, err
+}
+
+func (c *BreakerCache) SetLookup(ctx context.Context, key string, orderUIDs []string, version string) error {
+	return c.breaker.Execute(ctx, func(ctx context.Context) error {
+		return c.Cache.SetLookup(ctx, key, orderUIDs, version)
+	})
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"order-service/internal/models"
+)
+
+// Cache is the shared order cache used by the HTTP server and the consumer.
+// GetOrder returns nil, nil on a miss and ErrNotFound for negative entries.
+// GetOrders leaves misses out of the result and maps negative entries to nil.
+// GetLookup reports false on a miss; see LookupKeys for the lookups.
+//
+// Orders read from the database are written back with FillOrder and
+// SetNotFound, passing the versions FillVersions returned before the read;
+// they write nothing if the order was invalidated in between. SetOrder
+// writes unconditionally. Lookups work the same way: SetLookup takes the
+// version GetLookup returned with the miss.
+type Cache interface {
+	GetOrder(ctx context.Context, orderUID string) (*models.Order, error)
+	GetOrders(ctx context.Context, orderUIDs []string) (map[string]*models.Order, error)
+	SetOrder(ctx context.Context, order *models.Order) error
+	FillVersions(ctx context.Context, orderUIDs []string) ([]string, error)
+	FillOrder(ctx context.Context, order *models.Order, version string) error
+	SetNotFound(ctx context.Context, orderUID, version string) error
+	InvalidateOrder(ctx context.Context, orderUID string) error
+	GetLookup(ctx context.Context, key string) ([]string, bool, string, error)
+	SetLookup(ctx context.Context, key string, orderUIDs []string, version string) error
+	InvalidateLookups(ctx context.Context, keys []string) error
+	SubscribeInvalidations(ctx context.Context, fn func(orderUID string))
+	Publish(ctx context.Context, channel string, payload []byte) error
+	Subscribe(ctx context.Context, channel string, fn func(payload []byte))
+	PreloadOrders(ctx context.Context, orders []models.Order) error
+	Stats() TierStats
+	Close() error
+}
+
+var (
+	_ Cache = (*RedisCache)(nil)
+	_ Cache = (*MemoryCache)(nil)
+)
+
+// Supported values of Options.Backend.
+const (
+	BackendRedis    = "redis"
+	BackendSentinel = "sentinel"
+	BackendCluster  = "cluster"
+	BackendMemory   = "memory"
+)
+
+type Options struct {
+	Backend     string
+	Addrs       []string
+	Password    string
+	DB          int
+	MasterName  string // sentinel only
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	Codec       string // json, msgpack or protobuf
+	Compression string // none, zstd or snappy
+}
+
+// New creates the cache backend selected by opts.Backend.
+func New(opts Options) (Cache, error) {
+	switch opts.Backend {
+	case BackendRedis, BackendSentinel, BackendCluster:
+		return NewRedisCache(opts)
+	case BackendMemory:
+		return NewMemoryCache(opts.TTL, opts.NegativeTTL), nil
+	default:
+		return nil, fmt.Errorf("Unknown cache backend %q", opts.Backend)
+	}
+}
@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"order-service/internal/models"
+	"order-service/internal/pb"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Every cached value starts with a header byte: the low nibble is the
+// format and the high nibble the compression. Values written before the
+// header existed are plain JSON and start with '{', which is never a valid
+// header, so they are still readable and no flush is needed when the codec
+// changes.
+const (
+	formatJSON     byte = 0x01
+	formatMsgpack  byte = 0x02
+	formatProtobuf byte = 0x03
+
+	compressionNone   byte = 0x00
+	compressionZstd   byte = 0x10
+	compressionSnappy byte = 0x20
+)
+
+var (
+	formats = map[string]byte{
+		"json":     formatJSON,
+		"msgpack":  formatMsgpack,
+		"protobuf": formatProtobuf,
+	}
+	compressions = map[string]byte{
+		"":       compressionNone,
+		"none":   compressionNone,
+		"zstd":   compressionZstd,
+		"snappy": compressionSnappy,
+	}
+
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// Codec serializes orders for the cache. Encode uses the configured format,
+// Decode accepts anything any Codec has ever written.
+type Codec struct {
+	format      byte
+	compression byte
+}
+
+func NewCodec(format string, compression string) (*Codec, error) {
+	f, ok := formats[format]
+	if !ok {
+		return nil, fmt.Errorf("Unknown cache codec %q", format)
+	}
+
+	c, ok := compressions[compression]
+	if !ok {
+		return nil, fmt.Errorf("Unknown cache compression %q", compression)
+	}
+
+	return &Codec{format: f, compression: c}, nil
+}
+
+func (c *Codec) Encode(order *models.Order) ([]byte, error) {
+	var payload []byte
+	var err error
+
+	switch c.format {
+	case formatMsgpack:
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.SetCustomStructTag("json")
+		err = enc.Encode(order)
+		payload = buf.Bytes()
+	case formatProtobuf:
+		payload, err = proto.Marshal(pb.FromModel(order))
+	default:
+		payload, err = json.Marshal(order)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encode order: %v", err)
+	}
+
+	header := []byte{c.format | c.compression}
+	switch c.compression {
+	case compressionZstd:
+		return zstdEncoder.EncodeAll(payload, header), nil
+	case compressionSnappy:
+		return append(header, snappy.Encode(nil, payload)...), nil
+	default:
+		return append(header, payload...), nil
+	}
+}
+
+func (c *Codec) Decode(data []byte) (*models.Order, error) {
+	var order models.Order
+
+	if len(data) > 0 && data[0] == '{' {
+		// legacy entry without header
+		if err := json.Unmarshal(data, &order); err != nil {
+			return nil, fmt.Errorf("Failed to decode order: %v", err)
+		}
+		return &order, nil
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("Failed to decode order: empty value")
+	}
+
+	header, payload := data[0], data[1:]
+
+	var err error
+	switch header & 0xF0 {
+	case compressionNone:
+	case compressionZstd:
+		payload, err = zstdDecoder.DecodeAll(payload, nil)
+	case compressionSnappy:
+		payload, err = snappy.Decode(nil, payload)
+	default:
+		return nil, fmt.Errorf("Unknown compression in header 0x%02x", header)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decompress order: %v", err)
+	}
+
+	switch header & 0x0F {
+	case formatJSON:
+		err = json.Unmarshal(payload, &order)
+	case formatMsgpack:
+		dec := msgpack.NewDecoder(bytes.NewReader(payload))
+		dec.SetCustomStructTag("json")
+		err = dec.Decode(&order)
+	case formatProtobuf:
+		var msg pb.Order
+		if err = proto.Unmarshal(payload, &msg); err == nil {
+			return pb.ToModel(&msg), nil
+		}
+	default:
+		return nil, fmt.Errorf("Unknown format in header 0x%02x", header)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode order: %v", err)
+	}
+
+	return &order, nil
+}
@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"order-service/internal/models"
+)
+
+var (
+	testFormats      = []string{"json", "msgpack", "protobuf"}
+	testCompressions = []string{"none", "snappy", "zstd"}
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, items := range []int{0, 1, 5} {
+		order := sampleOrder(items)
+		for _, format := range testFormats {
+			for _, compression := range testCompressions {
+				t.Run(fmt.Sprintf("%s/%s/%d", format, compression, items), func(t *testing.T) {
+					codec, err := NewCodec(format, compression)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					data, err := codec.Encode(order)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if header := data[0]; header != formats[format]|compressions[compression] {
+						t.Fatalf("header is 0x%02x", header)
+					}
+
+					// any codec reads what another wrote
+					decoded, err := (&Codec{}).Decode(data)
+					if err != nil {
+						t.Fatal(err)
+					}
+					assertSameOrder(t, decoded, order)
+				})
+			}
+		}
+	}
+}
+
+func TestCodecDecodesLegacyJSON(t *testing.T) {
+	order := sampleOrder(2)
+	data, err := json.Marshal(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codec, err := NewCodec("protobuf", "zstd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := codec.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameOrder(t, decoded, order)
+}
+
+// The markers share the keys with encoded orders, so no codec may ever
+// write a value that starts like one of them.
+func TestCodecHeadersAreNotMarkers(t *testing.T) {
+	markers := []string{"{", notFoundMarker, invalidatedPrefix}
+
+	for _, format := range testFormats {
+		for _, compression := range testCompressions {
+			codec, err := NewCodec(format, compression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := codec.Encode(sampleOrder(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, marker := range markers {
+				if data[0] == marker[0] {
+					t.Errorf("%s/%s values start with the marker %q", format, compression, marker)
+				}
+			}
+		}
+	}
+
+	tombstone := invalidatedPrefix + "3w5e11264sgsg"
+	for _, marker := range []string{notFoundMarker, tombstone} {
+		if _, err := (&Codec{}).Decode([]byte(marker)); err == nil {
+			t.Errorf("%q decodes as an order", marker)
+		}
+	}
+	if isInvalidated([]byte(notFoundMarker)) || !isInvalidated([]byte(tombstone)) {
+		t.Error("the not-found marker and tombstones are confused")
+	}
+}
+
+func TestNewCodecRejectsUnknown(t *testing.T) {
+	if _, err := NewCodec("xml", "none"); err == nil {
+		t.Error("unknown format accepted")
+	}
+	if _, err := NewCodec("json", "gzip"); err == nil {
+		t.Error("unknown compression accepted")
+	}
+}
+
+// Compares decode time of every codec for orders with a different number
+// of items; the bytes metric is the encoded size.
+func BenchmarkCodecDecode(b *testing.B) {
+	for _, items := range []int{1, 5, 20} {
+		order := sampleOrder(items)
+		for _, format := range testFormats {
+			for _, compression := range testCompressions {
+				codec, err := NewCodec(format, compression)
+				if err != nil {
+					b.Fatal(err)
+				}
+				data, err := codec.Encode(order)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				b.Run(fmt.Sprintf("items=%d/%s/%s", items, format, compression), func(b *testing.B) {
+					b.ReportAllocs()
+					b.ReportMetric(float64(len(data)), "bytes")
+					for b.Loop() {
+						if _, err := codec.Decode(data); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func BenchmarkCodecEncode(b *testing.B) {
+	order := sampleOrder(5)
+	for _, format := range testFormats {
+		for _, compression := range testCompressions {
+			codec, err := NewCodec(format, compression)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.Run(format+"/"+compression, func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					if _, err := codec.Encode(order); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// assertSameOrder compares the orders with times in UTC, since formats
+// differ in the location they decode times in.
+func assertSameOrder(t *testing.T, got, want *models.Order) {
+	t.Helper()
+
+	got, want = cloneOrder(got), cloneOrder(want)
+	for _, o := range []*models.Order{got, want} {
+		o.DateCreated = o.DateCreated.UTC()
+		o.UpdatedAt = o.UpdatedAt.UTC()
+		if len(o.Items) == 0 {
+			o.Items = nil
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded order differs:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func sampleOrder(items int) *models.Order {
+	order := &models.Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			Name:    "Test Testov",
+			Phone:   "+9720000000",
+			Zip:     "2639809",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Region:  "Kraiot",
+			Email:   "test@gmail.com",
+		},
+		Payment: models.Payment{
+			Transaction:  "b563feb7b2b84b6test",
+			Currency:     "USD",
+			Provider:     "wbpay",
+			PaymentDt:    1637907727,
+			Bank:         "alpha",
+			DeliveryCost: 1500,
+		},
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		Shardkey:        "9",
+		SmID:            99,
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		OofShard:        "1",
+		UpdatedAt:       time.Date(2021, 11, 26, 6, 22, 20, 123456000, time.UTC),
+	}
+
+	for i := 0; i < items; i++ {
+		item := models.Item{
+			ChrtID:      9934930 + i,
+			TrackNumber: "WBILMTESTTRACK",
+			Price:       453 + i*10,
+			Rid:         fmt.Sprintf("ab4219087a764ae0btest%d", i),
+			Name:        fmt.Sprintf("Mascaras %d", i),
+			Sale:        30,
+			Size:        "0",
+			NmID:        2389212 + i,
+			Brand:       "Vivienne Sabo",
+			Status:      202,
+		}
+		item.TotalPrice = item.Price * (100 - item.Sale) / 100
+		order.Items = append(order.Items, item)
+		order.Payment.GoodsTotal += item.TotalPrice
+	}
+	order.Payment.Amount = order.Payment.GoodsTotal + order.Payment.DeliveryCost
+
+	return order
+}
@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"order-service/internal/models"
+)
+
+// Filler writes orders to the cache in the background using a fixed
+// number of workers and a bounded queue. When the queue is full new
+// orders are dropped: the next miss will simply try again.
+type Filler struct {
+	cache   Cache
+	queue   chan fill
+	timeout time.Duration
+	wg      sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+type fill struct {
+	order   *models.Order
+	version string
+}
+
+func NewFiller(cache Cache, queueSize int, workers int) *Filler {
+	if queueSize <= 0 {
+		queueSize = 1
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+
+	f := &Filler{
+		cache:   cache,
+		queue:   make(chan fill, queueSize),
+		timeout: 5 * time.Second,
+	}
+
+	for i := 0; i < workers; i++ {
+		f.wg.Add(1)
+		go f.worker()
+	}
+
+	return f
+}
+
+// Enqueue schedules the order for caching with Cache.FillOrder, so version
+// is what FillVersions returned before the order was read. It never blocks.
+func (f *Filler) Enqueue(order *models.Order, version string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.closed {
+		return false
+	}
+
+	select {
+	case f.queue <- fill{order, version}:
+		return true
+	default:
+		log.Printf("Cache fill queue is full, dropping order %s", order.OrderUID)
+		return false
+	}
+}
+
+func (f *Filler) worker() {
+	defer f.wg.Done()
+
+	for fill := range f.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+		if err := f.cache.FillOrder(ctx, fill.order, fill.version); err != nil {
+			log.Printf("Failed to set order in cache: %v", err)
+		}
+		cancel()
+	}
+}
+
+// Close stops accepting orders and waits until the queue is drained.
+func (f *Filler) Close() {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return
+	}
+	f.closed = true
+	close(f.queue)
+	f.mu.Unlock()
+
+	f.wg.Wait()
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"order-service/internal/models"
+)
+
+// LocalCache is an in-process LRU cache of orders bounded both by the
+// number of entries and by their approximate size in memory. It sits in
+// front of Redis so hot orders skip the network round trip and the decode.
+// Orders are copied in and out, so callers never share them.
+type LocalCache struct {
+	mu          sync.Mutex
+	maxEntries  int
+	maxBytes    int64
+	ttl         time.Duration
+	bytes       int64
+	ll          *list.List
+	items       map[string]*list.Element
+	generations generations
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type localEntry struct {
+	order   *models.Order
+	size    int64
+	expires time.Time
+}
+
+// TierStats holds hit/miss counters of one cache tier.
+type TierStats struct {
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+func newTierStats(hits, misses uint64) TierStats {
+	stats := TierStats{Hits: hits, Misses: misses}
+	if total := hits + misses; total > 0 {
+		stats.HitRate = float64(hits) / float64(total)
+	}
+	return stats
+}
+
+func NewLocalCache(maxEntries int, maxBytes int64, ttl time.Duration) *LocalCache {
+	return &LocalCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ttl:        ttl,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+func (c *LocalCache) GetOrder(orderUID string) *models.Order {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[orderUID]
+	if !ok {
+		c.misses.Add(1)
+		return nil
+	}
+
+	entry := elem.Value.(*localEntry)
+	if c.ttl > 0 && time.Now().After(entry.expires) {
+		c.removeElement(elem)
+		c.misses.Add(1)
+		return nil
+	}
+
+	c.ll.MoveToFront(elem)
+	c.hits.Add(1)
+	return cloneOrder(entry.order)
+}
+
+// Version is read before the order is read from a slower tier and passed
+// to FillOrder, like Cache.FillVersions.
+func (c *LocalCache) Version(orderUID string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generations.get(orderUID)
+}
+
+// FillOrder caches the order unless it was deleted since version.
+func (c *LocalCache) FillOrder(order *models.Order, version uint64) {
+	size := estimateSize(order)
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return
+	}
+	order = cloneOrder(order)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generations.get(order.OrderUID) != version {
+		return
+	}
+	if elem, ok := c.items[order.OrderUID]; ok {
+		c.removeElement(elem)
+	}
+
+	entry := &localEntry{
+		order:   order,
+		size:    size,
+		expires: time.Now().Add(c.ttl),
+	}
+	c.items[order.OrderUID] = c.ll.PushFront(entry)
+	c.bytes += size
+
+	for c.overLimit() {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *LocalCache) Delete(orderUID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generations.bump(orderUID)
+	if elem, ok := c.items[orderUID]; ok {
+		c.removeElement(elem)
+	}
+}
+
+func (c *LocalCache) Stats() TierStats {
+	return newTierStats(c.hits.Load(), c.misses.Load())
+}
+
+func (c *LocalCache) overLimit() bool {
+	if c.ll.Len() == 0 {
+		return false
+	}
+	if c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		return true
+	}
+	return c.maxBytes > 0 && c.bytes > c.maxBytes
+}
+
+func (c *LocalCache) removeElement(elem *list.Element) {
+	entry := c.ll.Remove(elem).(*localEntry)
+	delete(c.items, entry.order.OrderUID)
+	c.bytes -= entry.size
+}
+
+// estimateSize approximates the memory held by an order without encoding it.
+func estimateSize(order *models.Order) int64 {
+	size := 256 + len(order.OrderUID) + len(order.TrackNumber) + len(order.Entry) +
+		len(order.Locale) + len(order.InternalSignature) + len(order.CustomerID) +
+		len(order.DeliveryService) + len(order.Shardkey) + len(order.OofShard)
+
+	d := order.Delivery
+	size += len(d.Name) + len(d.Phone) + len(d.Zip) + len(d.City) + len(d.Address) + len(d.Region) + len(d.Email)
+
+	p := order.Payment
+	size += len(p.Transaction) + len(p.RequestID) + len(p.Currency) + len(p.Provider) + len(p.Bank)
+
+	for _, item := range order.Items {
+		size += 96 + len(item.TrackNumber) + len(item.Rid) + len(item.Name) + len(item.Size) + len(item.Brand)
+	}
+
+	return int64(size)
+}
@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"order-service/internal/models"
+)
+
+// Lookups are secondary keys: each maps a track number or a customer to the
+// uids of their orders, as last read from the database. They are kept
+// consistent in two halves. A write drops the lookups the order is listed
+// under now (LookupKeys), so its new track numbers and customer are looked
+// up again; and readers skip orders that no longer match the lookup, which
+// covers the values the order had before. Lookups are versioned like orders
+// (see versions.go), so a reader never puts back a list read before a write.
+
+// TrackKey is the lookup of the orders with a track number on the order or
+// on one of its items.
+func TrackKey(trackNumber string) string {
+	return "track:" + trackNumber
+}
+
+// CustomerKey is the lookup of the orders of a customer.
+func CustomerKey(customerID string) string {
+	return "customer:" + customerID
+}
+
+// LookupKeys returns every lookup the order is listed under.
+func LookupKeys(order *models.Order) []string {
+	keys := []string{CustomerKey(order.CustomerID)}
+	seen := make(map[string]bool)
+	for _, trackNumber := range append([]string{order.TrackNumber}, itemTrackNumbers(order)...) {
+		if trackNumber == "" || seen[trackNumber] {
+			continue
+		}
+		seen[trackNumber] = true
+		keys = append(keys, TrackKey(trackNumber))
+	}
+	return keys
+}
+
+func itemTrackNumbers(order *models.Order) []string {
+	trackNumbers := make([]string, len(order.Items))
+	for i, item := range order.Items {
+		trackNumbers[i] = item.TrackNumber
+	}
+	return trackNumbers
+}
@@ -0,0 +1,270 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"order-service/internal/models"
+)
+
+// MemoryCache is a process-local Cache backend for development and tests.
+// Invalidations and published messages only reach subscribers inside the
+// same process. Orders are copied in and out, so callers never share them.
+type MemoryCache struct {
+	mu          sync.RWMutex
+	entries     map[string]memoryEntry
+	lookups     map[string]lookupEntry
+	generations generations
+	lookupGens  generations
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	subsMu sync.Mutex
+	subs   map[string]map[int]func(payload []byte)
+	nextID int
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+
+	stop chan struct{}
+	once sync.Once
+}
+
+type memoryEntry struct {
+	order   *models.Order // nil for negative entries
+	expires time.Time
+}
+
+type lookupEntry struct {
+	orderUIDs []string
+	expires   time.Time
+}
+
+func NewMemoryCache(ttl time.Duration, negativeTTL time.Duration) *MemoryCache {
+	c := &MemoryCache{
+		entries:     make(map[string]memoryEntry),
+		lookups:     make(map[string]lookupEntry),
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		subs:        make(map[string]map[int]func(payload []byte)),
+		stop:        make(chan struct{}),
+	}
+
+	go c.sweep(time.Minute)
+
+	return c
+}
+
+func (c *MemoryCache) GetOrder(ctx context.Context, orderUID string) (*models.Order, error) {
+	c.mu.RLock()
+	entry, ok := c.entries[orderUID]
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(entry.expires) {
+		c.misses.Add(1)
+		return nil, nil
+	}
+	c.hits.Add(1)
+
+	if entry.order == nil {
+		return nil, ErrNotFound
+	}
+
+	return cloneOrder(entry.order), nil
+}
+
+func (c *MemoryCache) GetOrders(ctx context.Context, orderUIDs []string) (map[string]*models.Order, error) {
+	now := time.Now()
+	orders := make(map[string]*models.Order, len(orderUIDs))
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, orderUID := range orderUIDs {
+		entry, ok := c.entries[orderUID]
+		if !ok || now.After(entry.expires) {
+			c.misses.Add(1)
+			continue
+		}
+		c.hits.Add(1)
+		orders[orderUID] = cloneOrder(entry.order)
+	}
+
+	return orders, nil
+}
+
+func (c *MemoryCache) SetOrder(ctx context.Context, order *models.Order) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(order.OrderUID, cloneOrder(order), c.ttl)
+	return nil
+}
+
+func (c *MemoryCache) FillVersions(ctx context.Context, orderUIDs []string) ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	versions := make([]string, len(orderUIDs))
+	for i, orderUID := range orderUIDs {
+		versions[i] = version(c.generations.get(orderUID))
+	}
+	return versions, nil
+}
+
+func (c *MemoryCache) FillOrder(ctx context.Context, order *models.Order, version string) error {
+	c.fill(order.OrderUID, cloneOrder(order), version, c.ttl)
+	return nil
+}
+
+func (c *MemoryCache) SetNotFound(ctx context.Context, orderUID, version string) error {
+	if c.negativeTTL <= 0 {
+		return nil
+	}
+
+	c.fill(orderUID, nil, version, c.negativeTTL)
+	return nil
+}
+
+func (c *MemoryCache) InvalidateOrder(ctx context.Context, orderUID string) error {
+	c.mu.Lock()
+	delete(c.entries, orderUID)
+	c.generations.bump(orderUID)
+	c.mu.Unlock()
+
+	return c.Publish(ctx, invalidationChannel, []byte(orderUID))
+}
+
+func (c *MemoryCache) GetLookup(ctx context.Context, key string) ([]string, bool, string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.lookups[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false, version(c.lookupGens.get(key)), nil
+	}
+	return append([]string(nil), entry.orderUIDs...), true, "", nil
+}
+
+func (c *MemoryCache) SetLookup(ctx context.Context, key string, orderUIDs []string, v string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if version(c.lookupGens.get(key)) != v {
+		return nil
+	}
+	c.lookups[key] = lookupEntry{
+		orderUIDs: append([]string(nil), orderUIDs...),
+		expires:   time.Now().Add(c.ttl),
+	}
+	return nil
+}
+
+func (c *MemoryCache) InvalidateLookups(ctx context.Context, keys []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		delete(c.lookups, key)
+		c.lookupGens.bump(key)
+	}
+	return nil
+}
+
+func (c *MemoryCache) SubscribeInvalidations(ctx context.Context, fn func(orderUID string)) {
+	c.Subscribe(ctx, invalidationChannel, func(payload []byte) {
+		fn(string(payload))
+	})
+}
+
+func (c *MemoryCache) Publish(ctx context.Context, channel string, payload []byte) error {
+	c.subsMu.Lock()
+	defer c.subsMu.Unlock()
+
+	for _, fn := range c.subs[channel] {
+		fn(payload)
+	}
+	return nil
+}
+
+func (c *MemoryCache) Subscribe(ctx context.Context, channel string, fn func(payload []byte)) {
+	c.subsMu.Lock()
+	id := c.nextID
+	c.nextID++
+	if c.subs[channel] == nil {
+		c.subs[channel] = make(map[int]func(payload []byte))
+	}
+	c.subs[channel][id] = fn
+	c.subsMu.Unlock()
+
+	<-ctx.Done()
+
+	c.subsMu.Lock()
+	delete(c.subs[channel], id)
+	c.subsMu.Unlock()
+}
+
+func (c *MemoryCache) PreloadOrders(ctx context.Context, orders []models.Order) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range orders {
+		c.set(orders[i].OrderUID, cloneOrder(&orders[i]), c.ttl)
+	}
+	return nil
+}
+
+func (c *MemoryCache) Stats() TierStats {
+	return newTierStats(c.hits.Load(), c.misses.Load())
+}
+
+func (c *MemoryCache) Close() error {
+	c.once.Do(func() { close(c.stop) })
+	return nil
+}
+
+// fill sets the entry unless the order was invalidated since version.
+func (c *MemoryCache) fill(orderUID string, order *models.Order, v string, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if version(c.generations.get(orderUID)) == v {
+		c.set(orderUID, order, ttl)
+	}
+}
+
+// set is called with c.mu held.
+func (c *MemoryCache) set(orderUID string, order *models.Order, ttl time.Duration) {
+	c.entries[orderUID] = memoryEntry{
+		order:   order,
+		expires: time.Now().Add(ttl),
+	}
+}
+
+// sweep periodically drops expired entries so the map does not grow forever.
+func (c *MemoryCache) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case now := <-ticker.C:
+			c.mu.Lock()
+			for uid, entry := range c.entries {
+				if now.After(entry.expires) {
+					delete(c.entries, uid)
+				}
+			}
+			for key, entry := range c.lookups {
+				if now.After(entry.expires) {
+					delete(c.lookups, key)
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+}
@@ -3,7 +3,12 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math/rand/v2"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"order-service/internal/models"
@@ -11,41 +16,105 @@ import (
 	"github.com/go-redis/redis/v8"
 )
 
+// ErrNotFound is returned by GetOrder when the order is cached as missing.
+var ErrNotFound = errors.New("order not found")
+
+// notFoundMarker is stored instead of order JSON for negative cache entries.
+const notFoundMarker = "-"
+
+// invalidatedPrefix starts the value an invalidated order is replaced with:
+// a miss for readers, and a new version for fills, since the rest is random.
+// Like '{' and notFoundMarker it is never a codec header.
+const invalidatedPrefix = "~"
+
+// cachedVersion is the version of an entry that already holds an order or a
+// negative entry. No value equals it, so fills of such entries are skipped:
+// someone else filled it first.
+const cachedVersion = "="
+
+// fillScript sets KEYS[1] to ARGV[2] for ARGV[3] milliseconds (0 for no
+// expiry) if its value is still ARGV[1], an empty string standing for no
+// value. One key per script keeps it working in cluster mode.
+var fillScript = redis.NewScript(`
+	local current = redis.call('GET', KEYS[1]) or ''
+	if current ~= ARGV[1] then
+		return 0
+	end
+	if tonumber(ARGV[3]) > 0 then
+		redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+	else
+		redis.call('SET', KEYS[1], ARGV[2])
+	end
+	return 1
+`)
+
+// invalidationChannel carries uids of changed orders to every replica.
+const invalidationChannel = "orders:invalidate"
+
 type RedisCache struct {
-	client *redis.Client
-	ttl    time.Duration
+	client      redis.UniversalClient
+	codec       *Codec
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
 }
 
-func NewRedisCache(addr string, password string, db int, ttl time.Duration) (*RedisCache, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: password,
-		DB:       db,
-	})
+// NewRedisCache connects to a single node, a Sentinel-managed master or a
+// Redis Cluster depending on opts.Backend.
+func NewRedisCache(opts Options) (*RedisCache, error) {
+	codec, err := NewCodec(opts.Codec, opts.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	universal := &redis.UniversalOptions{
+		Addrs:      opts.Addrs,
+		Password:   opts.Password,
+		DB:         opts.DB,
+		MasterName: opts.MasterName,
+	}
+
+	var client redis.UniversalClient
+	switch opts.Backend {
+	case BackendSentinel:
+		if opts.MasterName == "" {
+			return nil, fmt.Errorf("Sentinel master name is required")
+		}
+		client = redis.NewFailoverClient(universal.Failover())
+	case BackendCluster:
+		client = redis.NewClusterClient(universal.Cluster())
+	default:
+		client = redis.NewClient(universal.Simple())
+	}
 
 	// Check connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := client.Ping(ctx).Result()
+	_, err = client.Ping(ctx).Result()
 	if err != nil {
+		client.Close()
 		return nil, fmt.Errorf("Failed to connect to Redis: %v", err)
 	}
 
 	return &RedisCache{
-		client: client,
-		ttl:    ttl,
+		client:      client,
+		codec:       codec,
+		ttl:         opts.TTL,
+		negativeTTL: opts.NegativeTTL,
 	}, nil
 }
 
 func (c *RedisCache) SetOrder(ctx context.Context, order *models.Order) error {
 	key := fmt.Sprintf("order:%s", order.OrderUID)
-	jsonData, err := json.Marshal(order)
+	data, err := c.codec.Encode(order)
 	if err != nil {
-		return fmt.Errorf("Failed to marshal order: %v", err)
+		return err
 	}
 
-	err = c.client.Set(ctx, key, jsonData, c.ttl).Err()
+	err = c.client.Set(ctx, key, data, c.ttl).Err()
 	if err != nil {
 		return fmt.Errorf("Failed to set order in cache: %v", err)
 	}
@@ -55,20 +124,227 @@ func (c *RedisCache) SetOrder(ctx context.Context, order *models.Order) error {
 
 func (c *RedisCache) GetOrder(ctx context.Context, orderUID string) (*models.Order, error) {
 	key := fmt.Sprintf("order:%s", orderUID)
-	jsonData, err := c.client.Get(ctx, key).Bytes()
-	if err == redis.Nil {
+	data, err := c.client.Get(ctx, key).Bytes()
+	if err == redis.Nil || (err == nil && isInvalidated(data)) {
+		c.misses.Add(1)
 		return nil, nil
 	} else if err != nil {
 		return nil, fmt.Errorf("Failed to get order from cache: %v", err)
 	}
+	c.hits.Add(1)
+
+	if string(data) == notFoundMarker {
+		return nil, ErrNotFound
+	}
+
+	return c.codec.Decode(data)
+}
+
+// GetOrders fetches several orders in one pipelined round trip. Pipelining
+// (rather than MGET) also works in cluster mode where keys live on different slots.
+func (c *RedisCache) GetOrders(ctx context.Context, orderUIDs []string) (map[string]*models.Order, error) {
+	pipe := c.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(orderUIDs))
+	for i, orderUID := range orderUIDs {
+		cmds[i] = pipe.Get(ctx, fmt.Sprintf("order:%s", orderUID))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("Failed to get orders from cache: %v", err)
+	}
+
+	orders := make(map[string]*models.Order, len(orderUIDs))
+	for i, cmd := range cmds {
+		data, err := cmd.Bytes()
+		if err == redis.Nil || (err == nil && isInvalidated(data)) {
+			c.misses.Add(1)
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("Failed to get order from cache: %v", err)
+		}
+		c.hits.Add(1)
+
+		if string(data) == notFoundMarker {
+			orders[orderUIDs[i]] = nil
+			continue
+		}
+
+		order, err := c.codec.Decode(data)
+		if err != nil {
+			return nil, err
+		}
+		orders[orderUIDs[i]] = order
+	}
+
+	return orders, nil
+}
+
+// FillVersions reads the versions of the entries in one pipelined round
+// trip: the random part of an invalidated entry, or nothing for a missing
+// one.
+func (c *RedisCache) FillVersions(ctx context.Context, orderUIDs []string) ([]string, error) {
+	pipe := c.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(orderUIDs))
+	for i, orderUID := range orderUIDs {
+		cmds[i] = pipe.Get(ctx, fmt.Sprintf("order:%s", orderUID))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("Failed to get order versions from cache: %v", err)
+	}
+
+	versions := make([]string, len(orderUIDs))
+	for i, cmd := range cmds {
+		data, err := cmd.Bytes()
+		switch {
+		case err == redis.Nil:
+		case err != nil:
+			return nil, fmt.Errorf("Failed to get order version from cache: %v", err)
+		case isInvalidated(data):
+			versions[i] = string(data)
+		default:
+			versions[i] = cachedVersion
+		}
+	}
+	return versions, nil
+}
+
+func (c *RedisCache) FillOrder(ctx context.Context, order *models.Order, version string) error {
+	data, err := c.codec.Encode(order)
+	if err != nil {
+		return err
+	}
+
+	if err := c.fill(ctx, fmt.Sprintf("order:%s", order.OrderUID), version, data, c.ttl); err != nil {
+		return fmt.Errorf("Failed to set order in cache: %v", err)
+	}
+	return nil
+}
+
+// SetNotFound remembers that the order does not exist for a short time,
+// so repeated lookups of unknown uids do not reach the database.
+func (c *RedisCache) SetNotFound(ctx context.Context, orderUID, version string) error {
+	if c.negativeTTL <= 0 {
+		return nil
+	}
+
+	if err := c.fill(ctx, fmt.Sprintf("order:%s", orderUID), version, []byte(notFoundMarker), c.negativeTTL); err != nil {
+		return fmt.Errorf("Failed to set negative cache entry: %v", err)
+	}
+	return nil
+}
+
+func (c *RedisCache) fill(ctx context.Context, key, version string, data []byte, ttl time.Duration) error {
+	return fillScript.Run(ctx, c.client, []string{key}, version, data, ttl.Milliseconds()).Err()
+}
+
+// InvalidateOrder replaces the cached order with a new version, so that
+// fills still holding the old one are dropped, and tells other replicas to
+// drop their in-memory copies too. The replacement lives as long as an
+// order would, which is longer than any fill takes.
+func (c *RedisCache) InvalidateOrder(ctx context.Context, orderUID string) error {
+	if err := c.client.Set(ctx, fmt.Sprintf("order:%s", orderUID), newInvalidated(), c.ttl).Err(); err != nil {
+		return fmt.Errorf("Failed to delete order from cache: %v", err)
+	}
+
+	return c.Publish(ctx, invalidationChannel, []byte(orderUID))
+}
+
+// newInvalidated returns a value to replace an invalidated entry with.
+func newInvalidated() string {
+	return invalidatedPrefix + strconv.FormatUint(rand.Uint64(), 36)
+}
+
+func isInvalidated(data []byte) bool {
+	return len(data) > 0 && data[0] == invalidatedPrefix[0]
+}
+
+// GetLookup returns the version of the entry along with a miss, like
+// FillVersions does for orders.
+func (c *RedisCache) GetLookup(ctx context.Context, key string) ([]string, bool, string, error) {
+	data, err := c.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, false, "", nil
+	} else if err != nil {
+		return nil, false, "", fmt.Errorf("Failed to get %s from cache: %v", key, err)
+	}
+	if isInvalidated(data) {
+		return nil, false, string(data), nil
+	}
+
+	var orderUIDs []string
+	if err := json.Unmarshal(data, &orderUIDs); err != nil {
+		return nil, false, "", fmt.Errorf("Failed to decode %s: %v", key, err)
+	}
+	return orderUIDs, true, "", nil
+}
 
-	var order models.Order
-	err = json.Unmarshal(jsonData, &order)
+func (c *RedisCache) SetLookup(ctx context.Context, key string, orderUIDs []string, version string) error {
+	if orderUIDs == nil {
+		orderUIDs = []string{}
+	}
+	data, err := json.Marshal(orderUIDs)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to unmarshal order: %v", err)
+		return err
+	}
+
+	if err := c.fill(ctx, key, version, data, c.ttl); err != nil {
+		return fmt.Errorf("Failed to set %s in cache: %v", key, err)
+	}
+	return nil
+}
+
+// InvalidateLookups replaces the lookups with new versions, as
+// InvalidateOrder does, one by one in a pipeline, since in cluster mode they
+// live on different slots.
+func (c *RedisCache) InvalidateLookups(ctx context.Context, keys []string) error {
+	pipe := c.client.Pipeline()
+	for _, key := range keys {
+		pipe.Set(ctx, key, newInvalidated(), c.ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("Failed to delete lookups from cache: %v", err)
+	}
+	return nil
+}
+
+// SubscribeInvalidations calls fn for every invalidated order uid until ctx is done.
+func (c *RedisCache) SubscribeInvalidations(ctx context.Context, fn func(orderUID string)) {
+	c.Subscribe(ctx, invalidationChannel, func(payload []byte) {
+		fn(string(payload))
+	})
+}
+
+// Publish sends payload to every subscriber of channel on every replica.
+func (c *RedisCache) Publish(ctx context.Context, channel string, payload []byte) error {
+	if err := c.client.Publish(ctx, channel, payload).Err(); err != nil {
+		return fmt.Errorf("Failed to publish to %s: %v", channel, err)
+	}
+	return nil
+}
+
+// Subscribe calls fn for every message on channel until ctx is done.
+func (c *RedisCache) Subscribe(ctx context.Context, channel string, fn func(payload []byte)) {
+	pubsub := c.client.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				log.Printf("Subscription to %s closed", channel)
+				return
+			}
+			fn([]byte(msg.Payload))
+		}
 	}
+}
 
-	return &order, nil
+func (c *RedisCache) Stats() TierStats {
+	return newTierStats(c.hits.Load(), c.misses.Load())
 }
 
 func (c *RedisCache) PreloadOrders(ctx context.Context, orders []models.Order) error {
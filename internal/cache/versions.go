@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"hash/fnv"
+	"slices"
+	"strconv"
+
+	"order-service/internal/models"
+)
+
+// A fill writes an order read from the database back to the cache. It must
+// not undo an invalidation that happened while the order was being read, or
+// the old copy would be served until it expires. Every cache entry therefore
+// has a version that changes when the order is invalidated: the version is
+// read before the database, and the fill only goes ahead if it is still the
+// same.
+
+// generations counts invalidations per uid for the in-process tiers. The
+// counters are striped so memory stays bounded; uids sharing a stripe only
+// cost each other a skipped fill. Callers hold their cache's lock.
+type generations [256]uint64
+
+func (g *generations) slot(orderUID string) *uint64 {
+	h := fnv.New32a()
+	h.Write([]byte(orderUID))
+	return &g[h.Sum32()%uint32(len(g))]
+}
+
+func (g *generations) get(orderUID string) uint64 {
+	return *g.slot(orderUID)
+}
+
+func (g *generations) bump(orderUID string) {
+	*g.slot(orderUID)++
+}
+
+// version renders a generation as a Cache version.
+func version(generation uint64) string {
+	return strconv.FormatUint(generation, 10)
+}
+
+// cloneOrder copies an order so that cached orders are never shared with
+// callers, who are free to change what they get.
+func cloneOrder(order *models.Order) *models.Order {
+	if order == nil {
+		return nil
+	}
+	c := *order
+	c.Items = slices.Clone(order.Items)
+	return &c
+}
@@ -3,23 +3,66 @@ package database
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
+	"order-service/internal/archive"
+	"order-service/internal/breaker"
 	"order-service/internal/models"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type PostgresRepository struct {
-	pool *pgxpool.Pool
+	pool    *pgxpool.Pool
+	replica *replica         // serves reads when set and caught up
+	breaker *breaker.Breaker // guards per-order queries, may be nil
+	archive *archive.Archive // orders of dropped partitions, may be nil
+	// when sharded, the databases orders are spread over, the first one
+	// being this repository without the shards
+	shards shardSet
 }
 
-func NewPostgresRepository(ctx context.Context, connString string) (*PostgresRepository, error) {
+func NewPostgresRepository(ctx context.Context, opts Options, br *breaker.Breaker) (*PostgresRepository, error) {
+	repo, err := openRepository(ctx, opts, opts.ConnString, opts.ArchiveDir, br)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.ReplicaConnString != "" {
+		replicaConfig, err := opts.poolConfig(opts.ReplicaConnString)
+		if err != nil {
+			repo.Close()
+			return nil, fmt.Errorf("Failed to configure replica: %w", err)
+		}
+		replicaPool, err := pgxpool.NewWithConfig(ctx, replicaConfig)
+		if err != nil {
+			repo.Close()
+			return nil, fmt.Errorf("Failed to create replica connection pool: %w", err)
+		}
+		repo.replica = newReplica(replicaPool, opts.MaxReplicaLag, opts.ReplicaCheckInterval)
+	}
+
+	if len(opts.ShardConnStrings) > 0 {
+		if err := repo.openShards(ctx, opts); err != nil {
+			repo.Close()
+			return nil, err
+		}
+	}
+
+	log.Println("Successfully connected to PostgreSQL")
+	return repo, nil
+}
+
+// openRepository connects to one database and, with opts.Migrate, creates
+// the tables there.
+func openRepository(ctx context.Context, opts Options, connString, archiveDir string, br *breaker.Breaker) (*PostgresRepository, error) {
 	// Parse connection string
-	config, err := pgxpool.ParseConfig(connString)
+	config, err := opts.poolConfig(connString)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to parse connection string: %w", err)
+		return nil, err
 	}
 
 	// Create connection pool
@@ -28,43 +71,61 @@ func NewPostgresRepository(ctx context.Context, connString string) (*PostgresRep
 		return nil, fmt.Errorf("Failed to create connection pool: %w", err)
 	}
 
-	repo := &PostgresRepository{pool: pool}
+	repo := &PostgresRepository{pool: pool, breaker: br}
+	if archiveDir != "" {
+		repo.archive = archive.New(archiveDir)
+	}
 
 	// Test the connection
 	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("Failed to ping database: %w", err)
 	}
 
-	// Create tables
-	if err := repo.createTables(ctx); err != nil {
-		return nil, fmt.Errorf("Failed to create tables: %w", err)
+	if opts.Migrate {
+		if err := repo.migrate(ctx); err != nil {
+			pool.Close()
+			return nil, err
+		}
 	}
-
-	log.Println("Successfully connected to PostgreSQL")
 	return repo, nil
 }
 
+// migrate brings the schema of the database up to date.
+func (r *PostgresRepository) migrate(ctx context.Context) error {
+	if err := r.createTables(ctx); err != nil {
+		return fmt.Errorf("Failed to create tables: %w", err)
+	}
+	if err := r.createReportViews(ctx); err != nil {
+		return err
+	}
+	return r.createSearchIndexes(ctx)
+}
+
 func (r *PostgresRepository) createTables(ctx context.Context) error {
-	query := `
-		CREATE TABLE IF NOT EXISTS orders (
-			order_uid VARCHAR(255) PRIMARY KEY,
-			track_number VARCHAR(255),
-			entry VARCHAR(255),
-			delivery JSONB NOT NULL,
-			payment JSONB NOT NULL,
-			items JSONB NOT NULL,
-			locale VARCHAR(255),
-			internal_signature VARCHAR(255),
-			customer_id VARCHAR(255),
-			delivery_service VARCHAR(255),
-			shardkey VARCHAR(255),
-			sm_id INTEGER,
-			date_created TIMESTAMP WITH TIME ZONE,
-			oof_shard VARCHAR(255)
-		);
+	if err := r.migrateOrders(ctx); err != nil {
+		return err
+	}
+
+	query := ordersTable + `
+		-- tables created before updated_at was introduced
+		ALTER TABLE orders ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
 
 		CREATE INDEX IF NOT EXISTS idx_orders_order_uid ON orders(order_uid);
-				CREATE INDEX IF NOT EXISTS idx_orders_date_created ON orders(date_created);
+		CREATE INDEX IF NOT EXISTS idx_orders_date_created ON orders(date_created);
+		CREATE INDEX IF NOT EXISTS idx_orders_track_number ON orders(track_number);
+		CREATE INDEX IF NOT EXISTS idx_orders_customer_id ON orders(customer_id, date_created);
+		-- track numbers of the items
+		CREATE INDEX IF NOT EXISTS idx_orders_items ON orders USING GIN (items jsonb_path_ops);
+
+		-- price of one unit of base in units of quote from valid_from on
+		CREATE TABLE IF NOT EXISTS exchange_rates (
+			base CHAR(3) NOT NULL,
+			quote CHAR(3) NOT NULL,
+			rate NUMERIC(24, 12) NOT NULL CHECK (rate > 0),
+			valid_from DATE NOT NULL,
+			PRIMARY KEY (base, quote, valid_from)
+		);
 	`
 
 	_, err := r.pool.Exec(ctx, query)
@@ -77,17 +138,120 @@ func (r *PostgresRepository) createTables(ctx context.Context) error {
 }
 
 func (r *PostgresRepository) Close() {
+	// the first shard shares the pools of r
+	if len(r.shards) > 1 {
+		for _, shard := range r.shards[1:] {
+			shard.Close()
+		}
+	}
+	if r.replica != nil {
+		r.replica.close()
+	}
 	r.pool.Close()
 }
 
-func (r *PostgresRepository) SaveOrder(ctx context.Context, order *models.Order) error {
+// reader is the pool for reads: the replica unless it lags or ctx asks for
+// the primary.
+func (r *PostgresRepository) reader(ctx context.Context) *pgxpool.Pool {
+	if r.replica == nil || !r.replica.healthy.Load() {
+		return r.pool
+	}
+	if primary, _ := ctx.Value(primaryKey{}).(bool); primary {
+		return r.pool
+	}
+	return r.replica.pool
+}
+
+// Available reports whether the database circuit breaker lets calls through.
+func (r *PostgresRepository) Available() bool {
+	return r.breaker.Available()
+}
+
+// ErrConflict is returned by UpdateOrder when the order was saved again
+// since it was read.
+var ErrConflict = errors.New("order was changed concurrently")
+
+// SaveOrder inserts or updates the order and reports whether it was new.
+func (r *PostgresRepository) SaveOrder(ctx context.Context, order *models.Order) (bool, error) {
+	return r.save(ctx, order, time.Time{})
+}
+
+// UpdateOrder saves an order that was read and changed, like SaveOrder,
+// unless it was saved again in between: readAt is the updated_at it was read
+// with. Then it returns ErrConflict, and the change is to be made again to
+// the new version. An order missing from the table, such as an archived
+// one, is saved.
+func (r *PostgresRepository) UpdateOrder(ctx context.Context, order *models.Order, readAt time.Time) (bool, error) {
+	return r.save(ctx, order, readAt)
+}
+
+func (r *PostgresRepository) save(ctx context.Context, order *models.Order, readAt time.Time) (bool, error) {
+	if r.shards != nil {
+		return r.shards.saveOrder(ctx, order, readAt)
+	}
+
+	var created, conflict bool
+	err := r.breaker.Execute(ctx, func(ctx context.Context) error {
+		var err error
+		created, err = r.saveOrder(ctx, "orders", order, readAt)
+		if errors.Is(err, ErrConflict) {
+			// a conflict is a successful answer
+			conflict = true
+			return nil
+		}
+		return err
+	})
+	if conflict {
+		return false, ErrConflict
+	}
+	return created, err
+}
+
+// CreateShadowTable creates an empty table with the layout of orders, so
+// replays can be compared with the live data before replacing it.
+func (r *PostgresRepository) CreateShadowTable(ctx context.Context, table string) error {
+	if r.shards != nil {
+		return r.shards.createShadowTable(ctx, table)
+	}
+
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (LIKE orders INCLUDING ALL)`, pgx.Identifier{table}.Sanitize())
+
+	if _, err := r.pool.Exec(ctx, query); err != nil {
+		return fmt.Errorf("Failed to create table %s: %w", table, err)
+	}
+	return nil
+}
+
+// SaveOrderIn is SaveOrder into a shadow table.
+func (r *PostgresRepository) SaveOrderIn(ctx context.Context, table string, order *models.Order) (bool, error) {
+	if r.shards != nil {
+		return r.shards[ShardOf(order, len(r.shards))].SaveOrderIn(ctx, table, order)
+	}
+
+	var created bool
+	err := r.breaker.Execute(ctx, func(ctx context.Context) error {
+		var err error
+		created, err = r.saveOrder(ctx, pgx.Identifier{table}.Sanitize(), order, time.Time{})
+		return err
+	})
+	return created, err
+}
+
+// saveOrder writes the order to table, if readAt is set only while the
+// stored row, if any, is still the version saved then.
+func (r *PostgresRepository) saveOrder(ctx context.Context, table string, order *models.Order, readAt time.Time) (bool, error) {
+	// an order whose date changed moves to the partition of the new date
 	query := `
-		INSERT INTO orders (
+		WITH moved AS (
+			DELETE FROM ` + table + ` WHERE order_uid = $1 AND date_created <> $13
+			RETURNING order_uid
+		)
+		INSERT INTO ` + table + ` (
 			order_uid, track_number, entry, delivery, payment, items,
 			locale, internal_signature, customer_id, delivery_service,
 			shardkey, sm_id, date_created, oof_shard
 		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
-		ON CONFLICT (order_uid) DO UPDATE SET
+		ON CONFLICT (order_uid, date_created) DO UPDATE SET
 			track_number = EXCLUDED.track_number,
 			entry = EXCLUDED.entry,
 			delivery = EXCLUDED.delivery,
@@ -100,28 +264,65 @@ func (r *PostgresRepository) SaveOrder(ctx context.Context, order *models.Order)
 			shardkey = EXCLUDED.shardkey,
 			sm_id = EXCLUDED.sm_id,
 			date_created = EXCLUDED.date_created,
-			oof_shard = EXCLUDED.oof_shard
+			oof_shard = EXCLUDED.oof_shard,
+			updated_at = now()
+		RETURNING (xmax = 0 AND NOT EXISTS (SELECT FROM moved)) AS created, updated_at
 	`
 
+	values, err := orderValues(order)
+	if err != nil {
+		return false, err
+	}
+
+	// the primary key includes date_created, so it no longer keeps two
+	// saves of a uid with different dates from both inserting a row
+	var created bool
+	err = pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(`+orderLockKey+`)`, order.OrderUID); err != nil {
+			return err
+		}
+		if !readAt.IsZero() {
+			var current time.Time
+			err := tx.QueryRow(ctx, `SELECT updated_at FROM `+table+` WHERE order_uid = $1`, order.OrderUID).Scan(&current)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return err
+			}
+			if err == nil && !current.Equal(readAt) {
+				return ErrConflict
+			}
+		}
+		return tx.QueryRow(ctx, query, values...).Scan(&created, &order.UpdatedAt)
+	})
+	if errors.Is(err, ErrConflict) {
+		return false, err
+	} else if err != nil {
+		return false, fmt.Errorf("Failed to save order: %w", err)
+	}
+
+	log.Printf("Order %s saved successfully", order.OrderUID)
+	return created, nil
+}
+
+// orderValues are the columns saveOrder writes: orderColumns without
+// updated_at.
+func orderValues(order *models.Order) ([]interface{}, error) {
 	// Converted to JSON
 	deliveryJSON, err := json.Marshal(order.Delivery)
 	if err != nil {
-		return fmt.Errorf("Failed to marshal delivery: %w", err)
+		return nil, fmt.Errorf("Failed to marshal delivery: %w", err)
 	}
 
 	paymentJSON, err := json.Marshal(order.Payment)
 	if err != nil {
-		return fmt.Errorf("Failed to marshal payment: %w", err)
+		return nil, fmt.Errorf("Failed to marshal payment: %w", err)
 	}
 
 	itemsJSON, err := json.Marshal(order.Items)
 	if err != nil {
-		return fmt.Errorf("Failed to marshal items: %w", err)
+		return nil, fmt.Errorf("Failed to marshal items: %w", err)
 	}
 
-	_, err = r.pool.Exec(
-		ctx,
-		query,
+	return []interface{}{
 		order.OrderUID,
 		order.TrackNumber,
 		order.Entry,
@@ -136,22 +337,39 @@ func (r *PostgresRepository) SaveOrder(ctx context.Context, order *models.Order)
 		order.SmID,
 		order.DateCreated,
 		order.OofShard,
-	)
+	}, nil
+}
 
-	if err != nil {
-		return fmt.Errorf("Failed to save order: %w", err)
+// GetOrder returns nil, nil for unknown orders. Orders of dropped
+// partitions are read from the archive.
+func (r *PostgresRepository) GetOrder(ctx context.Context, orderUID string) (*models.Order, error) {
+	if r.shards != nil {
+		return r.shards.getOrder(ctx, orderUID)
 	}
 
-	log.Printf("Order %s saved successfully", order.OrderUID)
-	return nil
+	var order *models.Order
+	err := r.breaker.Execute(ctx, func(ctx context.Context) error {
+		var err error
+		order, err = r.getOrder(ctx, orderUID)
+		return err
+	})
+	if order != nil || err != nil {
+		return order, err
+	}
+
+	archived, err := r.archivedOrders(ctx, []string{orderUID})
+	if err != nil || len(archived) == 0 {
+		return nil, err
+	}
+	return &archived[0], nil
 }
 
-func (r *PostgresRepository) GetOrder(ctx context.Context, OrderUID string) (*models.Order, error) {
+func (r *PostgresRepository) getOrder(ctx context.Context, OrderUID string) (*models.Order, error) {
 	query := `
 		SELECT
 			order_uid, track_number, entry, delivery, payment, items,
 			locale, internal_signature, customer_id, delivery_service,
-			shardkey, sm_id, date_created, oof_shard
+			shardkey, sm_id, date_created, oof_shard, updated_at
 		FROM orders
 		WHERE order_uid = $1
 	`
@@ -160,7 +378,7 @@ func (r *PostgresRepository) GetOrder(ctx context.Context, OrderUID string) (*mo
 	var deliveryJSON, paymentJSON, itemsJSON []byte
 	var DateCreated time.Time
 
-	err := r.pool.QueryRow(ctx, query, OrderUID).Scan(
+	err := r.reader(ctx).QueryRow(ctx, query, OrderUID).Scan(
 		&order.OrderUID,
 		&order.TrackNumber,
 		&order.Entry,
@@ -175,6 +393,7 @@ func (r *PostgresRepository) GetOrder(ctx context.Context, OrderUID string) (*mo
 		&order.SmID,
 		&DateCreated,
 		&order.OofShard,
+		&order.UpdatedAt,
 	)
 
 	if err == pgx.ErrNoRows {
@@ -202,62 +421,217 @@ func (r *PostgresRepository) GetOrder(ctx context.Context, OrderUID string) (*mo
 }
 
 func (r *PostgresRepository) GetAllOrders(ctx context.Context) ([]models.Order, error) {
+	if r.shards != nil {
+		return r.shards.getAllOrders(ctx)
+	}
+
 	query := `
 		SELECT
 			order_uid, track_number, entry, delivery, payment, items,
 			locale, internal_signature, customer_id, delivery_service,
-			shardkey, sm_id, date_created, oof_shard
+			shardkey, sm_id, date_created, oof_shard, updated_at
 		FROM orders
 	`
 
-	rows, err := r.pool.Query(ctx, query)
+	rows, err := r.reader(ctx).Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query orders: %w", err)
 	}
 	defer rows.Close()
 
+	return scanOrders(rows)
+}
+
+// OrderFilter narrows list queries. Zero values mean no restriction.
+type OrderFilter struct {
+	CustomerID      string
+	DeliveryService string
+	CreatedFrom     time.Time
+	CreatedTo       time.Time
+}
+
+// where renders the filter as SQL conditions using placeholders from $next on.
+func (f OrderFilter) where(next int) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	add := func(condition string, arg interface{}) {
+		conditions = append(conditions, fmt.Sprintf(condition, next+len(args)))
+		args = append(args, arg)
+	}
+
+	if f.CustomerID != "" {
+		add("customer_id = $%d", f.CustomerID)
+	}
+	if f.DeliveryService != "" {
+		add("delivery_service = $%d", f.DeliveryService)
+	}
+	if !f.CreatedFrom.IsZero() {
+		add("date_created >= $%d", f.CreatedFrom)
+	}
+	if !f.CreatedTo.IsZero() {
+		add("date_created < $%d", f.CreatedTo)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " AND " + strings.Join(conditions, " AND "), args
+}
+
+// ListOrders returns up to limit orders with order_uid greater than afterUID,
+// ordered by order_uid and narrowed by filter.
+func (r *PostgresRepository) ListOrders(ctx context.Context, filter OrderFilter, afterUID string, limit int) ([]models.Order, error) {
+	if r.shards != nil {
+		return r.shards.listOrders(ctx, filter, afterUID, limit)
+	}
+
+	where, args := filter.where(3)
+	query := `
+		SELECT
+			order_uid, track_number, entry, delivery, payment, items,
+			locale, internal_signature, customer_id, delivery_service,
+			shardkey, sm_id, date_created, oof_shard, updated_at
+		FROM orders
+		WHERE order_uid > $1` + where + `
+		ORDER BY order_uid
+		LIMIT $2
+	`
+
 	var orders []models.Order
+	err := r.breaker.Execute(ctx, func(ctx context.Context) error {
+		rows, err := r.reader(ctx).Query(ctx, query, append([]interface{}{afterUID, limit}, args...)...)
+		if err != nil {
+			return fmt.Errorf("failed to query orders: %w", err)
+		}
+		defer rows.Close()
 
-	for rows.Next() {
-		var order models.Order
-		var deliveryJSON, paymentJSON, itemsJSON []byte
-		var dateCreated time.Time
-
-		err := rows.Scan(
-			&order.OrderUID,
-			&order.TrackNumber,
-			&order.Entry,
-			&deliveryJSON,
-			&paymentJSON,
-			&itemsJSON,
-			&order.Locale,
-			&order.InternalSignature,
-			&order.CustomerID,
-			&order.DeliveryService,
-			&order.Shardkey,
-			&order.SmID,
-			&dateCreated,
-			&order.OofShard,
-		)
+		orders, err = scanOrders(rows)
+		return err
+	})
+
+	return orders, err
+}
+
+// ListOrderUIDs is ListOrders returning only the uids, for callers that
+// resolve the orders themselves (e.g. through the cache).
+func (r *PostgresRepository) ListOrderUIDs(ctx context.Context, filter OrderFilter, afterUID string, limit int) ([]string, error) {
+	if r.shards != nil {
+		return r.shards.listOrderUIDs(ctx, filter, afterUID, limit)
+	}
+
+	where, args := filter.where(3)
+	query := `
+		SELECT order_uid
+		FROM orders
+		WHERE order_uid > $1` + where + `
+		ORDER BY order_uid
+		LIMIT $2
+	`
+
+	var uids []string
+	err := r.breaker.Execute(ctx, func(ctx context.Context) error {
+		rows, err := r.reader(ctx).Query(ctx, query, append([]interface{}{afterUID, limit}, args...)...)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan order: %w", err)
+			return fmt.Errorf("failed to query order uids: %w", err)
 		}
 
-		order.DateCreated = dateCreated
+		uids, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return fmt.Errorf("failed to scan order uids: %w", err)
+		}
+		return nil
+	})
+
+	return uids, err
+}
+
+// SampleOrderUIDs returns up to n random order uids.
+func (r *PostgresRepository) SampleOrderUIDs(ctx context.Context, n int) ([]string, error) {
+	if r.shards != nil {
+		return r.shards.sampleOrderUIDs(ctx, n)
+	}
+
+	query := `
+		SELECT order_uid
+		FROM orders
+		ORDER BY random()
+		LIMIT $1
+	`
+
+	var uids []string
+	err := r.breaker.Execute(ctx, func(ctx context.Context) error {
+		rows, err := r.reader(ctx).Query(ctx, query, n)
+		if err != nil {
+			return fmt.Errorf("failed to sample order uids: %w", err)
+		}
 
-		// Parse JSON fields
-		if err := json.Unmarshal(deliveryJSON, &order.Delivery); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal delivery: %w", err)
+		uids, err = pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return fmt.Errorf("failed to scan order uids: %w", err)
 		}
+		return nil
+	})
+
+	return uids, err
+}
+
+// GetOrdersByUIDs loads several orders in one query, and those that were
+// archived from the archive. Missing uids are simply absent from the result.
+func (r *PostgresRepository) GetOrdersByUIDs(ctx context.Context, uids []string) ([]models.Order, error) {
+	if r.shards != nil {
+		return r.shards.getOrdersByUIDs(ctx, uids)
+	}
+
+	query := `
+		SELECT
+			order_uid, track_number, entry, delivery, payment, items,
+			locale, internal_signature, customer_id, delivery_service,
+			shardkey, sm_id, date_created, oof_shard, updated_at
+		FROM orders
+		WHERE order_uid = ANY($1)
+	`
 
-		if err := json.Unmarshal(paymentJSON, &order.Payment); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal payment: %w", err)
+	var orders []models.Order
+	err := r.breaker.Execute(ctx, func(ctx context.Context) error {
+		rows, err := r.reader(ctx).Query(ctx, query, uids)
+		if err != nil {
+			return fmt.Errorf("failed to query orders: %w", err)
 		}
+		defer rows.Close()
+
+		orders, err = scanOrders(rows)
+		return err
+	})
+	if err != nil || r.archive == nil || len(orders) == len(uids) {
+		return orders, err
+	}
 
-		if err := json.Unmarshal(itemsJSON, &order.Items); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal items: %w", err)
+	found := make(map[string]bool, len(orders))
+	for _, order := range orders {
+		found[order.OrderUID] = true
+	}
+	var missing []string
+	for _, uid := range uids {
+		if !found[uid] {
+			missing = append(missing, uid)
 		}
+	}
+	archived, err := r.archivedOrders(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	return append(orders, archived...), nil
+}
+
+func scanOrders(rows pgx.Rows) ([]models.Order, error) {
+	var orders []models.Order
 
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
 		orders = append(orders, order)
 	}
 
@@ -267,3 +641,53 @@ func (r *PostgresRepository) GetAllOrders(ctx context.Context) ([]models.Order,
 
 	return orders, nil
 }
+
+func scanOrder(rows pgx.Rows) (models.Order, error) {
+	var order models.Order
+	var deliveryJSON, paymentJSON, itemsJSON []byte
+	var dateCreated time.Time
+
+	err := rows.Scan(
+		&order.OrderUID,
+		&order.TrackNumber,
+		&order.Entry,
+		&deliveryJSON,
+		&paymentJSON,
+		&itemsJSON,
+		&order.Locale,
+		&order.InternalSignature,
+		&order.CustomerID,
+		&order.DeliveryService,
+		&order.Shardkey,
+		&order.SmID,
+		&dateCreated,
+		&order.OofShard,
+		&order.UpdatedAt,
+	)
+	if err != nil {
+		return order, fmt.Errorf("failed to scan order: %w", err)
+	}
+
+	order.DateCreated = dateCreated
+
+	if err := unmarshalOrderJSON(&order, deliveryJSON, paymentJSON, itemsJSON); err != nil {
+		return order, err
+	}
+	return order, nil
+}
+
+// unmarshalOrderJSON parses the JSONB columns of an order.
+func unmarshalOrderJSON(order *models.Order, deliveryJSON, paymentJSON, itemsJSON []byte) error {
+	if err := json.Unmarshal(deliveryJSON, &order.Delivery); err != nil {
+		return fmt.Errorf("failed to unmarshal delivery: %w", err)
+	}
+
+	if err := json.Unmarshal(paymentJSON, &order.Payment); err != nil {
+		return fmt.Errorf("failed to unmarshal payment: %w", err)
+	}
+
+	if err := json.Unmarshal(itemsJSON, &order.Items); err != nil {
+		return fmt.Errorf("failed to unmarshal items: %w", err)
+	}
+	return nil
+}
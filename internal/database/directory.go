@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// The directory, kept in shard 0, records the shard every order is stored
+// on, so that reads by uid ask that shard alone instead of all of them.
+// Saves record the shard they write to and Rebalance the one it moves an
+// order to. Orders saved before the directory existed are only recorded by
+// a rebalance, and during one an order may be gone from the shard it is
+// recorded on for a moment; so until a rebalance has run to the end, reads
+// that miss fall back to asking every shard.
+const directoryTables = `
+	CREATE TABLE IF NOT EXISTS order_shards (
+		order_uid VARCHAR(255) PRIMARY KEY,
+		shard INTEGER NOT NULL
+	);
+
+	-- a single row: whether reads must not rely on order_shards alone
+	CREATE TABLE IF NOT EXISTS order_shards_state (
+		id BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+		rebalancing BOOLEAN NOT NULL
+	);
+	INSERT INTO order_shards_state (rebalancing) VALUES (true) ON CONFLICT DO NOTHING;
+`
+
+func (r *PostgresRepository) createDirectory(ctx context.Context) error {
+	if _, err := r.pool.Exec(ctx, directoryTables); err != nil {
+		return fmt.Errorf("Failed to create the shard directory: %w", err)
+	}
+	return nil
+}
+
+// locate returns the shard each of the uids is recorded on, leaving out
+// those that are not, and whether reads must fall back to every shard. The
+// directory is read from the primary, which has the latest moves.
+func (s shardSet) locate(ctx context.Context, uids []string) (map[string]int, bool, error) {
+	dir := s[0]
+	query := `
+		SELECT s.rebalancing, d.order_uid, d.shard
+		FROM order_shards_state s
+		LEFT JOIN order_shards d ON d.order_uid = ANY($1)
+	`
+
+	located := make(map[string]int, len(uids))
+	var rebalancing bool
+	err := dir.breaker.Execute(ctx, func(ctx context.Context) error {
+		rows, err := dir.pool.Query(ctx, query, uids)
+		if err != nil {
+			return fmt.Errorf("failed to look up order shards: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var uid *string
+			var shard *int
+			if err := rows.Scan(&rebalancing, &uid, &shard); err != nil {
+				return fmt.Errorf("failed to scan order shard: %w", err)
+			}
+			// shards are only ever appended, but be safe with a shorter list
+			if uid != nil && *shard < len(s) {
+				located[*uid] = *shard
+			}
+		}
+		return rows.Err()
+	})
+	return located, rebalancing, err
+}
+
+// record notes that the orders are stored on shard. Unless replace is set,
+// orders already recorded elsewhere are left alone, for a save may have
+// moved them since they were read.
+func (s shardSet) record(ctx context.Context, shard int, replace bool, uids ...string) error {
+	if len(uids) == 0 {
+		return nil
+	}
+
+	dir := s[0]
+	query := `
+		INSERT INTO order_shards (order_uid, shard)
+		SELECT unnest($1::text[]), $2
+	`
+	if replace {
+		query += ` ON CONFLICT (order_uid) DO UPDATE SET shard = EXCLUDED.shard`
+	} else {
+		query += ` ON CONFLICT (order_uid) DO NOTHING`
+	}
+
+	err := dir.breaker.Execute(ctx, func(ctx context.Context) error {
+		_, err := dir.pool.Exec(ctx, query, uids, shard)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to record the shard of orders: %w", err)
+	}
+	return nil
+}
+
+// setRebalancing switches reads between the directory alone and falling
+// back to every shard.
+func (s shardSet) setRebalancing(ctx context.Context, rebalancing bool) error {
+	if _, err := s[0].pool.Exec(ctx, `UPDATE order_shards_state SET rebalancing = $1`, rebalancing); err != nil {
+		return fmt.Errorf("Failed to update the shard directory: %w", err)
+	}
+	return nil
+}
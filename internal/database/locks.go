@@ -0,0 +1,28 @@
+package database
+
+// Advisory locks taken by the service. Every key is the two-int form
+// (hashtext(space), hashtext(name)) Postgres computes from the names below,
+// so the same name is the same lock in every instance, and the keys stay
+// clear of one-key locks other applications of the database may take.
+// Each lock must keep a name of its own: two uses sharing a name would
+// wait for each other.
+const (
+	// lockSpace groups the locks guarding whole features
+	lockSpace = "order-service"
+
+	// reportsLock serializes refreshes of the report views
+	reportsLock = "reports"
+	// partitionsLock serializes partition maintenance and the conversion of
+	// the orders table
+	partitionsLock = "partitions"
+
+	// orderLockSpace has a lock per order, named by its uid, held while the
+	// order is saved or copied to another shard
+	orderLockSpace = "order-service.orders"
+)
+
+// lockKey is the key expression of the lock named by $1 in lockSpace.
+const lockKey = `hashtext('` + lockSpace + `'), hashtext($1)`
+
+// orderLockKey is the key expression of the lock of the order uid $1.
+const orderLockKey = `hashtext('` + orderLockSpace + `'), hashtext($1)`
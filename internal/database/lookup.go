@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// orderRef is a uid along with what lookups order by, so that the results
+// of several shards can be merged.
+type orderRef struct {
+	uid         string
+	dateCreated time.Time
+}
+
+// OrderUIDsByTrack returns the uids of the orders with the track number on
+// the order or on one of its items, newest first.
+func (r *PostgresRepository) OrderUIDsByTrack(ctx context.Context, trackNumber string, limit int) ([]string, error) {
+	if r.shards != nil {
+		return r.shards.orderUIDs(ctx, limit, func(ctx context.Context, shard *PostgresRepository) ([]orderRef, error) {
+			return shard.orderRefsByTrack(ctx, trackNumber, limit)
+		})
+	}
+	return uidsOf(r.orderRefsByTrack(ctx, trackNumber, limit))
+}
+
+func (r *PostgresRepository) orderRefsByTrack(ctx context.Context, trackNumber string, limit int) ([]orderRef, error) {
+	query := `
+		SELECT order_uid, date_created
+		FROM orders
+		WHERE track_number = $1
+			OR items @> jsonb_build_array(jsonb_build_object('track_number', $1::text))
+		ORDER BY date_created DESC, order_uid
+		LIMIT $2
+	`
+	return r.queryRefs(ctx, query, trackNumber, limit)
+}
+
+// OrderUIDsByCustomer returns the uids of the orders of a customer, newest
+// first.
+func (r *PostgresRepository) OrderUIDsByCustomer(ctx context.Context, customerID string, limit int) ([]string, error) {
+	if r.shards != nil {
+		return r.shards.orderUIDs(ctx, limit, func(ctx context.Context, shard *PostgresRepository) ([]orderRef, error) {
+			return shard.orderRefsByCustomer(ctx, customerID, limit)
+		})
+	}
+	return uidsOf(r.orderRefsByCustomer(ctx, customerID, limit))
+}
+
+func (r *PostgresRepository) orderRefsByCustomer(ctx context.Context, customerID string, limit int) ([]orderRef, error) {
+	query := `
+		SELECT order_uid, date_created
+		FROM orders
+		WHERE customer_id = $1
+		ORDER BY date_created DESC, order_uid
+		LIMIT $2
+	`
+	return r.queryRefs(ctx, query, customerID, limit)
+}
+
+func (r *PostgresRepository) queryRefs(ctx context.Context, query string, args ...interface{}) ([]orderRef, error) {
+	var refs []orderRef
+	err := r.breaker.Execute(ctx, func(ctx context.Context) error {
+		rows, err := r.reader(ctx).Query(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to query order uids: %w", err)
+		}
+		defer rows.Close()
+
+		refs = nil
+		for rows.Next() {
+			var ref orderRef
+			if err := rows.Scan(&ref.uid, &ref.dateCreated); err != nil {
+				return fmt.Errorf("failed to scan order uid: %w", err)
+			}
+			refs = append(refs, ref)
+		}
+		return rows.Err()
+	})
+
+	return refs, err
+}
+
+func uidsOf(refs []orderRef, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	uids := make([]string, len(refs))
+	for i, ref := range refs {
+		uids[i] = ref.uid
+	}
+	return uids, nil
+}
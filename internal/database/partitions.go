@@ -0,0 +1,504 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"order-service/internal/archive"
+	"order-service/internal/models"
+)
+
+// ErrMaintenanceRunning is returned when another instance is maintaining
+// the partitions.
+var ErrMaintenanceRunning = errors.New("partitions are being maintained elsewhere")
+
+// orderColumns are the stored columns of orders, without the generated ones.
+const orderColumns = `
+	order_uid, track_number, entry, delivery, payment, items,
+	locale, internal_signature, customer_id, delivery_service,
+	shardkey, sm_id, date_created, oof_shard, updated_at`
+
+// ordersTable is partitioned by the month of date_created. Orders dated in
+// a month without a partition go to orders_default until the partition is
+// created. The uid is only unique together with date_created, which is why
+// saveOrder removes the copy of an order filed under another date.
+const ordersTable = `
+	CREATE TABLE IF NOT EXISTS orders (
+		order_uid VARCHAR(255) NOT NULL,
+		track_number VARCHAR(255),
+		entry VARCHAR(255),
+		delivery JSONB NOT NULL,
+		payment JSONB NOT NULL,
+		items JSONB NOT NULL,
+		locale VARCHAR(255),
+		internal_signature VARCHAR(255),
+		customer_id VARCHAR(255),
+		delivery_service VARCHAR(255),
+		shardkey VARCHAR(255),
+		sm_id INTEGER,
+		date_created TIMESTAMP WITH TIME ZONE NOT NULL,
+		oof_shard VARCHAR(255),
+		updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+		PRIMARY KEY (order_uid, date_created)
+	) PARTITION BY RANGE (date_created);
+
+	CREATE TABLE IF NOT EXISTS orders_default PARTITION OF orders DEFAULT;
+
+	-- where the orders of dropped partitions are archived
+	CREATE TABLE IF NOT EXISTS archived_orders (
+		order_uid VARCHAR(255) PRIMARY KEY,
+		date_created TIMESTAMP WITH TIME ZONE NOT NULL,
+		file TEXT NOT NULL
+	);
+`
+
+// datedSince is the earliest plausible date_created. Orders dated before
+// it, most of them saved with a zero date, never get a partition and are
+// not archived by retention.
+const datedSince = `'2000-01-01'`
+
+var partitionPattern = regexp.MustCompile(`^orders_y(\d{4})m(\d{2})$`)
+
+// monthOf returns the first instant of the month of t in UTC.
+func monthOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func partitionName(month time.Time) string {
+	return fmt.Sprintf("orders_y%04dm%02d", month.Year(), int(month.Month()))
+}
+
+// partitionMonth parses the month back from a partition name.
+func partitionMonth(name string) (time.Time, bool) {
+	m := partitionPattern.FindStringSubmatch(name)
+	if m == nil {
+		return time.Time{}, false
+	}
+	year, _ := strconv.Atoi(m[1])
+	month, _ := strconv.Atoi(m[2])
+	if month < 1 || month > 12 {
+		return time.Time{}, false
+	}
+	return time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC), true
+}
+
+// migrateOrders converts an orders table created before partitioning: the
+// orders are copied into a partitioned table, with a partition for every
+// month that has any. The report views depend on the old table and are
+// dropped with it; createReportViews creates them again.
+func (r *PostgresRepository) migrateOrders(ctx context.Context) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(`+lockKey+`)`, partitionsLock); err != nil {
+		return fmt.Errorf("Failed to lock orders: %w", err)
+	}
+	var kind string
+	err = tx.QueryRow(ctx, `SELECT relkind::text FROM pg_class WHERE oid = to_regclass('orders')`).Scan(&kind)
+	if errors.Is(err, pgx.ErrNoRows) || kind != "r" {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Failed to check orders: %w", err)
+	}
+
+	log.Println("Converting the orders table to monthly partitions")
+	start := time.Now()
+
+	// the new table takes over the names of the old one and its indexes
+	_, err = tx.Exec(ctx, `
+		SET LOCAL statement_timeout = 0;
+		ALTER TABLE orders ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+		ALTER TABLE orders RENAME TO orders_unpartitioned;
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to rename orders: %w", err)
+	}
+	var indexes []string
+	rows, err := tx.Query(ctx, `SELECT indexrelid::regclass::text FROM pg_index WHERE indrelid = 'orders_unpartitioned'::regclass`)
+	if err == nil {
+		indexes, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to list indexes of orders: %w", err)
+	}
+	for _, index := range indexes {
+		renamed := "unpartitioned_" + index
+		if len(renamed) > 63 {
+			renamed = renamed[:63]
+		}
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`ALTER INDEX %s RENAME TO %s`, pgx.Identifier{index}.Sanitize(), pgx.Identifier{renamed}.Sanitize())); err != nil {
+			return fmt.Errorf("Failed to rename index %s: %w", index, err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, ordersTable); err != nil {
+		return fmt.Errorf("Failed to create partitioned orders: %w", err)
+	}
+
+	// zero and other implausible dates stay in the default partition
+	rows, err = tx.Query(ctx, `
+		SELECT DISTINCT date_trunc('month', date_created AT TIME ZONE 'UTC')
+		FROM orders_unpartitioned
+		WHERE date_created >= `+datedSince+`
+	`)
+	var months []time.Time
+	if err == nil {
+		months, err = pgx.CollectRows(rows, pgx.RowTo[time.Time])
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to list months of orders: %w", err)
+	}
+	for _, month := range months {
+		if _, err := createPartition(ctx, tx, monthOf(month)); err != nil {
+			return err
+		}
+	}
+
+	// orders saved without a date are filed under their last update
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO orders (`+orderColumns+`)
+		SELECT
+			order_uid, track_number, entry, delivery, payment, items,
+			locale, internal_signature, customer_id, delivery_service,
+			shardkey, sm_id, coalesce(date_created, updated_at), oof_shard, updated_at
+		FROM orders_unpartitioned
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to copy orders: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DROP TABLE orders_unpartitioned CASCADE`); err != nil {
+		return fmt.Errorf("Failed to drop the old orders table: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	log.Printf("Converted %d orders into %d partitions in %s", tag.RowsAffected(), len(months), time.Since(start))
+	return nil
+}
+
+// createPartition creates the partition of month unless it exists. Orders
+// of the month that went to the default partition meanwhile are moved into
+// it, since Postgres refuses a partition for rows held by the default one.
+func createPartition(ctx context.Context, tx pgx.Tx, month time.Time) (bool, error) {
+	name := partitionName(month)
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists); err != nil {
+		return false, fmt.Errorf("Failed to check partition %s: %w", name, err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	from, to := month, month.AddDate(0, 1, 0)
+	var stray bool
+	err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT FROM orders_default WHERE date_created >= $1 AND date_created < $2)`, from, to).Scan(&stray)
+	if err != nil {
+		return false, fmt.Errorf("Failed to check the default partition: %w", err)
+	}
+	if stray {
+		_, err := tx.Exec(ctx, `CREATE TEMP TABLE moving (LIKE orders) ON COMMIT DROP`)
+		if err == nil {
+			_, err = tx.Exec(ctx, `
+				WITH moved AS (
+					DELETE FROM orders_default WHERE date_created >= $1 AND date_created < $2
+					RETURNING `+orderColumns+`
+				)
+				INSERT INTO moving (`+orderColumns+`) SELECT * FROM moved
+			`, from, to)
+		}
+		if err != nil {
+			return false, fmt.Errorf("Failed to move orders out of the default partition: %w", err)
+		}
+	}
+
+	query := fmt.Sprintf(`CREATE TABLE %s PARTITION OF orders FOR VALUES FROM ('%s') TO ('%s')`,
+		pgx.Identifier{name}.Sanitize(), from.Format(time.RFC3339), to.Format(time.RFC3339))
+	if _, err := tx.Exec(ctx, query); err != nil {
+		return false, fmt.Errorf("Failed to create partition %s: %w", name, err)
+	}
+
+	if stray {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO orders (`+orderColumns+`) SELECT `+orderColumns+` FROM moving;
+			DROP TABLE moving;
+		`)
+		if err != nil {
+			return false, fmt.Errorf("Failed to move orders into %s: %w", name, err)
+		}
+	}
+	return true, nil
+}
+
+// Maintenance is what MaintainPartitions did.
+type Maintenance struct {
+	Created  []string // partitions
+	Archived []string // archive files
+	Orders   int      // orders moved to the archive
+}
+
+// MaintainPartitions creates the partitions of the month of now and of the
+// ahead months after it. With retention > 0 it also moves the orders dated
+// before the retention months preceding the current one to the archive:
+// old partitions are detached, written to a file each and dropped, and old
+// orders in the default partition go to one file per run.
+func (r *PostgresRepository) MaintainPartitions(ctx context.Context, now time.Time, ahead, retention int) (Maintenance, error) {
+	if r.shards != nil {
+		return r.shards.maintainPartitions(ctx, now, ahead, retention)
+	}
+
+	var done Maintenance
+	if retention > 0 && r.archive == nil {
+		return done, fmt.Errorf("retention needs an archive directory")
+	}
+
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return done, fmt.Errorf("Failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock(`+lockKey+`)`, partitionsLock).Scan(&locked); err != nil {
+		return done, fmt.Errorf("Failed to lock partitions: %w", err)
+	}
+	if !locked {
+		return done, ErrMaintenanceRunning
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock(`+lockKey+`)`, partitionsLock)
+
+	// one transaction per partition keeps the lock on orders short
+	for i := 0; i <= ahead; i++ {
+		month := monthOf(now).AddDate(0, i, 0)
+		err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			created, err := createPartition(ctx, tx, month)
+			if created {
+				done.Created = append(done.Created, partitionName(month))
+			}
+			return err
+		})
+		if err != nil {
+			return done, err
+		}
+	}
+
+	if retention <= 0 {
+		return done, nil
+	}
+	cutoff := monthOf(now).AddDate(0, -retention, 0)
+	partitions, err := listPartitions(ctx, conn)
+	if err != nil {
+		return done, err
+	}
+
+	for _, name := range partitions.attached {
+		if month, _ := partitionMonth(name); !month.Before(cutoff) {
+			continue
+		}
+		// detached, the partition no longer takes writes and can be read
+		// without blocking orders
+		query := fmt.Sprintf(`ALTER TABLE orders DETACH PARTITION %s`, pgx.Identifier{name}.Sanitize())
+		if _, err := conn.Exec(ctx, query); err != nil {
+			return done, fmt.Errorf("Failed to detach partition %s: %w", name, err)
+		}
+		partitions.detached = append(partitions.detached, name)
+	}
+	// detached ones include those left over by an interrupted run
+	for _, name := range partitions.detached {
+		n, err := r.archiveOrders(ctx, conn, name, name+archive.Extension, time.Time{})
+		if err != nil {
+			return done, err
+		}
+		done.Archived = append(done.Archived, name+archive.Extension)
+		done.Orders += n
+	}
+
+	file := fmt.Sprintf("orders_default_%s_%d%s", partitionName(cutoff)[len("orders_"):], now.Unix(), archive.Extension)
+	n, err := r.archiveOrders(ctx, conn, "orders_default", file, cutoff)
+	if err != nil {
+		return done, err
+	}
+	if n > 0 {
+		done.Archived = append(done.Archived, file)
+		done.Orders += n
+	}
+	return done, nil
+}
+
+type partitionList struct {
+	attached []string // monthly partitions of orders, oldest first
+	detached []string // monthly tables no longer attached
+}
+
+func listPartitions(ctx context.Context, q interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}) (partitionList, error) {
+	var list partitionList
+	rows, err := q.Query(ctx, `
+		SELECT c.relname::text, c.relispartition
+		FROM pg_class c
+		WHERE c.relkind = 'r'
+			AND c.relnamespace = current_schema()::regnamespace
+			AND c.relname ~ '^orders_y[0-9]{4}m[0-9]{2}$'
+		ORDER BY c.relname
+	`)
+	if err != nil {
+		return list, fmt.Errorf("Failed to list partitions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var attached bool
+		if err := rows.Scan(&name, &attached); err != nil {
+			return list, err
+		}
+		if _, ok := partitionMonth(name); !ok {
+			continue
+		}
+		if attached {
+			list.attached = append(list.attached, name)
+		} else {
+			list.detached = append(list.detached, name)
+		}
+	}
+	return list, rows.Err()
+}
+
+// archiveOrders writes the orders of table to the archive file and removes
+// them: the whole table is dropped, or with a cutoff only the orders dated
+// before it, but not before datedSince, are deleted. The file is complete on
+// disk before the orders are gone; should the transaction fail after that,
+// the next run writes the file again.
+func (r *PostgresRepository) archiveOrders(ctx context.Context, conn interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}, table, file string, cutoff time.Time) (int, error) {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	ident := pgx.Identifier{table}.Sanitize()
+	where, args := "", []interface{}{}
+	if !cutoff.IsZero() {
+		where, args = " WHERE date_created >= "+datedSince+" AND date_created < $1", []interface{}{cutoff}
+	}
+
+	// writers wait until the orders are archived, readers don't
+	_, err = tx.Exec(ctx, `SET LOCAL statement_timeout = 0; LOCK TABLE `+ident+` IN EXCLUSIVE MODE`)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to lock %s: %w", table, err)
+	}
+
+	out, err := r.archive.Create(file)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := tx.Query(ctx, `SELECT `+orderColumns+` FROM `+ident+where, args...)
+	if err != nil {
+		out.Abort()
+		return 0, fmt.Errorf("Failed to read %s: %w", table, err)
+	}
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err == nil {
+			err = out.Write(&order)
+		}
+		if err != nil {
+			rows.Close()
+			out.Abort()
+			return 0, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		out.Abort()
+		return 0, fmt.Errorf("Failed to read %s: %w", table, err)
+	}
+
+	n := out.Written()
+	if n == 0 {
+		out.Abort()
+	} else {
+		if err := out.Commit(); err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO archived_orders (order_uid, date_created, file)
+			SELECT order_uid, date_created, $`+strconv.Itoa(len(args)+1)+`::text FROM `+ident+where+`
+			ON CONFLICT (order_uid) DO UPDATE SET
+				date_created = EXCLUDED.date_created,
+				file = EXCLUDED.file
+		`, append(args, file)...)
+		if err != nil {
+			return 0, fmt.Errorf("Failed to index archived orders: %w", err)
+		}
+	}
+
+	remove := `DROP TABLE ` + ident
+	if !cutoff.IsZero() {
+		remove = `DELETE FROM ` + ident + where
+	}
+	if _, err := tx.Exec(ctx, remove, args...); err != nil {
+		return 0, fmt.Errorf("Failed to remove archived orders from %s: %w", table, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	if n > 0 {
+		log.Printf("Archived %d orders from %s to %s", n, table, file)
+	}
+	return n, nil
+}
+
+// archivedOrders reads orders that are no longer in the table from the
+// archive. Uids that were never archived are absent from the result.
+func (r *PostgresRepository) archivedOrders(ctx context.Context, uids []string) ([]models.Order, error) {
+	if r.archive == nil || len(uids) == 0 {
+		return nil, nil
+	}
+
+	files := make(map[string][]string)
+	err := r.breaker.Execute(ctx, func(ctx context.Context) error {
+		rows, err := r.reader(ctx).Query(ctx, `SELECT order_uid, file FROM archived_orders WHERE order_uid = ANY($1)`, uids)
+		if err != nil {
+			return fmt.Errorf("failed to query archived orders: %w", err)
+		}
+		defer rows.Close()
+
+		clear(files)
+		for rows.Next() {
+			var uid, file string
+			if err := rows.Scan(&uid, &file); err != nil {
+				return err
+			}
+			files[file] = append(files[file], uid)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []models.Order
+	for file, fileUIDs := range files {
+		found, err := r.archive.Find(file, fileUIDs)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, found...)
+	}
+	return orders, nil
+}
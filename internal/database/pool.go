@@ -0,0 +1,229 @@
+package database
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TLS modes. Without one the sslmode of the connection string applies.
+const (
+	TLSRequire    = "require"
+	TLSVerifyFull = "verify-full"
+)
+
+// Options configures the connection pools. Zero values keep the pgxpool
+// defaults.
+type Options struct {
+	ConnString string
+	// ReplicaConnString, if set, serves reads while the replica keeps up.
+	ReplicaConnString string
+
+	MaxConns          int
+	MinConns          int
+	MaxConnIdleTime   time.Duration
+	MaxConnLifetime   time.Duration
+	HealthCheckPeriod time.Duration
+	StatementTimeout  time.Duration
+
+	TLSMode     string
+	TLSCAFile   string
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// Reads go to the primary while the replica is more than
+	// MaxReplicaLag behind, checked every ReplicaCheckInterval.
+	MaxReplicaLag        time.Duration
+	ReplicaCheckInterval time.Duration
+
+	// ArchiveDir holds the orders of dropped partitions; they are read
+	// from there when they are no longer in the table.
+	ArchiveDir string
+
+	// ShardConnStrings, if set, are the databases orders are spread over
+	// besides ConnString, which is the first shard and the only one with a
+	// replica. The position in the list is the shard number ShardOf
+	// returns, so databases are only ever appended.
+	ShardConnStrings []string
+
+	// Migrate creates the tables, views and indexes and upgrades old ones
+	// when the repository is opened. Only the server and "orders migrate"
+	// set it, so the other commands never run DDL.
+	Migrate bool
+}
+
+// poolConfig parses connString and applies the pool settings and TLS.
+func (o Options) poolConfig(connString string) (*pgxpool.Config, error) {
+	config, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse connection string: %w", err)
+	}
+
+	if o.MaxConns > 0 {
+		config.MaxConns = int32(o.MaxConns)
+	}
+	if o.MinConns > 0 {
+		config.MinConns = int32(o.MinConns)
+	}
+	if o.MaxConnIdleTime > 0 {
+		config.MaxConnIdleTime = o.MaxConnIdleTime
+	}
+	if o.MaxConnLifetime > 0 {
+		config.MaxConnLifetime = o.MaxConnLifetime
+	}
+	if o.HealthCheckPeriod > 0 {
+		config.HealthCheckPeriod = o.HealthCheckPeriod
+	}
+	if o.StatementTimeout > 0 {
+		config.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(o.StatementTimeout.Milliseconds(), 10)
+	}
+
+	if o.TLSMode != "" {
+		tlsConfig, err := o.tlsConfig(config.ConnConfig.Host)
+		if err != nil {
+			return nil, err
+		}
+		// no plaintext fallback once TLS is configured here
+		config.ConnConfig.TLSConfig = tlsConfig
+		config.ConnConfig.Fallbacks = nil
+	}
+	return config, nil
+}
+
+func (o Options) tlsConfig(host string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: host}
+	switch o.TLSMode {
+	case TLSRequire:
+		config.InsecureSkipVerify = true
+	case TLSVerifyFull:
+	default:
+		return nil, fmt.Errorf("Unknown TLS mode %q", o.TLSMode)
+	}
+
+	if o.TLSCAFile != "" {
+		pem, err := os.ReadFile(o.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read CA file: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates in CA file %s", o.TLSCAFile)
+		}
+	}
+	if o.TLSCertFile != "" || o.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.TLSCertFile, o.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+type primaryKey struct{}
+
+// Primary makes the reads done with ctx skip the replica, for
+// read-modify-write sequences that must see their own writes.
+func Primary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// replica is a read pool with its replication lag watched in the background.
+type replica struct {
+	pool    *pgxpool.Pool
+	maxLag  time.Duration
+	healthy atomic.Bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newReplica(pool *pgxpool.Pool, maxLag, interval time.Duration) *replica {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	r := &replica{pool: pool, maxLag: maxLag, stop: make(chan struct{}), done: make(chan struct{})}
+	r.check()
+	go r.watch(interval)
+	return r
+}
+
+func (r *replica) watch(interval time.Duration) {
+	defer close(r.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.check()
+		}
+	}
+}
+
+// check measures the lag. A replica that has replayed everything it received
+// has no lag even if the primary has been idle for a while, but only while
+// it is streaming from the primary: a replica cut off from it has replayed
+// everything it received too. The receiver status needs pg_read_all_stats;
+// without it a running receiver is taken as streaming.
+func (r *replica) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT
+			pg_is_in_recovery(),
+			EXISTS (SELECT 1 FROM pg_stat_wal_receiver),
+			COALESCE((SELECT status FROM pg_stat_wal_receiver), 'streaming'),
+			CASE
+				WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+				ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+			END
+	`
+	var (
+		recovering, receiving bool
+		status                string
+		seconds               float64
+	)
+	healthy := true
+	if err := r.pool.QueryRow(ctx, query).Scan(&recovering, &receiving, &status, &seconds); err != nil {
+		log.Printf("Failed to check replica lag: %v", err)
+		healthy = false
+	} else if recovering && (!receiving || status != "streaming") {
+		log.Printf("Replica is not streaming from the primary (WAL receiver %s)", receiverState(receiving, status))
+		healthy = false
+	} else if lag := time.Duration(seconds * float64(time.Second)); lag > r.maxLag {
+		log.Printf("Replica is %s behind", lag.Round(time.Millisecond))
+		healthy = false
+	}
+
+	if r.healthy.Swap(healthy) != healthy {
+		if healthy {
+			log.Println("Reading from the replica")
+		} else {
+			log.Println("Reading from the primary until the replica catches up")
+		}
+	}
+}
+
+func receiverState(running bool, status string) string {
+	if !running {
+		return "not running"
+	}
+	return status
+}
+
+func (r *replica) close() {
+	close(r.stop)
+	<-r.done
+	r.pool.Close()
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"order-service/internal/money"
+)
+
+// ListExchangeRates loads the whole exchange rate table, which is small.
+func (r *PostgresRepository) ListExchangeRates(ctx context.Context) ([]money.Rate, error) {
+	query := `SELECT base, quote, rate::text, valid_from FROM exchange_rates`
+
+	rows, err := r.reader(ctx).Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query exchange rates: %w", err)
+	}
+	defer rows.Close()
+
+	var rates []money.Rate
+	for rows.Next() {
+		var rate money.Rate
+		var value string
+		if err := rows.Scan(&rate.Base, &rate.Quote, &value, &rate.ValidFrom); err != nil {
+			return nil, fmt.Errorf("Failed to scan exchange rate: %w", err)
+		}
+		var ok bool
+		if rate.Rate, ok = new(big.Rat).SetString(value); !ok {
+			return nil, fmt.Errorf("Invalid exchange rate %s for %s/%s", value, rate.Base, rate.Quote)
+		}
+		rates = append(rates, rate)
+	}
+	return rates, rows.Err()
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"order-service/internal/models"
+)
+
+// Rebalancing is what Rebalance did, or would do on a dry run.
+type Rebalancing struct {
+	Checked int // orders looked at
+	Moved   int // orders copied to their shard and removed from this one
+	Stale   int // copies removed because their shard had a newer one
+}
+
+// Rebalance moves the orders that are not on the shard ShardOf picks for
+// them, which after adding a shard is most of them. Orders are paged
+// through by uid on each shard, copied as they are, updated_at included,
+// recorded in the directory under their new shard and only then removed
+// from the shard they were on, so readers find them on one shard or the
+// other throughout. An order saved again during the move is left for the
+// next run. The orders that stay, archived ones included, are recorded in
+// the directory too, so once a run completes, reads rely on it alone.
+// report, if set, is called after every batch with the totals of the shard
+// so far.
+func (r *PostgresRepository) Rebalance(ctx context.Context, batch int, dryRun bool, report func(shard int, done Rebalancing)) (Rebalancing, error) {
+	var total Rebalancing
+	if r.shards == nil {
+		return total, errors.New("the database is not sharded")
+	}
+
+	if !dryRun {
+		if err := r.shards.setRebalancing(ctx, true); err != nil {
+			return total, err
+		}
+	}
+
+	// pages must not lag behind the moves
+	ctx = Primary(ctx)
+	for n, shard := range r.shards {
+		var done Rebalancing
+		after := ""
+		for {
+			orders, err := shard.ListOrders(ctx, OrderFilter{}, after, batch)
+			if err != nil {
+				return total, fmt.Errorf("Failed to list orders of shard %d after %q: %w", n, after, err)
+			}
+
+			var stay []string
+			for i := range orders {
+				order := &orders[i]
+				done.Checked++
+				home := ShardOf(order, len(r.shards))
+				if home == n {
+					stay = append(stay, order.OrderUID)
+					continue
+				}
+				if dryRun {
+					done.Moved++
+					continue
+				}
+
+				moved, err := r.shards[home].copyOrder(ctx, order)
+				if err != nil {
+					return total, fmt.Errorf("Failed to move order %s from shard %d to %d: %w", order.OrderUID, n, home, err)
+				}
+				if moved {
+					if err := r.shards.record(ctx, home, true, order.OrderUID); err != nil {
+						return total, err
+					}
+				}
+				if _, err := shard.deleteOrder(ctx, order.OrderUID, order.UpdatedAt); err != nil {
+					return total, err
+				}
+				if moved {
+					done.Moved++
+				} else {
+					done.Stale++
+				}
+			}
+
+			if !dryRun {
+				if err := r.shards.record(ctx, n, false, stay...); err != nil {
+					return total, err
+				}
+			}
+
+			if report != nil {
+				report(n, done)
+			}
+			if len(orders) < batch {
+				break
+			}
+			after = orders[len(orders)-1].OrderUID
+		}
+
+		if !dryRun {
+			if err := r.recordArchived(ctx, n, batch); err != nil {
+				return total, err
+			}
+		}
+
+		total.Checked += done.Checked
+		total.Moved += done.Moved
+		total.Stale += done.Stale
+	}
+
+	if !dryRun {
+		if err := r.shards.setRebalancing(ctx, false); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// recordArchived records the orders archived by shard n, which stay in its
+// archive, in the directory.
+func (r *PostgresRepository) recordArchived(ctx context.Context, n, batch int) error {
+	after := ""
+	for {
+		rows, err := r.shards[n].pool.Query(ctx, `
+			SELECT order_uid FROM archived_orders WHERE order_uid > $1 ORDER BY order_uid LIMIT $2
+		`, after, batch)
+		if err != nil {
+			return fmt.Errorf("Failed to list archived orders of shard %d: %w", n, err)
+		}
+		uids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return fmt.Errorf("Failed to list archived orders of shard %d: %w", n, err)
+		}
+
+		if err := r.shards.record(ctx, n, false, uids...); err != nil {
+			return err
+		}
+		if len(uids) < batch {
+			return nil
+		}
+		after = uids[len(uids)-1]
+	}
+}
+
+// copyOrder saves the order unchanged unless the table already has a copy
+// saved at the same time or later, and reports whether it did.
+func (r *PostgresRepository) copyOrder(ctx context.Context, order *models.Order) (bool, error) {
+	values, err := orderValues(order)
+	if err != nil {
+		return false, err
+	}
+
+	var copied bool
+	err = r.breaker.Execute(ctx, func(ctx context.Context) error {
+		return pgx.BeginFunc(ctx, r.pool, func(tx pgx.Tx) error {
+			// a row lock would miss a save inserting the order meanwhile,
+			// so serialize with saveOrder on the uid
+			if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(`+orderLockKey+`)`, order.OrderUID); err != nil {
+				return err
+			}
+
+			var updatedAt time.Time
+			err := tx.QueryRow(ctx, `SELECT updated_at FROM orders WHERE order_uid = $1`, order.OrderUID).Scan(&updatedAt)
+			if err == nil && !updatedAt.Before(order.UpdatedAt) {
+				copied = false
+				return nil
+			} else if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return err
+			}
+
+			// the older copy may be filed under another date
+			if _, err := tx.Exec(ctx, `DELETE FROM orders WHERE order_uid = $1`, order.OrderUID); err != nil {
+				return err
+			}
+			_, err = tx.Exec(ctx, `
+				INSERT INTO orders (`+orderColumns+`)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+			`, append(values, order.UpdatedAt)...)
+			copied = err == nil
+			return err
+		})
+	})
+	if err != nil {
+		return false, fmt.Errorf("Failed to copy order: %w", err)
+	}
+	return copied, nil
+}
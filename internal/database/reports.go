@@ -0,0 +1,438 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrReportsNotReady is returned until the report views are first refreshed.
+var ErrReportsNotReady = errors.New("reports are not ready yet")
+
+// ErrRefreshRunning is returned when another instance is refreshing the
+// report views.
+var ErrRefreshRunning = errors.New("reports are being refreshed elsewhere")
+
+// reportViews are daily aggregates over the JSONB columns, so reports don't
+// scan the orders table. Days are UTC; missing keys become empty strings so
+// that every row has a unique key.
+var reportViews = []struct{ name, query, key string }{
+	{
+		name: "report_revenue_daily",
+		query: `
+			SELECT
+				(date_created AT TIME ZONE 'UTC')::date AS day,
+				coalesce(payment->>'currency', '') AS currency,
+				coalesce(payment->>'provider', '') AS provider,
+				count(*) AS orders,
+				sum((payment->>'amount')::bigint) AS amount,
+				sum((payment->>'goods_total')::bigint) AS goods_total,
+				sum((payment->>'delivery_cost')::bigint) AS delivery_cost
+			FROM orders
+			GROUP BY 1, 2, 3`,
+		key: "day, currency, provider",
+	},
+	{
+		// canceled items (status 410) are not sales
+		name: "report_item_sales_daily",
+		query: `
+			SELECT
+				(o.date_created AT TIME ZONE 'UTC')::date AS day,
+				coalesce(i->>'brand', '') AS brand,
+				coalesce((i->>'nm_id')::bigint, 0) AS nm_id,
+				coalesce(o.payment->>'currency', '') AS currency,
+				count(*) AS items,
+				sum((i->>'total_price')::bigint) AS revenue
+			FROM orders o, jsonb_array_elements(o.items) i
+			WHERE coalesce((i->>'status')::int, 0) <> 410
+			GROUP BY 1, 2, 3, 4`,
+		key: "day, brand, nm_id, currency",
+	},
+	{
+		name: "report_delivery_daily",
+		query: `
+			SELECT
+				(date_created AT TIME ZONE 'UTC')::date AS day,
+				coalesce(delivery_service, '') AS delivery_service,
+				coalesce(delivery->>'region', '') AS region,
+				coalesce(payment->>'currency', '') AS currency,
+				count(*) AS orders,
+				sum((payment->>'delivery_cost')::bigint) AS delivery_cost
+			FROM orders
+			GROUP BY 1, 2, 3, 4`,
+		key: "day, delivery_service, region, currency",
+	},
+	{
+		name: "report_customer_daily",
+		query: `
+			SELECT
+				(date_created AT TIME ZONE 'UTC')::date AS day,
+				coalesce(customer_id, '') AS customer_id,
+				count(*) AS orders
+			FROM orders
+			GROUP BY 1, 2`,
+		key: "day, customer_id",
+	},
+}
+
+// createReportViews creates the views empty; RefreshReports fills them.
+func (r *PostgresRepository) createReportViews(ctx context.Context) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS report_refreshes (
+			id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+			refreshed_at TIMESTAMP WITH TIME ZONE NOT NULL
+		);
+	`
+	for _, view := range reportViews {
+		// the unique index lets the views be refreshed concurrently with reads
+		query += fmt.Sprintf(`
+			CREATE MATERIALIZED VIEW IF NOT EXISTS %[1]s AS %[2]s WITH NO DATA;
+			CREATE UNIQUE INDEX IF NOT EXISTS %[1]s_key ON %[1]s (%[3]s);
+		`, view.name, view.query, view.key)
+	}
+
+	if _, err := r.pool.Exec(ctx, query); err != nil {
+		return fmt.Errorf("Failed to create report views: %w", err)
+	}
+	return nil
+}
+
+// RefreshReports recomputes the report views. Only one instance refreshes at
+// a time; the others get ErrRefreshRunning.
+func (r *PostgresRepository) RefreshReports(ctx context.Context) error {
+	if r.shards != nil {
+		return r.shards.refreshReports(ctx)
+	}
+
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock(`+lockKey+`)`, reportsLock).Scan(&locked); err != nil {
+		return fmt.Errorf("Failed to lock report views: %w", err)
+	}
+	if !locked {
+		return ErrRefreshRunning
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock(`+lockKey+`)`, reportsLock)
+
+	for _, view := range reportViews {
+		var populated bool
+		if err := conn.QueryRow(ctx, `SELECT ispopulated FROM pg_matviews WHERE matviewname = $1`, view.name).Scan(&populated); err != nil {
+			return fmt.Errorf("Failed to check %s: %w", view.name, err)
+		}
+		// only a populated view can be refreshed without blocking reads
+		refresh := "REFRESH MATERIALIZED VIEW CONCURRENTLY "
+		if !populated {
+			refresh = "REFRESH MATERIALIZED VIEW "
+		}
+		if _, err := conn.Exec(ctx, refresh+view.name); err != nil {
+			return fmt.Errorf("Failed to refresh %s: %w", view.name, err)
+		}
+	}
+
+	_, err = conn.Exec(ctx, `
+		INSERT INTO report_refreshes (refreshed_at) VALUES (now())
+		ON CONFLICT (id) DO UPDATE SET refreshed_at = EXCLUDED.refreshed_at
+	`)
+	if err != nil {
+		return fmt.Errorf("Failed to record report refresh: %w", err)
+	}
+	return nil
+}
+
+// ReportsRefreshedAt returns when the report views were last refreshed, or
+// ErrReportsNotReady.
+func (r *PostgresRepository) ReportsRefreshedAt(ctx context.Context) (time.Time, error) {
+	if r.shards != nil {
+		return r.shards.reportsRefreshedAt(ctx)
+	}
+
+	var refreshedAt time.Time
+	err := r.breaker.Execute(ctx, func(ctx context.Context) error {
+		err := r.reader(ctx).QueryRow(ctx, `SELECT refreshed_at FROM report_refreshes`).Scan(&refreshedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	})
+	if err == nil && refreshedAt.IsZero() {
+		return time.Time{}, ErrReportsNotReady
+	}
+	return refreshedAt, err
+}
+
+// ReportFilter narrows reports to the days From through To (UTC, inclusive)
+// and, where amounts are reported, to one currency. Zero values mean no
+// restriction.
+type ReportFilter struct {
+	From     time.Time
+	To       time.Time
+	Currency string
+}
+
+// where renders the filter as SQL conditions using placeholders from $next
+// on. Views without a currency column pass withCurrency false.
+func (f ReportFilter) where(next int, withCurrency bool) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	add := func(condition string, arg interface{}) {
+		conditions = append(conditions, fmt.Sprintf(condition, next+len(args)))
+		args = append(args, arg)
+	}
+
+	if !f.From.IsZero() {
+		add("day >= $%d::date", f.From)
+	}
+	if !f.To.IsZero() {
+		add("day <= $%d::date", f.To)
+	}
+	if withCurrency && f.Currency != "" {
+		add("currency = $%d", f.Currency)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// RevenueRow is the revenue of one group. Day and Provider are empty unless
+// grouped by. Amounts are minor units of Currency.
+type RevenueRow struct {
+	Day          string `json:"day,omitempty"`
+	Currency     string `json:"currency"`
+	Provider     string `json:"provider,omitempty"`
+	Orders       int64  `json:"orders"`
+	Amount       int64  `json:"amount"`
+	GoodsTotal   int64  `json:"goods_total"`
+	DeliveryCost int64  `json:"delivery_cost"`
+}
+
+// Revenue sums payments by currency and optionally by day and provider.
+// Amounts of different currencies are never added up.
+func (r *PostgresRepository) Revenue(ctx context.Context, filter ReportFilter, byDay, byProvider bool) ([]RevenueRow, error) {
+	if r.shards != nil {
+		return r.shards.revenue(ctx, filter, byDay, byProvider)
+	}
+
+	day, provider := "''::text", "''::text"
+	if byDay {
+		day = "to_char(day, 'YYYY-MM-DD')"
+	}
+	if byProvider {
+		provider = "provider"
+	}
+
+	where, args := filter.where(1, true)
+	query := fmt.Sprintf(`
+		SELECT %s, currency, %s,
+			sum(orders)::bigint, sum(amount)::bigint, sum(goods_total)::bigint, sum(delivery_cost)::bigint
+		FROM report_revenue_daily%s
+		GROUP BY 1, 2, 3
+		ORDER BY 1, 2, 3
+	`, day, provider, where)
+
+	return queryReport(r, ctx, query, args, func(rows pgx.Rows) (RevenueRow, error) {
+		var row RevenueRow
+		err := rows.Scan(&row.Day, &row.Currency, &row.Provider, &row.Orders, &row.Amount, &row.GoodsTotal, &row.DeliveryCost)
+		return row, err
+	})
+}
+
+// CurrencyAmount is an amount in minor units of Currency.
+type CurrencyAmount struct {
+	Currency string `json:"currency"`
+	Amount   int64  `json:"amount"`
+}
+
+// SalesRow is a brand or a product ranked by items sold. NmID is zero in the
+// brand ranking.
+type SalesRow struct {
+	Brand   string           `json:"brand"`
+	NmID    int64            `json:"nm_id,omitempty"`
+	Items   int64            `json:"items"`
+	Revenue []CurrencyAmount `json:"revenue"`
+}
+
+// salesPart is the sales of a brand or product in one currency.
+type salesPart struct {
+	brand   string
+	nmID    int64
+	items   int64
+	revenue CurrencyAmount
+}
+
+// TopBrands ranks brands by items sold.
+func (r *PostgresRepository) TopBrands(ctx context.Context, filter ReportFilter, limit int) ([]SalesRow, error) {
+	return r.topSales(ctx, filter, limit, false)
+}
+
+// TopProducts ranks products (nm_id) by items sold.
+func (r *PostgresRepository) TopProducts(ctx context.Context, filter ReportFilter, limit int) ([]SalesRow, error) {
+	return r.topSales(ctx, filter, limit, true)
+}
+
+func (r *PostgresRepository) topSales(ctx context.Context, filter ReportFilter, limit int, byProduct bool) ([]SalesRow, error) {
+	if r.shards != nil {
+		return r.shards.topSales(ctx, filter, limit, byProduct)
+	}
+
+	nmID := "0::bigint"
+	if byProduct {
+		nmID = "nm_id"
+	}
+
+	where, args := filter.where(2, true)
+	query := fmt.Sprintf(`
+		SELECT brand, nm_id, currency, items, revenue
+		FROM (
+			SELECT *, dense_rank() OVER (ORDER BY total DESC, brand, nm_id) AS rank
+			FROM (
+				SELECT brand, %s AS nm_id, currency,
+					sum(items)::bigint AS items, sum(revenue)::bigint AS revenue,
+					sum(sum(items)) OVER (PARTITION BY brand, %s) AS total
+				FROM report_item_sales_daily%s
+				GROUP BY 1, 2, 3
+			) s
+		) ranked
+		WHERE rank <= $1
+		ORDER BY rank, currency
+	`, nmID, nmID, where)
+
+	parts, err := queryReport(r, ctx, query, append([]interface{}{limit}, args...), func(rows pgx.Rows) (salesPart, error) {
+		var part salesPart
+		err := rows.Scan(&part.brand, &part.nmID, &part.revenue.Currency, &part.items, &part.revenue.Amount)
+		return part, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// one row per currency comes back; merge them in rank order
+	var result []SalesRow
+	for _, part := range parts {
+		if n := len(result); n > 0 && result[n-1].Brand == part.brand && result[n-1].NmID == part.nmID {
+			result[n-1].Items += part.items
+			result[n-1].Revenue = append(result[n-1].Revenue, part.revenue)
+			continue
+		}
+		result = append(result, SalesRow{Brand: part.brand, NmID: part.nmID, Items: part.items, Revenue: []CurrencyAmount{part.revenue}})
+	}
+	return result, nil
+}
+
+// DeliveryRow is the delivery cost of one delivery service in one region.
+// The average is a decimal string of minor units of Currency.
+type DeliveryRow struct {
+	DeliveryService     string `json:"delivery_service"`
+	Region              string `json:"region"`
+	Currency            string `json:"currency"`
+	Orders              int64  `json:"orders"`
+	AverageDeliveryCost string `json:"average_delivery_cost"`
+
+	cost int64 // the total the average is of, for merging shards
+}
+
+// DeliveryCosts averages the delivery cost by delivery service and region.
+func (r *PostgresRepository) DeliveryCosts(ctx context.Context, filter ReportFilter) ([]DeliveryRow, error) {
+	if r.shards != nil {
+		return r.shards.deliveryCosts(ctx, filter)
+	}
+
+	where, args := filter.where(1, true)
+	query := fmt.Sprintf(`
+		SELECT delivery_service, region, currency,
+			sum(orders)::bigint, round(sum(delivery_cost)::numeric / sum(orders), 2)::text,
+			sum(delivery_cost)::bigint
+		FROM report_delivery_daily%s
+		GROUP BY 1, 2, 3
+		ORDER BY 1, 2, 3
+	`, where)
+
+	return queryReport(r, ctx, query, args, func(rows pgx.Rows) (DeliveryRow, error) {
+		var row DeliveryRow
+		err := rows.Scan(&row.DeliveryService, &row.Region, &row.Currency, &row.Orders, &row.AverageDeliveryCost, &row.cost)
+		return row, err
+	})
+}
+
+// CustomerRow is the number of orders of one customer and the days of the
+// first and last of them.
+type CustomerRow struct {
+	CustomerID string `json:"customer_id"`
+	Orders     int64  `json:"orders"`
+	FirstDay   string `json:"first_day"`
+	LastDay    string `json:"last_day"`
+}
+
+// TopCustomers ranks customers by number of orders.
+func (r *PostgresRepository) TopCustomers(ctx context.Context, filter ReportFilter, limit int) ([]CustomerRow, error) {
+	if r.shards != nil {
+		return r.shards.topCustomers(ctx, filter, limit)
+	}
+
+	where, args := filter.where(2, false)
+	query := fmt.Sprintf(`
+		SELECT customer_id, sum(orders)::bigint,
+			to_char(min(day), 'YYYY-MM-DD'), to_char(max(day), 'YYYY-MM-DD')
+		FROM report_customer_daily%s
+		GROUP BY 1
+		ORDER BY 2 DESC, 1
+		LIMIT $1
+	`, where)
+
+	return queryReport(r, ctx, query, append([]interface{}{limit}, args...), func(rows pgx.Rows) (CustomerRow, error) {
+		var row CustomerRow
+		err := rows.Scan(&row.CustomerID, &row.Orders, &row.FirstDay, &row.LastDay)
+		return row, err
+	})
+}
+
+// queryReport runs a report query through the breaker and scans every row.
+func queryReport[T any](r *PostgresRepository, ctx context.Context, query string, args []interface{}, scan func(pgx.Rows) (T, error)) ([]T, error) {
+	var result []T
+	notReady := false
+	err := r.breaker.Execute(ctx, func(ctx context.Context) error {
+		rows, err := r.reader(ctx).Query(ctx, query, args...)
+		if err == nil {
+			defer rows.Close()
+
+			result = nil
+			for rows.Next() {
+				row, err := scan(rows)
+				if err != nil {
+					return err
+				}
+				result = append(result, row)
+			}
+			err = rows.Err()
+		}
+
+		// the views can't be read before their first refresh
+		// (object_not_in_prerequisite_state), which is not a failure of the
+		// database
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "55000" {
+			notReady = true
+			return nil
+		}
+		return err
+	})
+	if notReady {
+		return nil, ErrReportsNotReady
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query report: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"order-service/internal/models"
+	"order-service/internal/search"
+)
+
+// createSearchIndexes adds the columns search runs on. Both are generated
+// from the delivery and the items, so writers don't have to keep them up to
+// date: search is the weighted full-text document (name, then e-mail, then
+// address, then item names and brands), search_text the lower-cased fields
+// with the phone reduced to digits for substring and fuzzy matches.
+func (r *PostgresRepository) createSearchIndexes(ctx context.Context) error {
+	query := `
+		CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+		ALTER TABLE orders ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('simple', coalesce(delivery->>'name', '')), 'A') ||
+			setweight(to_tsvector('simple', coalesce(delivery->>'email', '')), 'B') ||
+			setweight(to_tsvector('simple',
+				coalesce(delivery->>'address', '') || ' ' || coalesce(delivery->>'city', '') || ' ' ||
+				coalesce(delivery->>'region', '') || ' ' || coalesce(delivery->>'zip', '')), 'C') ||
+			setweight(to_tsvector('simple',
+				coalesce(jsonb_path_query_array(items, '$[*].name')::text, '') || ' ' ||
+				coalesce(jsonb_path_query_array(items, '$[*].brand')::text, '')), 'D')
+		) STORED;
+
+		ALTER TABLE orders ADD COLUMN IF NOT EXISTS search_text TEXT GENERATED ALWAYS AS (lower(
+			coalesce(delivery->>'name', '') || ' ' ||
+			coalesce(delivery->>'email', '') || ' ' ||
+			regexp_replace(coalesce(delivery->>'phone', ''), '\D', '', 'g') || ' ' ||
+			coalesce(delivery->>'address', '') || ' ' || coalesce(delivery->>'city', '') || ' ' ||
+			coalesce(delivery->>'region', '') || ' ' ||
+			coalesce(jsonb_path_query_array(items, '$[*].name')::text, '') || ' ' ||
+			coalesce(jsonb_path_query_array(items, '$[*].brand')::text, '')
+		)) STORED;
+
+		CREATE INDEX IF NOT EXISTS idx_orders_search ON orders USING GIN (search);
+		CREATE INDEX IF NOT EXISTS idx_orders_search_text ON orders USING GIN (search_text gin_trgm_ops);
+	`
+
+	if _, err := r.pool.Exec(ctx, query); err != nil {
+		return fmt.Errorf("Failed to create search indexes: %w", err)
+	}
+	return nil
+}
+
+// SearchHit is an order found by SearchOrders with its relevance.
+type SearchHit struct {
+	Order models.Order
+	Rank  float64
+}
+
+// SearchOrders finds orders whose delivery or items match q, best matches
+// first. Words are matched in full against the full-text document; the
+// normalized term is also matched as a substring, which is what finds
+// phone numbers and parts of e-mails, and by trigram word similarity, which
+// finds misspelled names.
+func (r *PostgresRepository) SearchOrders(ctx context.Context, q search.Query, limit, offset int) ([]SearchHit, error) {
+	if r.shards != nil {
+		return r.shards.searchOrders(ctx, q, limit, offset)
+	}
+
+	var conditions []string
+	args := []interface{}{q.Text, q.Term, limit, offset}
+	if q.Text != "" {
+		conditions = append(conditions, "search @@ websearch_to_tsquery('simple', $1)")
+	}
+	// shorter terms can't use the trigram index
+	if len([]rune(q.Term)) >= search.MinTermLength {
+		conditions = append(conditions, "search_text LIKE $5")
+		args = append(args, "%"+escapeLike(q.Term)+"%")
+		// a phone number that is only similar is someone else's
+		if !q.Phone {
+			conditions = append(conditions, "$2 <% search_text")
+		}
+	}
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT
+			order_uid, track_number, entry, delivery, payment, items,
+			locale, internal_signature, customer_id, delivery_service,
+			shardkey, sm_id, date_created, oof_shard, updated_at,
+			ts_rank(search, websearch_to_tsquery('simple', $1)) + word_similarity($2, search_text) AS rank
+		FROM orders
+		WHERE ` + strings.Join(conditions, " OR ") + `
+		ORDER BY rank DESC, date_created DESC, order_uid
+		LIMIT $3 OFFSET $4
+	`
+
+	var hits []SearchHit
+	err := r.breaker.Execute(ctx, func(ctx context.Context) error {
+		rows, err := r.reader(ctx).Query(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to search orders: %w", err)
+		}
+		defer rows.Close()
+
+		hits = nil
+		for rows.Next() {
+			var hit SearchHit
+			var deliveryJSON, paymentJSON, itemsJSON []byte
+			err := rows.Scan(
+				&hit.Order.OrderUID,
+				&hit.Order.TrackNumber,
+				&hit.Order.Entry,
+				&deliveryJSON,
+				&paymentJSON,
+				&itemsJSON,
+				&hit.Order.Locale,
+				&hit.Order.InternalSignature,
+				&hit.Order.CustomerID,
+				&hit.Order.DeliveryService,
+				&hit.Order.Shardkey,
+				&hit.Order.SmID,
+				&hit.Order.DateCreated,
+				&hit.Order.OofShard,
+				&hit.Order.UpdatedAt,
+				&hit.Rank,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to scan order: %w", err)
+			}
+			if err := unmarshalOrderJSON(&hit.Order, deliveryJSON, paymentJSON, itemsJSON); err != nil {
+				return err
+			}
+			hits = append(hits, hit)
+		}
+		return rows.Err()
+	})
+
+	return hits, err
+}
+
+// escapeLike makes s match itself in a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
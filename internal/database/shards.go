@@ -0,0 +1,587 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"order-service/internal/models"
+	"order-service/internal/search"
+)
+
+// ShardOf is the number of the shard among n that the order belongs to.
+// Numeric shard keys, which is what producers send, are taken modulo n so
+// that their placement is easy to follow; other keys are hashed, and orders
+// without a shard key go by their uid.
+func ShardOf(order *models.Order, n int) int {
+	if n <= 1 {
+		return 0
+	}
+	if key, err := strconv.ParseUint(order.Shardkey, 10, 64); err == nil {
+		return int(key % uint64(n))
+	}
+
+	key := order.Shardkey
+	if key == "" {
+		key = order.OrderUID
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+// shardSet is the databases of a sharded repository. An order is saved to
+// the shard ShardOf picks for it. Reads by uid don't know the shard key and
+// find the shard in the directory (see directory.go); while it is being
+// rebalanced, orders missing there are looked up on every shard, and when
+// more than one shard has a copy, the most recently saved one wins. Lists,
+// searches and reports are merged from every shard.
+type shardSet []*PostgresRepository
+
+// openShards connects the databases of opts.ShardConnStrings; r becomes
+// the first of the shards. Each shard archives into a directory of its own
+// since partitions have the same names everywhere.
+func (r *PostgresRepository) openShards(ctx context.Context, opts Options) error {
+	first := *r
+	r.shards = shardSet{&first}
+
+	for _, connString := range opts.ShardConnStrings {
+		if connString == "" {
+			continue
+		}
+		n := len(r.shards)
+		archiveDir := ""
+		if opts.ArchiveDir != "" {
+			archiveDir = filepath.Join(opts.ArchiveDir, shardDir(n))
+		}
+		shard, err := openRepository(ctx, opts, connString, archiveDir, r.breaker)
+		if err != nil {
+			return fmt.Errorf("Failed to open shard %d: %w", n, err)
+		}
+		r.shards = append(r.shards, shard)
+	}
+
+	if opts.Migrate {
+		return r.shards[0].createDirectory(ctx)
+	}
+	return nil
+}
+
+// shardDir is where shard n keeps its archive under the archive directory,
+// and the prefix of its partitions and files in maintenance reports.
+func shardDir(n int) string {
+	return fmt.Sprintf("shard%d", n)
+}
+
+// Shards is the number of databases orders are spread over.
+func (r *PostgresRepository) Shards() int {
+	return max(len(r.shards), 1)
+}
+
+// fanOut calls fn on every shard at once and returns the results in shard
+// order. The first error cancels the other calls.
+func fanOut[T any](ctx context.Context, shards shardSet, fn func(ctx context.Context, shard *PostgresRepository) (T, error)) ([]T, error) {
+	results := make([]T, len(shards))
+	g, ctx := errgroup.WithContext(ctx)
+	for i, shard := range shards {
+		g.Go(func() error {
+			var err error
+			results[i], err = fn(ctx, shard)
+			return err
+		})
+	}
+	return results, g.Wait()
+}
+
+// each calls fn on the shards one after another. A shard that returns busy
+// is being taken care of by another instance and is skipped; busy is only
+// returned when every shard was.
+func (s shardSet) each(busy error, fn func(n int, shard *PostgresRepository) error) error {
+	skipped := 0
+	for n, shard := range s {
+		err := fn(n, shard)
+		if errors.Is(err, busy) {
+			skipped++
+			continue
+		} else if err != nil {
+			return fmt.Errorf("shard %d: %w", n, err)
+		}
+	}
+	if skipped == len(s) {
+		return busy
+	}
+	return nil
+}
+
+// newest keeps the most recently saved copy of every order.
+func newest(orders []models.Order) []models.Order {
+	seen := make(map[string]int, len(orders))
+	result := orders[:0]
+	for _, order := range orders {
+		if i, ok := seen[order.OrderUID]; ok {
+			if order.UpdatedAt.After(result[i].UpdatedAt) {
+				result[i] = order
+			}
+			continue
+		}
+		seen[order.OrderUID] = len(result)
+		result = append(result, order)
+	}
+	return result
+}
+
+func (s shardSet) saveOrder(ctx context.Context, order *models.Order, readAt time.Time) (bool, error) {
+	n := ShardOf(order, len(s))
+	home := s[n]
+	created, err := home.save(ctx, order, readAt)
+	if err != nil {
+		return created, err
+	}
+	// recorded before the copies elsewhere go, so readers never miss it
+	if err := s.record(ctx, n, true, order.OrderUID); err != nil || !created {
+		return created, err
+	}
+
+	// an order new to its shard can still be on the one it was saved to
+	// before its shard key or the shards changed
+	deleted, err := fanOut(ctx, s, func(ctx context.Context, shard *PostgresRepository) (bool, error) {
+		if shard == home {
+			return false, nil
+		}
+		return shard.deleteOrder(ctx, order.OrderUID, time.Time{})
+	})
+	if err != nil {
+		return created, err
+	}
+	return !slices.Contains(deleted, true), nil
+}
+
+// deleteOrder removes an order from its table, only if it was last saved at
+// updatedAt unless that is zero, and reports whether there was one.
+func (r *PostgresRepository) deleteOrder(ctx context.Context, orderUID string, updatedAt time.Time) (bool, error) {
+	query := `DELETE FROM orders WHERE order_uid = $1`
+	args := []interface{}{orderUID}
+	if !updatedAt.IsZero() {
+		query += ` AND updated_at = $2`
+		args = append(args, updatedAt)
+	}
+
+	var deleted bool
+	err := r.breaker.Execute(ctx, func(ctx context.Context) error {
+		tag, err := r.pool.Exec(ctx, query, args...)
+		deleted = tag.RowsAffected() > 0
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("Failed to delete order %s: %w", orderUID, err)
+	}
+	return deleted, nil
+}
+
+func (s shardSet) getOrder(ctx context.Context, orderUID string) (*models.Order, error) {
+	located, rebalancing, err := s.locate(ctx, []string{orderUID})
+	if err != nil {
+		return nil, err
+	}
+	if n, ok := located[orderUID]; ok {
+		order, err := s[n].GetOrder(ctx, orderUID)
+		if order != nil || err != nil || !rebalancing {
+			return order, err
+		}
+	} else if !rebalancing {
+		return nil, nil
+	}
+	return s.findOrder(ctx, orderUID)
+}
+
+// findOrder looks the order up on every shard.
+func (s shardSet) findOrder(ctx context.Context, orderUID string) (*models.Order, error) {
+	copies, err := fanOut(ctx, s, func(ctx context.Context, shard *PostgresRepository) (*models.Order, error) {
+		return shard.GetOrder(ctx, orderUID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var order *models.Order
+	for _, c := range copies {
+		if c != nil && (order == nil || c.UpdatedAt.After(order.UpdatedAt)) {
+			order = c
+		}
+	}
+	return order, nil
+}
+
+func (s shardSet) getOrdersByUIDs(ctx context.Context, uids []string) ([]models.Order, error) {
+	located, rebalancing, err := s.locate(ctx, uids)
+	if err != nil {
+		return nil, err
+	}
+
+	byShard := make([][]string, len(s))
+	for _, uid := range uids {
+		if n, ok := located[uid]; ok {
+			byShard[n] = append(byShard[n], uid)
+		}
+	}
+	found := make([][]models.Order, len(s))
+	g, gctx := errgroup.WithContext(ctx)
+	for n, shardUIDs := range byShard {
+		if len(shardUIDs) == 0 {
+			continue
+		}
+		g.Go(func() error {
+			var err error
+			found[n], err = s[n].GetOrdersByUIDs(gctx, shardUIDs)
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	orders := slices.Concat(found...)
+	if !rebalancing || len(orders) == len(uids) {
+		return orders, nil
+	}
+
+	seen := make(map[string]bool, len(orders))
+	for _, order := range orders {
+		seen[order.OrderUID] = true
+	}
+	var missing []string
+	for _, uid := range uids {
+		if !seen[uid] {
+			missing = append(missing, uid)
+		}
+	}
+	rest, err := s.findOrders(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	return append(orders, rest...), nil
+}
+
+// findOrders looks the orders up on every shard.
+func (s shardSet) findOrders(ctx context.Context, uids []string) ([]models.Order, error) {
+	found, err := fanOut(ctx, s, func(ctx context.Context, shard *PostgresRepository) ([]models.Order, error) {
+		return shard.GetOrdersByUIDs(ctx, uids)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newest(slices.Concat(found...)), nil
+}
+
+func (s shardSet) getAllOrders(ctx context.Context) ([]models.Order, error) {
+	all, err := fanOut(ctx, s, func(ctx context.Context, shard *PostgresRepository) ([]models.Order, error) {
+		return shard.GetAllOrders(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newest(slices.Concat(all...)), nil
+}
+
+// listOrders merges the pages of every shard: the first limit uids after
+// afterUID are all among the first limit of the shards they are on.
+func (s shardSet) listOrders(ctx context.Context, filter OrderFilter, afterUID string, limit int) ([]models.Order, error) {
+	pages, err := fanOut(ctx, s, func(ctx context.Context, shard *PostgresRepository) ([]models.Order, error) {
+		return shard.ListOrders(ctx, filter, afterUID, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	orders := newest(slices.Concat(pages...))
+	slices.SortFunc(orders, func(a, b models.Order) int { return cmp.Compare(a.OrderUID, b.OrderUID) })
+	return orders[:min(len(orders), limit)], nil
+}
+
+func (s shardSet) listOrderUIDs(ctx context.Context, filter OrderFilter, afterUID string, limit int) ([]string, error) {
+	pages, err := fanOut(ctx, s, func(ctx context.Context, shard *PostgresRepository) ([]string, error) {
+		return shard.ListOrderUIDs(ctx, filter, afterUID, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	uids := slices.Concat(pages...)
+	slices.Sort(uids)
+	uids = slices.Compact(uids)
+	return uids[:min(len(uids), limit)], nil
+}
+
+func (s shardSet) sampleOrderUIDs(ctx context.Context, n int) ([]string, error) {
+	samples, err := fanOut(ctx, s, func(ctx context.Context, shard *PostgresRepository) ([]string, error) {
+		return shard.SampleOrderUIDs(ctx, n)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	uids := slices.Concat(samples...)
+	slices.Sort(uids)
+	uids = slices.Compact(uids)
+	rand.Shuffle(len(uids), func(i, j int) { uids[i], uids[j] = uids[j], uids[i] })
+	return uids[:min(len(uids), n)], nil
+}
+
+// orderUIDs merges lookups that return the newest orders first.
+func (s shardSet) orderUIDs(ctx context.Context, limit int, lookup func(ctx context.Context, shard *PostgresRepository) ([]orderRef, error)) ([]string, error) {
+	found, err := fanOut(ctx, s, lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := slices.Concat(found...)
+	slices.SortFunc(refs, func(a, b orderRef) int {
+		return cmp.Or(b.dateCreated.Compare(a.dateCreated), cmp.Compare(a.uid, b.uid))
+	})
+
+	var uids []string
+	seen := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		if len(uids) == limit {
+			break
+		}
+		if !seen[ref.uid] {
+			seen[ref.uid] = true
+			uids = append(uids, ref.uid)
+		}
+	}
+	return uids, nil
+}
+
+// searchOrders asks every shard for the first offset+limit hits and takes
+// the page out of the merged ranking.
+func (s shardSet) searchOrders(ctx context.Context, q search.Query, limit, offset int) ([]SearchHit, error) {
+	found, err := fanOut(ctx, s, func(ctx context.Context, shard *PostgresRepository) ([]SearchHit, error) {
+		return shard.SearchOrders(ctx, q, offset+limit, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hits := slices.Concat(found...)
+	slices.SortFunc(hits, func(a, b SearchHit) int {
+		return cmp.Or(cmp.Compare(b.Rank, a.Rank), b.Order.DateCreated.Compare(a.Order.DateCreated), cmp.Compare(a.Order.OrderUID, b.Order.OrderUID))
+	})
+
+	// a copy left behind on another shard is a hit of its own
+	seen := make(map[string]bool, len(hits))
+	hits = slices.DeleteFunc(hits, func(hit SearchHit) bool {
+		duplicate := seen[hit.Order.OrderUID]
+		seen[hit.Order.OrderUID] = true
+		return duplicate
+	})
+	if offset >= len(hits) {
+		return nil, nil
+	}
+	return hits[offset:min(len(hits), offset+limit)], nil
+}
+
+func (s shardSet) createShadowTable(ctx context.Context, table string) error {
+	_, err := fanOut(ctx, s, func(ctx context.Context, shard *PostgresRepository) (struct{}, error) {
+		return struct{}{}, shard.CreateShadowTable(ctx, table)
+	})
+	return err
+}
+
+func (s shardSet) maintainPartitions(ctx context.Context, now time.Time, ahead, retention int) (Maintenance, error) {
+	var done Maintenance
+	err := s.each(ErrMaintenanceRunning, func(n int, shard *PostgresRepository) error {
+		shardDone, err := shard.MaintainPartitions(ctx, now, ahead, retention)
+		prefix := ""
+		if n > 0 {
+			prefix = shardDir(n) + "/"
+		}
+		for _, name := range shardDone.Created {
+			done.Created = append(done.Created, prefix+name)
+		}
+		for _, file := range shardDone.Archived {
+			done.Archived = append(done.Archived, prefix+file)
+		}
+		done.Orders += shardDone.Orders
+		return err
+	})
+	return done, err
+}
+
+func (s shardSet) refreshReports(ctx context.Context) error {
+	return s.each(ErrRefreshRunning, func(n int, shard *PostgresRepository) error {
+		return shard.RefreshReports(ctx)
+	})
+}
+
+// reportsRefreshedAt is the oldest refresh of the shards.
+func (s shardSet) reportsRefreshedAt(ctx context.Context) (time.Time, error) {
+	times, err := fanOut(ctx, s, func(ctx context.Context, shard *PostgresRepository) (time.Time, error) {
+		return shard.ReportsRefreshedAt(ctx)
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return slices.MinFunc(times, time.Time.Compare), nil
+}
+
+func (s shardSet) revenue(ctx context.Context, filter ReportFilter, byDay, byProvider bool) ([]RevenueRow, error) {
+	found, err := fanOut(ctx, s, func(ctx context.Context, shard *PostgresRepository) ([]RevenueRow, error) {
+		return shard.Revenue(ctx, filter, byDay, byProvider)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct{ day, currency, provider string }
+	var rows []RevenueRow
+	index := make(map[key]int)
+	for _, row := range slices.Concat(found...) {
+		k := key{row.Day, row.Currency, row.Provider}
+		i, ok := index[k]
+		if !ok {
+			index[k] = len(rows)
+			rows = append(rows, row)
+			continue
+		}
+		rows[i].Orders += row.Orders
+		rows[i].Amount += row.Amount
+		rows[i].GoodsTotal += row.GoodsTotal
+		rows[i].DeliveryCost += row.DeliveryCost
+	}
+
+	slices.SortFunc(rows, func(a, b RevenueRow) int {
+		return cmp.Or(cmp.Compare(a.Day, b.Day), cmp.Compare(a.Currency, b.Currency), cmp.Compare(a.Provider, b.Provider))
+	})
+	return rows, nil
+}
+
+// topSales ranks the complete rankings of the shards: a brand can be far
+// down on each shard and still lead overall.
+func (s shardSet) topSales(ctx context.Context, filter ReportFilter, limit int, byProduct bool) ([]SalesRow, error) {
+	found, err := fanOut(ctx, s, func(ctx context.Context, shard *PostgresRepository) ([]SalesRow, error) {
+		return shard.topSales(ctx, filter, math.MaxInt32, byProduct)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		brand string
+		nmID  int64
+	}
+	var rows []SalesRow
+	index := make(map[key]int)
+	for _, row := range slices.Concat(found...) {
+		k := key{row.Brand, row.NmID}
+		i, ok := index[k]
+		if !ok {
+			index[k] = len(rows)
+			row.Revenue = slices.Clone(row.Revenue)
+			rows = append(rows, row)
+			continue
+		}
+		rows[i].Items += row.Items
+		for _, amount := range row.Revenue {
+			j := slices.IndexFunc(rows[i].Revenue, func(a CurrencyAmount) bool { return a.Currency == amount.Currency })
+			if j < 0 {
+				rows[i].Revenue = append(rows[i].Revenue, amount)
+			} else {
+				rows[i].Revenue[j].Amount += amount.Amount
+			}
+		}
+	}
+
+	for _, row := range rows {
+		slices.SortFunc(row.Revenue, func(a, b CurrencyAmount) int { return cmp.Compare(a.Currency, b.Currency) })
+	}
+	slices.SortFunc(rows, func(a, b SalesRow) int {
+		return cmp.Or(cmp.Compare(b.Items, a.Items), cmp.Compare(a.Brand, b.Brand), cmp.Compare(a.NmID, b.NmID))
+	})
+	return rows[:min(len(rows), limit)], nil
+}
+
+func (s shardSet) deliveryCosts(ctx context.Context, filter ReportFilter) ([]DeliveryRow, error) {
+	found, err := fanOut(ctx, s, func(ctx context.Context, shard *PostgresRepository) ([]DeliveryRow, error) {
+		return shard.DeliveryCosts(ctx, filter)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct{ service, region, currency string }
+	var rows []DeliveryRow
+	index := make(map[key]int)
+	for _, row := range slices.Concat(found...) {
+		k := key{row.DeliveryService, row.Region, row.Currency}
+		i, ok := index[k]
+		if !ok {
+			index[k] = len(rows)
+			rows = append(rows, row)
+			continue
+		}
+		rows[i].Orders += row.Orders
+		rows[i].cost += row.cost
+	}
+
+	for i := range rows {
+		rows[i].AverageDeliveryCost = average(rows[i].cost, rows[i].Orders)
+	}
+	slices.SortFunc(rows, func(a, b DeliveryRow) int {
+		return cmp.Or(cmp.Compare(a.DeliveryService, b.DeliveryService), cmp.Compare(a.Region, b.Region), cmp.Compare(a.Currency, b.Currency))
+	})
+	return rows, nil
+}
+
+// average is sum/n rounded to two decimals the way Postgres rounds numeric,
+// half away from zero.
+func average(sum, n int64) string {
+	cents := (200*sum + n) / (2 * n)
+	if sum < 0 {
+		cents = (200*sum - n) / (2 * n)
+	}
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// topCustomers, like topSales, ranks the complete rankings of the shards:
+// the orders of a customer are spread over them.
+func (s shardSet) topCustomers(ctx context.Context, filter ReportFilter, limit int) ([]CustomerRow, error) {
+	found, err := fanOut(ctx, s, func(ctx context.Context, shard *PostgresRepository) ([]CustomerRow, error) {
+		return shard.TopCustomers(ctx, filter, math.MaxInt32)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []CustomerRow
+	index := make(map[string]int)
+	for _, row := range slices.Concat(found...) {
+		i, ok := index[row.CustomerID]
+		if !ok {
+			index[row.CustomerID] = len(rows)
+			rows = append(rows, row)
+			continue
+		}
+		rows[i].Orders += row.Orders
+		rows[i].FirstDay = min(rows[i].FirstDay, row.FirstDay)
+		rows[i].LastDay = max(rows[i].LastDay, row.LastDay)
+	}
+
+	slices.SortFunc(rows, func(a, b CustomerRow) int {
+		return cmp.Or(cmp.Compare(b.Orders, a.Orders), cmp.Compare(a.CustomerID, b.CustomerID))
+	})
+	return rows[:min(len(rows), limit)], nil
+}
@@ -0,0 +1,39 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/hamba/avro/v2"
+)
+
+// avroDecoder reads Avro binary with the writer schema of the message's
+// version. Framed payloads are in the Confluent wire format: a zero byte
+// and a four-byte schema id in front, which name the schema themselves.
+// Whether a payload is framed is up to its content type, since plain Avro
+// can start with a zero byte as well.
+type avroDecoder struct {
+	schemas *LocalSchemas
+	framed  bool
+}
+
+func (d *avroDecoder) Decode(data []byte, version int) (Document, int, error) {
+	if d.framed {
+		if len(data) < 5 || data[0] != 0 {
+			return nil, 0, fmt.Errorf("payload is not in the Confluent wire format")
+		}
+		version = int(binary.BigEndian.Uint32(data[1:5]))
+		data = data[5:]
+	}
+
+	schema, ok := d.schemas.Schema(version)
+	if !ok {
+		return nil, 0, fmt.Errorf("no Avro schema for version %d", version)
+	}
+
+	var doc Document
+	if err := avro.Unmarshal(schema, data, &doc); err != nil {
+		return nil, 0, err
+	}
+	return doc, version, nil
+}
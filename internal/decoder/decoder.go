@@ -0,0 +1,155 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strconv"
+
+	"order-service/internal/models"
+)
+
+// CurrentVersion is the schema version whose layout is models.Order.
+const CurrentVersion = 2
+
+// Content types of the decoders registered by NewRegistry.
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeAvro     = "application/avro"
+	ContentTypeProtobuf = "application/x-protobuf"
+
+	// ContentTypeAvroConfluent is Avro in the Confluent wire format, with
+	// the schema id in front of the data.
+	ContentTypeAvroConfluent = "application/vnd.confluent.avro"
+)
+
+// Message headers that select the decoder and the schema version.
+const (
+	HeaderContentType   = "content-type"
+	HeaderSchemaVersion = "schema-version"
+)
+
+// Document is a decoded message before it is turned into an order: the
+// JSON object model, which upcasters edit in place.
+type Document = map[string]any
+
+// Decoder turns a payload into a document. It reports the schema version of
+// the document's layout, which is usually the version it was asked for.
+type Decoder interface {
+	Decode(data []byte, version int) (Document, int, error)
+}
+
+// Upcaster rewrites a document from one schema version to the next.
+type Upcaster func(doc Document) error
+
+// Registry picks the decoder by content type and upcasts older versions, so
+// every format and version ends up in models.ParseOrder.
+type Registry struct {
+	decoders  map[string]Decoder
+	aliases   map[string]string
+	upcasters map[int]Upcaster // by the version they upgrade from
+}
+
+// NewRegistry creates a registry with the JSON, Avro and protobuf decoders
+// and the upcasters of every older version. Avro writer schemas come from
+// schemas.
+func NewRegistry(schemas *LocalSchemas) *Registry {
+	r := &Registry{
+		decoders:  make(map[string]Decoder),
+		aliases:   make(map[string]string),
+		upcasters: make(map[int]Upcaster),
+	}
+
+	r.Register(ContentTypeJSON, jsonDecoder{})
+	r.Register(ContentTypeAvro, &avroDecoder{schemas: schemas}, "avro/binary", "application/vnd.apache.avro+binary")
+	r.Register(ContentTypeAvroConfluent, &avroDecoder{schemas: schemas, framed: true})
+	r.Register(ContentTypeProtobuf, protobufDecoder{}, "application/protobuf", "application/vnd.google.protobuf")
+
+	r.RegisterUpcaster(1, upcastV1)
+	return r
+}
+
+// Register adds a decoder under a content type and its aliases.
+func (r *Registry) Register(contentType string, d Decoder, aliases ...string) {
+	r.decoders[contentType] = d
+	for _, alias := range aliases {
+		r.aliases[alias] = contentType
+	}
+}
+
+// RegisterUpcaster adds the step from version from to from+1.
+func (r *Registry) RegisterUpcaster(from int, u Upcaster) {
+	r.upcasters[from] = u
+}
+
+// Decode turns a message into a validated order. An empty content type
+// means JSON and an empty version the current one, which is what producers
+// sent before the headers existed.
+func (r *Registry) Decode(contentType, schemaVersion string, data []byte) (*models.Order, error) {
+	version := CurrentVersion
+	if schemaVersion != "" {
+		v, err := strconv.Atoi(schemaVersion)
+		if err != nil || v < 1 || v > CurrentVersion {
+			return nil, fmt.Errorf("unsupported schema version %q", schemaVersion)
+		}
+		version = v
+	}
+
+	name := ContentTypeJSON
+	if contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid content type %q: %v", contentType, err)
+		}
+		name = mediaType
+		if canonical, ok := r.aliases[name]; ok {
+			name = canonical
+		}
+	}
+
+	// the common case needs no detour through a document
+	if name == ContentTypeJSON && version == CurrentVersion {
+		return models.ParseOrder(data)
+	}
+
+	d, ok := r.decoders[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	doc, version, err := d.Decode(data, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s order: %v", name, err)
+	}
+
+	for ; version < CurrentVersion; version++ {
+		upcast, ok := r.upcasters[version]
+		if !ok {
+			return nil, fmt.Errorf("no upcaster from schema version %d", version)
+		}
+		if err := upcast(doc); err != nil {
+			return nil, fmt.Errorf("failed to upcast order from schema version %d: %v", version, err)
+		}
+	}
+
+	current, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode upcast order: %v", err)
+	}
+	return models.ParseOrder(current)
+}
+
+type jsonDecoder struct{}
+
+func (jsonDecoder) Decode(data []byte, version int) (Document, int, error) {
+	// numbers stay exact on the way through the document
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var doc Document
+	if err := dec.Decode(&doc); err != nil {
+		return nil, 0, err
+	}
+	return doc, version, nil
+}
@@ -0,0 +1,250 @@
+package decoder
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"order-service/internal/models"
+	"order-service/internal/pb"
+
+	"github.com/hamba/avro/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRegistryDecode(t *testing.T) {
+	schemas := loadSchemas(t)
+	registry := NewRegistry(schemas)
+	want := testOrder()
+
+	current, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := json.Marshal(legacyDoc(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	avroCurrent := encodeAvro(t, schemas, CurrentVersion, want)
+	avroLegacy := encodeAvro(t, schemas, 1, legacyDoc(want))
+	protobuf, err := proto.Marshal(pb.FromModel(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		contentType   string
+		schemaVersion string
+		data          []byte
+		err           string // part of the error, if one is expected
+	}{
+		{name: "no headers", data: current},
+		{name: "json with parameters", contentType: "application/json; charset=utf-8", schemaVersion: "2", data: current},
+		{name: "json v1", contentType: ContentTypeJSON, schemaVersion: "1", data: legacy},
+		{name: "avro", contentType: ContentTypeAvro, data: avroCurrent},
+		{name: "avro alias v1", contentType: "avro/binary", schemaVersion: "1", data: avroLegacy},
+		{name: "confluent", contentType: ContentTypeAvroConfluent, data: frame(1, avroLegacy)},
+		{name: "confluent schema id wins", contentType: ContentTypeAvroConfluent, schemaVersion: "2", data: frame(1, avroLegacy)},
+		{name: "protobuf", contentType: "application/protobuf", schemaVersion: "1", data: protobuf},
+
+		{name: "unknown content type", contentType: "text/xml", data: current, err: "unsupported content type"},
+		{name: "invalid content type", contentType: "json;;", data: current, err: "invalid content type"},
+		{name: "future version", schemaVersion: "3", data: current, err: "unsupported schema version"},
+		{name: "version zero", schemaVersion: "0", data: current, err: "unsupported schema version"},
+		{name: "plain avro as confluent", contentType: ContentTypeAvroConfluent, data: avroCurrent, err: "Confluent wire format"},
+		{name: "unknown schema id", contentType: ContentTypeAvroConfluent, data: frame(7, avroCurrent), err: "no Avro schema for version 7"},
+		{name: "truncated avro", contentType: ContentTypeAvro, data: avroCurrent[:10], err: "failed to decode"},
+		{name: "invalid json", contentType: ContentTypeJSON, schemaVersion: "1", data: []byte("{"), err: "failed to decode"},
+		{name: "unknown currency", data: []byte(strings.Replace(string(current), `"USD"`, `"XYZ"`, 1)), err: "unknown currency"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := registry.Decode(tt.contentType, tt.schemaVersion, tt.data)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error is %v, want one about %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertSameOrder(t, order, want)
+		})
+	}
+}
+
+// Plain Avro of an order with an empty uid starts with a zero byte, which
+// must not be taken for the Confluent framing.
+func TestAvroDecodesPlainPayloadStartingWithZero(t *testing.T) {
+	schemas := loadSchemas(t)
+	order := testOrder()
+	order.OrderUID = ""
+
+	data := encodeAvro(t, schemas, CurrentVersion, order)
+	if data[0] != 0 {
+		t.Fatalf("payload starts with 0x%02x", data[0])
+	}
+
+	doc, version, err := (&avroDecoder{schemas: schemas}).Decode(data, CurrentVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != CurrentVersion || doc["order_uid"] != "" || doc["track_number"] != order.TrackNumber {
+		t.Errorf("decoded version %d, order_uid %q, track_number %q", version, doc["order_uid"], doc["track_number"])
+	}
+}
+
+func loadSchemas(t *testing.T) *LocalSchemas {
+	t.Helper()
+
+	schemas, err := NewLocalSchemas("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schemas
+}
+
+// encodeAvro writes v with the schema of version, matching fields by their
+// JSON names like producers of both layouts do.
+func encodeAvro(t *testing.T, schemas *LocalSchemas, version int, v any) []byte {
+	t.Helper()
+
+	schema, ok := schemas.Schema(version)
+	if !ok {
+		t.Fatalf("no schema for version %d", version)
+	}
+	data, err := avro.Config{TagKey: "json"}.Freeze().Marshal(schema, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// frame puts data in the Confluent wire format.
+func frame(schemaID uint32, data []byte) []byte {
+	framed := []byte{0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(framed[1:], schemaID)
+	return append(framed, data...)
+}
+
+// legacyDoc is the order in the layout of schema version 1.
+func legacyDoc(order *models.Order) Document {
+	items := make([]any, len(order.Items))
+	for i, item := range order.Items {
+		items[i] = map[string]any{
+			"chrt_id":      int64(item.ChrtID),
+			"track_number": item.TrackNumber,
+			"price":        int64(item.Price),
+			"rid":          item.Rid,
+			"name":         item.Name,
+			"sale":         int64(item.Sale),
+			"size":         item.Size,
+			"total":        int64(item.TotalPrice),
+			"nm_id":        int64(item.NmID),
+			"brand":        item.Brand,
+			"status":       int64(item.Status),
+		}
+	}
+
+	return Document{
+		"order_uid": order.OrderUID,
+		"track":     order.TrackNumber,
+		"entry":     order.Entry,
+		"delivery": map[string]any{
+			"name":     order.Delivery.Name,
+			"phone":    order.Delivery.Phone,
+			"zip_code": order.Delivery.Zip,
+			"city":     order.Delivery.City,
+			"address":  order.Delivery.Address,
+			"region":   order.Delivery.Region,
+			"email":    order.Delivery.Email,
+		},
+		"payment": map[string]any{
+			"transaction_id": order.Payment.Transaction,
+			"request_id":     order.Payment.RequestID,
+			"currency":       order.Payment.Currency,
+			"provider":       order.Payment.Provider,
+			"amount":         int64(order.Payment.Amount),
+			"payment_dt":     order.Payment.PaymentDt,
+			"bank":           order.Payment.Bank,
+			"delivery_cost":  int64(order.Payment.DeliveryCost),
+			"goods_total":    int64(order.Payment.GoodsTotal),
+			"custom_fee":     int64(order.Payment.CustomFee),
+		},
+		"items":              items,
+		"locale":             order.Locale,
+		"internal_signature": order.InternalSignature,
+		"customer_id":        order.CustomerID,
+		"delivery_service":   order.DeliveryService,
+		"shardkey":           order.Shardkey,
+		"sm_id":              int64(order.SmID),
+		"date_created":       order.DateCreated.Unix(),
+		"oof_shard":          order.OofShard,
+	}
+}
+
+// assertSameOrder compares the orders with times in UTC, since formats
+// differ in the location they decode times in.
+func assertSameOrder(t *testing.T, got, want *models.Order) {
+	t.Helper()
+
+	g, w := *got, *want
+	g.DateCreated, w.DateCreated = g.DateCreated.UTC(), w.DateCreated.UTC()
+	g.UpdatedAt, w.UpdatedAt = time.Time{}, time.Time{}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("decoded order differs:\n got %+v\nwant %+v", g, w)
+	}
+}
+
+func testOrder() *models.Order {
+	return &models.Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			Name:    "Test Testov",
+			Phone:   "+9720000000",
+			Zip:     "2639809",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Region:  "Kraiot",
+			Email:   "test@gmail.com",
+		},
+		Payment: models.Payment{
+			Transaction:  "b563feb7b2b84b6test",
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       1817,
+			PaymentDt:    1637907727,
+			Bank:         "alpha",
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+		},
+		Items: []models.Item{{
+			ChrtID:      9934930,
+			TrackNumber: "WBILMTESTTRACK",
+			Price:       453,
+			Rid:         "ab4219087a764ae0btest",
+			Name:        "Mascaras",
+			Sale:        30,
+			Size:        "0",
+			TotalPrice:  317,
+			NmID:        2389212,
+			Brand:       "Vivienne Sabo",
+			Status:      202,
+		}},
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		Shardkey:        "9",
+		SmID:            99,
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		OofShard:        "1",
+	}
+}
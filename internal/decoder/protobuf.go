@@ -0,0 +1,27 @@
+package decoder
+
+import (
+	"encoding/json"
+
+	"order-service/internal/pb"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// protobufDecoder reads the order.v1.Order message. Field numbers never
+// change, so payloads of every schema version decode into the current
+// layout and need no upcasting.
+type protobufDecoder struct{}
+
+func (protobufDecoder) Decode(data []byte, version int) (Document, int, error) {
+	var msg pb.Order
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		return nil, 0, err
+	}
+
+	current, err := json.Marshal(pb.ToModel(&msg))
+	if err != nil {
+		return nil, 0, err
+	}
+	return jsonDecoder{}.Decode(current, CurrentVersion)
+}
@@ -0,0 +1,74 @@
+package decoder
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/hamba/avro/v2"
+)
+
+//go:embed schemas/*.avsc
+var embeddedSchemas embed.FS
+
+var schemaFile = regexp.MustCompile(`^order\.v(\d+)\.avsc$`)
+
+// LocalSchemas stands in for a schema registry: the Avro writer schema of
+// every order version, read from files named order.v<N>.avsc. The schema id
+// of a version is the version number itself.
+type LocalSchemas struct {
+	byVersion map[int]avro.Schema
+}
+
+// NewLocalSchemas loads the schemas from dir, or the built-in ones when dir
+// is empty.
+func NewLocalSchemas(dir string) (*LocalSchemas, error) {
+	var files fs.FS
+	if dir == "" {
+		sub, err := fs.Sub(embeddedSchemas, "schemas")
+		if err != nil {
+			return nil, err
+		}
+		files = sub
+	} else {
+		files = os.DirFS(dir)
+	}
+
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list schemas: %w", err)
+	}
+
+	s := &LocalSchemas{byVersion: make(map[int]avro.Schema)}
+	for _, entry := range entries {
+		m := schemaFile.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(m[1])
+
+		data, err := fs.ReadFile(files, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read schema %s: %w", entry.Name(), err)
+		}
+		schema, err := avro.ParseBytes(data)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse schema %s: %w", entry.Name(), err)
+		}
+		s.byVersion[version] = schema
+	}
+
+	if _, ok := s.byVersion[CurrentVersion]; !ok {
+		return nil, fmt.Errorf("no schema for the current version %d", CurrentVersion)
+	}
+	return s, nil
+}
+
+// Schema returns the writer schema of a version.
+func (s *LocalSchemas) Schema(version int) (avro.Schema, bool) {
+	schema, ok := s.byVersion[version]
+	return schema, ok
+}
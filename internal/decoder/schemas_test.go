@@ -0,0 +1,74 @@
+package decoder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewLocalSchemas(t *testing.T) {
+	v1, err := embeddedSchemas.ReadFile("schemas/order.v1.avsc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := embeddedSchemas.ReadFile("schemas/order.v2.avsc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		files    map[string][]byte // nil for the embedded schemas
+		versions []int
+		err      string
+	}{
+		{name: "embedded", versions: []int{1, 2}},
+		{
+			name:     "directory",
+			files:    map[string][]byte{"order.v2.avsc": v2, "README.md": []byte("not a schema"), "order.v2.avsc.bak": []byte("{")},
+			versions: []int{2},
+		},
+		{name: "no current version", files: map[string][]byte{"order.v1.avsc": v1}, err: "no schema for the current version"},
+		{name: "invalid schema", files: map[string][]byte{"order.v1.avsc": []byte("{"), "order.v2.avsc": v2}, err: "Failed to parse schema order.v1.avsc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := ""
+			if tt.files != nil {
+				dir = t.TempDir()
+				for name, data := range tt.files {
+					if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			schemas, err := NewLocalSchemas(dir)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error is %v, want one about %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, version := range tt.versions {
+				if _, ok := schemas.Schema(version); !ok {
+					t.Errorf("no schema for version %d", version)
+				}
+			}
+			if len(schemas.byVersion) != len(tt.versions) {
+				t.Errorf("loaded %d schemas, want %d", len(schemas.byVersion), len(tt.versions))
+			}
+		})
+	}
+}
+
+func TestNewLocalSchemasMissingDir(t *testing.T) {
+	if _, err := NewLocalSchemas(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("loaded schemas from a missing directory")
+	}
+}
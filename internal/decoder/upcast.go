@@ -0,0 +1,61 @@
+package decoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// upcastV1 brings the legacy partner layout to version 2: four fields were
+// renamed and date_created went from unix seconds to an RFC 3339 string.
+func upcastV1(doc Document) error {
+	rename(doc, "track", "track_number")
+
+	if delivery, ok := doc["delivery"].(map[string]any); ok {
+		rename(delivery, "zip_code", "zip")
+	}
+	if payment, ok := doc["payment"].(map[string]any); ok {
+		rename(payment, "transaction_id", "transaction")
+	}
+	if items, ok := doc["items"].([]any); ok {
+		for _, item := range items {
+			if item, ok := item.(map[string]any); ok {
+				rename(item, "total", "total_price")
+			}
+		}
+	}
+
+	if created, ok := doc["date_created"]; ok {
+		seconds, err := toInt64(created)
+		if err != nil {
+			return fmt.Errorf("date_created: %v", err)
+		}
+		doc["date_created"] = time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+	}
+	return nil
+}
+
+func rename(doc map[string]any, from, to string) {
+	if value, ok := doc[from]; ok {
+		doc[to] = value
+		delete(doc, from)
+	}
+}
+
+// toInt64 accepts the integer types the decoders produce.
+func toInt64(value any) (int64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.Int64()
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case float64:
+		return int64(v), nil
+	default:
+		return 0, fmt.Errorf("expected a number, got %T", value)
+	}
+}
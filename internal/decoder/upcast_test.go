@@ -0,0 +1,82 @@
+package decoder
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestUpcastV1(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     Document
+		want    Document
+		wantErr bool
+	}{
+		{
+			name: "renamed fields",
+			doc: Document{
+				"order_uid": "uid",
+				"track":     "TRACK",
+				"delivery":  map[string]any{"zip_code": "123"},
+				"payment":   map[string]any{"transaction_id": "tx"},
+				"items":     []any{map[string]any{"total": int64(317)}, map[string]any{"total": int64(5)}},
+			},
+			want: Document{
+				"order_uid":    "uid",
+				"track_number": "TRACK",
+				"delivery":     map[string]any{"zip": "123"},
+				"payment":      map[string]any{"transaction": "tx"},
+				"items":        []any{map[string]any{"total_price": int64(317)}, map[string]any{"total_price": int64(5)}},
+			},
+		},
+		{
+			name: "missing nested objects",
+			doc:  Document{"order_uid": "uid", "delivery": nil},
+			want: Document{"order_uid": "uid", "delivery": nil},
+		},
+		{
+			name: "date from json",
+			doc:  Document{"date_created": json.Number("1637907739")},
+			want: Document{"date_created": "2021-11-26T06:22:19Z"},
+		},
+		{
+			name: "date from avro",
+			doc:  Document{"date_created": int64(1637907739)},
+			want: Document{"date_created": "2021-11-26T06:22:19Z"},
+		},
+		{
+			name: "date as float",
+			doc:  Document{"date_created": float64(0)},
+			want: Document{"date_created": "1970-01-01T00:00:00Z"},
+		},
+		{
+			name:    "date as string",
+			doc:     Document{"date_created": "2021-11-26T06:22:19Z"},
+			wantErr: true,
+		},
+		{
+			name:    "fractional json date",
+			doc:     Document{"date_created": json.Number("1.5")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := upcastV1(tt.doc)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("upcast %v without an error", tt.doc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tt.doc, tt.want) {
+				t.Errorf("got %v, want %v", tt.doc, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"order-service/internal/models"
+)
+
+// Event types.
+const (
+	TypeCreated = "created"
+	TypeUpdated = "updated"
+)
+
+// eventsChannel is the pub/sub channel shared by all replicas.
+const eventsChannel = "orders:events"
+
+// OrderEvent is published every time the consumer persists an order.
+// ID doubles as the resume token a client sends after reconnecting.
+type OrderEvent struct {
+	ID        string        `json:"id"`
+	Type      string        `json:"type"`
+	Order     *models.Order `json:"order"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// Matches reports whether the event passes the optional filters.
+func (e OrderEvent) Matches(customerID string, orderUID string) bool {
+	if customerID != "" && e.Order.CustomerID != customerID {
+		return false
+	}
+	if orderUID != "" && e.Order.OrderUID != orderUID {
+		return false
+	}
+	return true
+}
+
+// Relay carries events between replicas. cache.Cache implements it on top
+// of Redis pub/sub.
+type Relay interface {
+	Publish(ctx context.Context, channel string, payload []byte) error
+	Subscribe(ctx context.Context, channel string, fn func(payload []byte))
+}
+
+// Broker fans order events out to subscribers and keeps the most recent
+// ones so reconnecting clients can resume. With a relay every event goes
+// through it, so all replicas see the same events in the same order.
+// Slow subscribers lose events instead of blocking the consumer.
+type Broker struct {
+	relay   Relay
+	history int
+
+	mu     sync.RWMutex
+	recent []OrderEvent
+	subs   map[int]chan OrderEvent
+	nextID int
+
+	lastID atomic.Int64
+}
+
+func NewBroker(history int, relay Relay) *Broker {
+	return &Broker{
+		relay:   relay,
+		history: history,
+		subs:    make(map[int]chan OrderEvent),
+	}
+}
+
+// Run receives events from other replicas until ctx is done.
+func (b *Broker) Run(ctx context.Context) {
+	if b.relay == nil {
+		return
+	}
+
+	b.relay.Subscribe(ctx, eventsChannel, func(payload []byte) {
+		var event OrderEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			log.Printf("Failed to unmarshal order event: %v", err)
+			return
+		}
+		b.dispatch(event)
+	})
+}
+
+func (b *Broker) Publish(ctx context.Context, eventType string, order *models.Order) {
+	event := OrderEvent{
+		ID:        b.newID(),
+		Type:      eventType,
+		Order:     order,
+		UpdatedAt: order.UpdatedAt,
+	}
+	if event.UpdatedAt.IsZero() {
+		event.UpdatedAt = time.Now()
+	}
+
+	if b.relay == nil {
+		b.dispatch(event)
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to marshal order event: %v", err)
+		return
+	}
+
+	if err := b.relay.Publish(ctx, eventsChannel, payload); err != nil {
+		log.Printf("Failed to relay order event, delivering locally: %v", err)
+		b.dispatch(event)
+	}
+}
+
+// Subscribe returns a channel of events and a function that cancels the subscription.
+func (b *Broker) Subscribe(buffer int) (<-chan OrderEvent, func()) {
+	_, ch, cancel := b.SubscribeFrom("", buffer)
+	return ch, cancel
+}
+
+// SubscribeFrom also returns the remembered events that came after the
+// resume token lastID. An empty token means no backlog.
+func (b *Broker) SubscribeFrom(lastID string, buffer int) ([]OrderEvent, <-chan OrderEvent, func()) {
+	ch := make(chan OrderEvent, buffer)
+
+	b.mu.Lock()
+	backlog := b.eventsAfter(lastID)
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = ch
+	b.mu.Unlock()
+
+	var once sync.Once
+	return backlog, ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// eventsAfter returns remembered events that arrived after the one with
+// the given id. If that event has already been forgotten, events are
+// compared by id instead. Must be called with b.mu held.
+func (b *Broker) eventsAfter(lastID string) []OrderEvent {
+	if lastID == "" {
+		return nil
+	}
+
+	for i, event := range b.recent {
+		if event.ID == lastID {
+			return append([]OrderEvent(nil), b.recent[i+1:]...)
+		}
+	}
+
+	after, err := strconv.ParseInt(lastID, 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	var backlog []OrderEvent
+	for _, event := range b.recent {
+		if id, _ := strconv.ParseInt(event.ID, 10, 64); id > after {
+			backlog = append(backlog, event)
+		}
+	}
+	return backlog
+}
+
+func (b *Broker) dispatch(event OrderEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.history > 0 {
+		b.recent = append(b.recent, event)
+		if len(b.recent) > b.history {
+			b.recent = b.recent[len(b.recent)-b.history:]
+		}
+	}
+
+	for _, ch := range b.subs {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Subscriber is too slow, dropping event for order %s", event.Order.OrderUID)
+		}
+	}
+}
+
+// newID returns a time-based id that never goes backwards on this replica.
+func (b *Broker) newID() string {
+	for {
+		last := b.lastID.Load()
+		next := time.Now().UnixNano()
+		if next <= last {
+			next = last + 1
+		}
+		if b.lastID.CompareAndSwap(last, next) {
+			return strconv.FormatInt(next, 10)
+		}
+	}
+}
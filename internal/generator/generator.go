@@ -0,0 +1,327 @@
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"order-service/internal/models"
+)
+
+// Kinds of generated records.
+const (
+	KindNew       = "new"
+	KindDuplicate = "duplicate"
+	KindUpdate    = "update"
+	KindInvalid   = "invalid"
+)
+
+// historySize bounds how many orders are kept for duplicates and updates.
+const historySize = 10000
+
+type Options struct {
+	Seed uint64
+	// Zipf exponent (> 1) for picking customers and the orders to resend;
+	// lower values mean uniform
+	Skew      float64
+	Customers int
+	// percentages of the records
+	Duplicates float64
+	Updates    float64
+	Invalid    float64
+	// orders are created within Period before Now
+	Now    time.Time
+	Period time.Duration
+}
+
+// Record is one generated message. Order is nil for invalid payloads.
+type Record struct {
+	Kind    string
+	Key     string
+	Order   *models.Order
+	Payload []byte
+}
+
+// Generator produces random, internally consistent orders: item totals
+// follow price and sale, payment totals follow the items, and currency,
+// bank, phone and cities match the locale. The same seed gives the same
+// sequence.
+type Generator struct {
+	opts      Options
+	rnd       *rand.Rand
+	customers picker
+
+	history []*models.Order
+	orders  picker
+}
+
+// picker chooses an index below n, uniformly or Zipf-distributed.
+type picker func(n int) int
+
+func New(opts Options) *Generator {
+	if opts.Customers <= 0 {
+		opts.Customers = 1000
+	}
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	if opts.Period <= 0 {
+		opts.Period = 90 * 24 * time.Hour
+	}
+
+	rnd := rand.New(rand.NewPCG(opts.Seed, opts.Seed^0x9e3779b97f4a7c15))
+	return &Generator{
+		opts:      opts,
+		rnd:       rnd,
+		customers: newPicker(rnd, opts.Skew, opts.Customers),
+		orders:    newPicker(rnd, opts.Skew, historySize),
+	}
+}
+
+func newPicker(rnd *rand.Rand, skew float64, max int) picker {
+	if skew <= 1 {
+		return func(n int) int { return rnd.IntN(n) }
+	}
+
+	zipf := rand.NewZipf(rnd, skew, 1, uint64(max-1))
+	return func(n int) int {
+		// the hottest keys are the oldest ones, so they stay hot
+		for {
+			if i := int(zipf.Uint64()); i < n {
+				return i
+			}
+		}
+	}
+}
+
+// Next returns the next record.
+func (g *Generator) Next() Record {
+	roll := g.rnd.Float64() * 100
+
+	switch {
+	case roll < g.opts.Invalid:
+		return g.invalid()
+	case len(g.history) == 0:
+		// nothing to resend yet
+	case roll < g.opts.Invalid+g.opts.Duplicates:
+		order := g.history[g.orders(len(g.history))]
+		return record(KindDuplicate, order)
+	case roll < g.opts.Invalid+g.opts.Duplicates+g.opts.Updates:
+		i := g.orders(len(g.history))
+		order := g.update(g.history[i])
+		g.history[i] = order
+		return record(KindUpdate, order)
+	}
+
+	order := g.order()
+	if len(g.history) < historySize {
+		g.history = append(g.history, order)
+	} else {
+		g.history[g.rnd.IntN(historySize)] = order
+	}
+	return record(KindNew, order)
+}
+
+func record(kind string, order *models.Order) Record {
+	payload, _ := json.Marshal(order)
+	return Record{Kind: kind, Key: order.OrderUID, Order: order, Payload: payload}
+}
+
+type locale struct {
+	code       string
+	currency   string
+	priceScale int // brings prices in minor units to about the same value in every currency
+	phone      string
+	banks      []string
+	cities     [][2]string // city, region
+	names      []string
+}
+
+var locales = []locale{
+	{
+		code: "en", currency: "USD", priceScale: 1, phone: "+1",
+		banks:  []string{"chase", "citi", "wellsfargo"},
+		cities: [][2]string{{"New York", "NY"}, {"Austin", "TX"}, {"Seattle", "WA"}, {"Denver", "CO"}},
+		names:  []string{"John Smith", "Emily Johnson", "Michael Brown", "Sarah Davis", "David Wilson"},
+	},
+	{
+		code: "ru", currency: "RUB", priceScale: 90, phone: "+7",
+		banks:  []string{"sber", "alpha", "tinkoff", "vtb"},
+		cities: [][2]string{{"Moscow", "Moscow"}, {"Kazan", "Tatarstan"}, {"Novosibirsk", "Novosibirsk Oblast"}, {"Saint Petersburg", "Saint Petersburg"}},
+		names:  []string{"Ivan Petrov", "Anna Smirnova", "Sergey Ivanov", "Olga Kuznetsova", "Dmitry Popov"},
+	},
+	{
+		code: "kk", currency: "KZT", priceScale: 450, phone: "+7",
+		banks:  []string{"kaspi", "halyk", "jusan"},
+		cities: [][2]string{{"Almaty", "Almaty"}, {"Astana", "Astana"}, {"Shymkent", "Turkistan"}},
+		names:  []string{"Nursultan Abenov", "Aigerim Sarsenova", "Yerlan Tokayev", "Dana Zhakupova"},
+	},
+	{
+		code: "de", currency: "EUR", priceScale: 1, phone: "+49",
+		banks:  []string{"deutsche", "commerzbank", "sparkasse"},
+		cities: [][2]string{{"Berlin", "Berlin"}, {"Munich", "Bavaria"}, {"Hamburg", "Hamburg"}},
+		names:  []string{"Lukas Muller", "Anna Schmidt", "Felix Weber", "Lea Fischer"},
+	},
+	{
+		code: "he", currency: "ILS", priceScale: 4, phone: "+972",
+		banks:  []string{"leumi", "hapoalim", "discount"},
+		cities: [][2]string{{"Kiryat Mozkin", "Kraiot"}, {"Haifa", "Haifa"}, {"Tel Aviv", "Tel Aviv"}},
+		names:  []string{"Noam Levi", "Tamar Cohen", "Yosef Mizrahi", "Maya Peretz"},
+	},
+}
+
+var (
+	providers        = []string{"wbpay", "applepay", "googlepay", "sbp", "card"}
+	deliveryServices = []string{"meest", "cdek", "boxberry", "dhl", "dpd", "pickpoint"}
+	brands           = []string{"Vivienne Sabo", "Nike", "Adidas", "Xiaomi", "Samsung", "Lego", "Zara", "Levi's"}
+	products         = []string{"Mascaras", "Sneakers", "Hoodie", "Phone case", "Headphones", "Construction set", "Jeans", "Backpack"}
+	sizes            = []string{"0", "XS", "S", "M", "L", "XL", "42", "44"}
+	itemStatuses     = []int{202, 200, 201, 203}
+)
+
+func (g *Generator) pick(list []string) string {
+	return list[g.rnd.IntN(len(list))]
+}
+
+func (g *Generator) hex(n int) string {
+	var sb strings.Builder
+	for sb.Len() < n {
+		fmt.Fprintf(&sb, "%016x", g.rnd.Uint64())
+	}
+	return sb.String()[:n]
+}
+
+func (g *Generator) order() *models.Order {
+	loc := locales[g.rnd.IntN(len(locales))]
+	uid := g.hex(19)
+	track := "WBIL" + strings.ToUpper(g.hex(10))
+	created := g.opts.Now.Add(-time.Duration(g.rnd.Int64N(int64(g.opts.Period)))).Truncate(time.Second).UTC()
+
+	name := g.pick(loc.names)
+	place := loc.cities[g.rnd.IntN(len(loc.cities))]
+
+	items := make([]models.Item, 1+g.rnd.IntN(5))
+	for i := range items {
+		items[i] = g.item(track, loc)
+	}
+
+	order := &models.Order{
+		OrderUID:    uid,
+		TrackNumber: track,
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			Name:    name,
+			Phone:   fmt.Sprintf("%s%010d", loc.phone, g.rnd.Int64N(1e10)),
+			Zip:     fmt.Sprintf("%06d", g.rnd.IntN(1e6)),
+			City:    place[0],
+			Address: fmt.Sprintf("%s %d", g.pick([]string{"Main St", "Lenina", "Abay Ave", "Hauptstrasse", "Herzl"}), 1+g.rnd.IntN(200)),
+			Region:  place[1],
+			Email:   strings.ToLower(strings.ReplaceAll(name, " ", ".")) + fmt.Sprintf("%d@example.com", g.rnd.IntN(1000)),
+		},
+		Payment: models.Payment{
+			Transaction:  uid,
+			Currency:     loc.currency,
+			Provider:     g.pick(providers),
+			PaymentDt:    created.Unix(),
+			Bank:         g.pick(loc.banks),
+			DeliveryCost: (5 + g.rnd.IntN(20)) * 100 * loc.priceScale / 10,
+		},
+		Items:           items,
+		Locale:          loc.code,
+		CustomerID:      fmt.Sprintf("customer-%d", g.customers(g.opts.Customers)),
+		DeliveryService: g.pick(deliveryServices),
+		Shardkey:        fmt.Sprint(g.rnd.IntN(10)),
+		SmID:            1 + g.rnd.IntN(100),
+		DateCreated:     created,
+		OofShard:        fmt.Sprint(1 + g.rnd.IntN(2)),
+	}
+	if g.rnd.IntN(10) == 0 {
+		order.Payment.CustomFee = (1 + g.rnd.IntN(5)) * 10 * loc.priceScale
+	}
+
+	recalculate(order)
+	return order
+}
+
+func (g *Generator) item(track string, loc locale) models.Item {
+	price := (50 + g.rnd.IntN(2000)) * loc.priceScale
+	sale := 0
+	if g.rnd.IntN(2) == 0 {
+		sale = 5 * g.rnd.IntN(11)
+	}
+
+	return models.Item{
+		ChrtID:      1000000 + g.rnd.IntN(9000000),
+		TrackNumber: track,
+		Price:       price,
+		Rid:         g.hex(20),
+		Name:        g.pick(products),
+		Sale:        sale,
+		Size:        g.pick(sizes),
+		TotalPrice:  price * (100 - sale) / 100,
+		NmID:        1000000 + g.rnd.IntN(9000000),
+		Brand:       g.pick(brands),
+		Status:      itemStatuses[0],
+	}
+}
+
+// update changes what a real order changes after creation: item statuses,
+// the delivery address, sometimes the contents. Totals stay consistent.
+func (g *Generator) update(old *models.Order) *models.Order {
+	order := *old
+	order.Items = append([]models.Item(nil), old.Items...)
+
+	for i := range order.Items {
+		order.Items[i].Status = itemStatuses[g.rnd.IntN(len(itemStatuses))]
+	}
+
+	switch g.rnd.IntN(3) {
+	case 0:
+		order.Delivery.Address = fmt.Sprintf("%s, apt %d", old.Delivery.Address, 1+g.rnd.IntN(300))
+	case 1:
+		if len(order.Items) > 1 {
+			order.Items = order.Items[:len(order.Items)-1]
+		}
+	case 2:
+		for _, loc := range locales {
+			if loc.code == order.Locale {
+				order.Items = append(order.Items, g.item(order.TrackNumber, loc))
+				break
+			}
+		}
+	}
+
+	recalculate(&order)
+	return &order
+}
+
+func recalculate(order *models.Order) {
+	goods := 0
+	for _, item := range order.Items {
+		goods += item.TotalPrice
+	}
+	order.Payment.GoodsTotal = goods
+	order.Payment.Amount = goods + order.Payment.DeliveryCost + order.Payment.CustomFee
+}
+
+// invalid returns a payload the consumer must reject.
+func (g *Generator) invalid() Record {
+	order := g.order()
+	payload, _ := json.Marshal(order)
+
+	switch g.rnd.IntN(3) {
+	case 0:
+		// truncated JSON
+		payload = payload[:g.rnd.IntN(len(payload))]
+	case 1:
+		order.OrderUID = ""
+		payload, _ = json.Marshal(order)
+	case 2:
+		// a number where a string is expected
+		payload = []byte(strings.Replace(string(payload), `"track_number":"`+order.TrackNumber+`"`, `"track_number":42`, 1))
+	}
+
+	return Record{Kind: KindInvalid, Key: order.OrderUID, Payload: payload}
+}
@@ -0,0 +1,82 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"order-service/internal/service"
+
+	"github.com/graphql-go/graphql"
+)
+
+// Handler serves GraphQL queries over HTTP (POST with a JSON body, or GET
+// with query/variables parameters).
+type Handler struct {
+	orders *service.Orders
+	schema graphql.Schema
+}
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+func NewHandler(orders *service.Orders) (*Handler, error) {
+	h := &Handler{orders: orders}
+
+	schema, err := newSchema(h)
+	if err != nil {
+		return nil, err
+	}
+	h.schema = schema
+
+	return h, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				http.Error(w, "Invalid variables", http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if req.Query == "" {
+		http.Error(w, "Query is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), loaderKey{}, newOrderLoader(r.Context(), h.orders))
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		OperationName:  req.OperationName,
+		VariableValues: req.Variables,
+		Context:        ctx,
+	})
+
+	if result.HasErrors() {
+		log.Printf("GraphQL query finished with errors: %v", result.Errors)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
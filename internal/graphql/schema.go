@@ -0,0 +1,200 @@
+package graphql
+
+import (
+	"fmt"
+	"time"
+
+	"order-service/internal/database"
+	"order-service/internal/models"
+
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type loaderKey struct{}
+
+// page is the value behind the OrderPage type.
+type page struct {
+	uids       []string
+	nextCursor string
+}
+
+// field builds a field resolved from the parent value of type T.
+func field[T any](typ graphql.Output, get func(T) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: typ,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			v, ok := p.Source.(T)
+			if !ok {
+				return nil, fmt.Errorf("unexpected source %T", p.Source)
+			}
+			return get(v), nil
+		},
+	}
+}
+
+var deliveryType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Delivery",
+	Fields: graphql.Fields{
+		"name":    field(graphql.String, func(d models.Delivery) interface{} { return d.Name }),
+		"phone":   field(graphql.String, func(d models.Delivery) interface{} { return d.Phone }),
+		"zip":     field(graphql.String, func(d models.Delivery) interface{} { return d.Zip }),
+		"city":    field(graphql.String, func(d models.Delivery) interface{} { return d.City }),
+		"address": field(graphql.String, func(d models.Delivery) interface{} { return d.Address }),
+		"region":  field(graphql.String, func(d models.Delivery) interface{} { return d.Region }),
+		"email":   field(graphql.String, func(d models.Delivery) interface{} { return d.Email }),
+	},
+})
+
+var paymentType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Payment",
+	Fields: graphql.Fields{
+		"transaction":  field(graphql.String, func(p models.Payment) interface{} { return p.Transaction }),
+		"requestId":    field(graphql.String, func(p models.Payment) interface{} { return p.RequestID }),
+		"currency":     field(graphql.String, func(p models.Payment) interface{} { return p.Currency }),
+		"provider":     field(graphql.String, func(p models.Payment) interface{} { return p.Provider }),
+		"amount":       field(graphql.Int, func(p models.Payment) interface{} { return p.Amount }),
+		"paymentDt":    field(graphql.Int, func(p models.Payment) interface{} { return p.PaymentDt }),
+		"bank":         field(graphql.String, func(p models.Payment) interface{} { return p.Bank }),
+		"deliveryCost": field(graphql.Int, func(p models.Payment) interface{} { return p.DeliveryCost }),
+		"goodsTotal":   field(graphql.Int, func(p models.Payment) interface{} { return p.GoodsTotal }),
+		"customFee":    field(graphql.Int, func(p models.Payment) interface{} { return p.CustomFee }),
+	},
+})
+
+var itemType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Item",
+	Fields: graphql.Fields{
+		"chrtId":      field(graphql.Int, func(i models.Item) interface{} { return i.ChrtID }),
+		"trackNumber": field(graphql.String, func(i models.Item) interface{} { return i.TrackNumber }),
+		"price":       field(graphql.Int, func(i models.Item) interface{} { return i.Price }),
+		"rid":         field(graphql.String, func(i models.Item) interface{} { return i.Rid }),
+		"name":        field(graphql.String, func(i models.Item) interface{} { return i.Name }),
+		"sale":        field(graphql.Int, func(i models.Item) interface{} { return i.Sale }),
+		"size":        field(graphql.String, func(i models.Item) interface{} { return i.Size }),
+		"totalPrice":  field(graphql.Int, func(i models.Item) interface{} { return i.TotalPrice }),
+		"nmId":        field(graphql.Int, func(i models.Item) interface{} { return i.NmID }),
+		"brand":       field(graphql.String, func(i models.Item) interface{} { return i.Brand }),
+		"status":      field(graphql.Int, func(i models.Item) interface{} { return i.Status }),
+	},
+})
+
+var orderType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Order",
+	Fields: graphql.Fields{
+		"orderUid":          field(graphql.NewNonNull(graphql.String), func(o *models.Order) interface{} { return o.OrderUID }),
+		"trackNumber":       field(graphql.String, func(o *models.Order) interface{} { return o.TrackNumber }),
+		"entry":             field(graphql.String, func(o *models.Order) interface{} { return o.Entry }),
+		"delivery":          field(deliveryType, func(o *models.Order) interface{} { return o.Delivery }),
+		"payment":           field(paymentType, func(o *models.Order) interface{} { return o.Payment }),
+		"items":             field(graphql.NewList(itemType), func(o *models.Order) interface{} { return o.Items }),
+		"locale":            field(graphql.String, func(o *models.Order) interface{} { return o.Locale }),
+		"internalSignature": field(graphql.String, func(o *models.Order) interface{} { return o.InternalSignature }),
+		"customerId":        field(graphql.String, func(o *models.Order) interface{} { return o.CustomerID }),
+		"deliveryService":   field(graphql.String, func(o *models.Order) interface{} { return o.DeliveryService }),
+		"shardkey":          field(graphql.String, func(o *models.Order) interface{} { return o.Shardkey }),
+		"smId":              field(graphql.Int, func(o *models.Order) interface{} { return o.SmID }),
+		"dateCreated":       field(graphql.DateTime, func(o *models.Order) interface{} { return o.DateCreated }),
+		"oofShard":          field(graphql.String, func(o *models.Order) interface{} { return o.OofShard }),
+		"updatedAt": field(graphql.DateTime, func(o *models.Order) interface{} {
+			if o.UpdatedAt.IsZero() {
+				return nil
+			}
+			return o.UpdatedAt
+		}),
+	},
+})
+
+var orderPageType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "OrderPage",
+	Fields: graphql.Fields{
+		"orders": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(orderType)),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				loader := p.Context.Value(loaderKey{}).(*orderLoader)
+				pg := p.Source.(*page)
+
+				thunks := make([]interface{}, 0, len(pg.uids))
+				for _, uid := range pg.uids {
+					thunks = append(thunks, loader.Load(uid))
+				}
+				return thunks, nil
+			},
+		},
+		// cursor for the after argument, null on the last page
+		"nextCursor": field(graphql.String, func(pg *page) interface{} {
+			if pg.nextCursor == "" {
+				return nil
+			}
+			return pg.nextCursor
+		}),
+	},
+})
+
+func newSchema(h *Handler) (graphql.Schema, error) {
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"order": &graphql.Field{
+				Type: orderType,
+				Args: graphql.FieldConfigArgument{
+					"orderUid": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					loader := p.Context.Value(loaderKey{}).(*orderLoader)
+					return loader.Load(p.Args["orderUid"].(string)), nil
+				},
+			},
+			"orders": &graphql.Field{
+				Type: graphql.NewNonNull(orderPageType),
+				Args: graphql.FieldConfigArgument{
+					"first":           &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize},
+					"after":           &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: ""},
+					"customerId":      &graphql.ArgumentConfig{Type: graphql.String},
+					"deliveryService": &graphql.ArgumentConfig{Type: graphql.String},
+					"createdFrom":     &graphql.ArgumentConfig{Type: graphql.DateTime},
+					"createdTo":       &graphql.ArgumentConfig{Type: graphql.DateTime},
+				},
+				Resolve: h.resolveOrders,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+func (h *Handler) resolveOrders(p graphql.ResolveParams) (interface{}, error) {
+	first, _ := p.Args["first"].(int)
+	if first <= 0 {
+		first = defaultPageSize
+	} else if first > maxPageSize {
+		first = maxPageSize
+	}
+
+	after, _ := p.Args["after"].(string)
+
+	var filter database.OrderFilter
+	filter.CustomerID, _ = p.Args["customerId"].(string)
+	filter.DeliveryService, _ = p.Args["deliveryService"].(string)
+	if t, ok := p.Args["createdFrom"].(time.Time); ok {
+		filter.CreatedFrom = t
+	}
+	if t, ok := p.Args["createdTo"].(time.Time); ok {
+		filter.CreatedTo = t
+	}
+
+	uids, err := h.orders.ListOrderUIDs(p.Context, filter, after, first)
+	if err != nil {
+		return nil, err
+	}
+
+	pg := &page{uids: uids}
+	if len(uids) == first {
+		pg.nextCursor = uids[len(uids)-1]
+	}
+	return pg, nil
+}
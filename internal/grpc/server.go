@@ -0,0 +1,148 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+
+	"order-service/internal/breaker"
+	"order-service/internal/database"
+	"order-service/internal/events"
+	"order-service/internal/pb"
+	"order-service/internal/service"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type Server struct {
+	pb.UnimplementedOrderServiceServer
+
+	orders *service.Orders
+	events *events.Broker
+	server *grpc.Server
+	health *health.Server
+}
+
+func NewServer(orders *service.Orders, broker *events.Broker) *Server {
+	s := &Server{
+		orders: orders,
+		events: broker,
+		server: grpc.NewServer(),
+		health: health.NewServer(),
+	}
+
+	pb.RegisterOrderServiceServer(s.server, s)
+	healthpb.RegisterHealthServer(s.server, s.health)
+	reflection.Register(s.server)
+
+	return s
+}
+
+func (s *Server) Start(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.health.SetServingStatus(pb.OrderService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+
+	log.Printf("Starting gRPC server on %s", addr)
+	return s.server.Serve(lis)
+}
+
+func (s *Server) Stop() {
+	s.health.Shutdown()
+	s.server.GracefulStop()
+}
+
+func (s *Server) GetOrder(ctx context.Context, req *pb.GetOrderRequest) (*pb.GetOrderResponse, error) {
+	if req.GetOrderUid() == "" {
+		return nil, status.Error(codes.InvalidArgument, "order_uid is required")
+	}
+
+	order, source, duration, err := s.orders.GetOrder(ctx, req.GetOrderUid())
+	if errors.Is(err, breaker.ErrOpen) {
+		return nil, status.Error(codes.Unavailable, "database is unavailable")
+	} else if err != nil {
+		log.Printf("Error retrieving order from database: %v", err)
+		return nil, status.Error(codes.Internal, "error retrieving order")
+	}
+
+	if order == nil {
+		return nil, status.Errorf(codes.NotFound, "order %s not found", req.GetOrderUid())
+	}
+
+	return &pb.GetOrderResponse{
+		Order:     pb.FromModel(order),
+		Source:    source,
+		FetchTime: durationpb.New(duration),
+	}, nil
+}
+
+func (s *Server) ListOrders(ctx context.Context, req *pb.ListOrdersRequest) (*pb.ListOrdersResponse, error) {
+	pageSize := int(req.GetPageSize())
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	} else if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	orders, err := s.orders.ListOrders(ctx, database.OrderFilter{CustomerID: req.GetCustomerId()}, req.GetPageToken(), pageSize)
+	if errors.Is(err, breaker.ErrOpen) {
+		return nil, status.Error(codes.Unavailable, "database is unavailable")
+	} else if err != nil {
+		log.Printf("Error listing orders: %v", err)
+		return nil, status.Error(codes.Internal, "error listing orders")
+	}
+
+	resp := &pb.ListOrdersResponse{}
+	for i := range orders {
+		resp.Orders = append(resp.Orders, pb.FromModel(&orders[i]))
+	}
+	if len(orders) == pageSize {
+		resp.NextPageToken = orders[len(orders)-1].OrderUID
+	}
+
+	return resp, nil
+}
+
+func (s *Server) StreamOrderUpdates(req *pb.StreamOrderUpdatesRequest, stream pb.OrderService_StreamOrderUpdatesServer) error {
+	updates, unsubscribe := s.events.Subscribe(64)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event, ok := <-updates:
+			if !ok {
+				return nil
+			}
+
+			if !event.Matches(req.GetCustomerId(), req.GetOrderUid()) {
+				continue
+			}
+
+			err := stream.Send(&pb.OrderUpdate{
+				Order:     pb.FromModel(event.Order),
+				UpdatedAt: timestamppb.New(event.UpdatedAt),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package http
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"order-service/internal/bench"
+	"order-service/internal/replay"
+)
+
+// admin guards the admin API with the bearer token. Without a configured
+// token the admin endpoints don't exist.
+func (s *Server) admin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.adminToken == "" {
+			notFoundHandler(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Unauthorized", "A valid admin token is required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// benchmarkRequest is the body of POST /api/v1/admin/benchmarks.
+type benchmarkRequest struct {
+	Sample      int    `json:"sample"`
+	Concurrency int    `json:"concurrency"`
+	Duration    string `json:"duration"`
+	Mode        string `json:"mode"`
+}
+
+// benchmarksHandler lists benchmark jobs (GET) or starts one (POST).
+func (s *Server) benchmarksHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.jobs.List())
+	case http.MethodPost:
+		s.startBenchmark(w, r)
+	default:
+		methodNotAllowed(w, r, "GET, POST")
+	}
+}
+
+func (s *Server) startBenchmark(w http.ResponseWriter, r *http.Request) {
+	var req benchmarkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	opts := bench.Options{
+		Sample:      req.Sample,
+		Concurrency: req.Concurrency,
+		Mode:        req.Mode,
+	}
+	if req.Duration != "" {
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid duration", err.Error())
+			return
+		}
+		opts.Duration = duration
+	}
+
+	job, err := s.jobs.Start(opts)
+	if errors.Is(err, bench.ErrBusy) {
+		writeError(w, r, http.StatusConflict, CodeConflict, "Benchmark already running", err.Error())
+		return
+	} else if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid benchmark options", err.Error())
+		return
+	}
+
+	w.Header().Set("Location", apiV1+"admin/benchmarks/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// benchmarkHandler reports a job's progress (GET) or cancels it (DELETE).
+func (s *Server) benchmarkHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		job, ok := s.jobs.Get(id)
+		if !ok {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "Benchmark not found", "")
+			return
+		}
+		if job.Status == bench.StatusRunning {
+			w.Header().Set("Retry-After", "1")
+		}
+		writeJSON(w, http.StatusOK, job)
+	case http.MethodDelete:
+		if !s.jobs.Cancel(id) {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "Benchmark not found", "")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, r, "GET, DELETE")
+	}
+}
+
+// replaysHandler lists replay jobs (GET) or starts one (POST).
+func (s *Server) replaysHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.replays.List())
+	case http.MethodPost:
+		s.startReplay(w, r)
+	default:
+		methodNotAllowed(w, r, "GET, POST")
+	}
+}
+
+func (s *Server) startReplay(w http.ResponseWriter, r *http.Request) {
+	var opts replay.Options
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	job, err := s.replays.Start(opts)
+	if errors.Is(err, replay.ErrBusy) {
+		writeError(w, r, http.StatusConflict, CodeConflict, "Replay already running", err.Error())
+		return
+	} else if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid replay options", err.Error())
+		return
+	}
+
+	w.Header().Set("Location", apiV1+"admin/replays/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// replayHandler reports a replay's progress (GET) or cancels it (DELETE).
+func (s *Server) replayHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		job, ok := s.replays.Get(id)
+		if !ok {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "Replay not found", "")
+			return
+		}
+		if job.Status == replay.StatusRunning {
+			w.Header().Set("Retry-After", "1")
+		}
+		writeJSON(w, http.StatusOK, job)
+	case http.MethodDelete:
+		if !s.replays.Cancel(id) {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "Replay not found", "")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, r, "GET, DELETE")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,116 @@
+package http
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"order-service/internal/models"
+	"order-service/internal/money"
+)
+
+// orderResponse is the v1 order with its amounts spelled out.
+type orderResponse struct {
+	*models.Order
+	Amounts *orderAmounts `json:"amounts,omitempty"`
+}
+
+// orderAmounts holds the amounts of an order in its payment currency and,
+// when a rate is known, in the reporting currency.
+type orderAmounts struct {
+	Original  amountSet     `json:"original"`
+	Reporting *reportingSet `json:"reporting,omitempty"`
+}
+
+type amountSet struct {
+	Amount       money.Amount  `json:"amount"`
+	DeliveryCost money.Amount  `json:"delivery_cost"`
+	GoodsTotal   money.Amount  `json:"goods_total"`
+	CustomFee    money.Amount  `json:"custom_fee"`
+	Items        []itemAmounts `json:"items"`
+}
+
+type itemAmounts struct {
+	ChrtID     int          `json:"chrt_id"`
+	Price      money.Amount `json:"price"`
+	TotalPrice money.Amount `json:"total_price"`
+}
+
+type reportingSet struct {
+	amountSet
+	Rate     string `json:"rate"`
+	RateDate string `json:"rate_date,omitempty"`
+}
+
+// amountsOf returns nil for orders saved before currencies were validated.
+func amountsOf(order *models.Order, converter *money.Converter) *orderAmounts {
+	currency, err := money.Lookup(order.Payment.Currency)
+	if err != nil {
+		return nil
+	}
+
+	// the order amounts are minor units already
+	amount := func(minor int) money.Amount { return money.Amount{Minor: int64(minor), Currency: currency} }
+	original := amountSet{
+		Amount:       amount(order.Payment.Amount),
+		DeliveryCost: amount(order.Payment.DeliveryCost),
+		GoodsTotal:   amount(order.Payment.GoodsTotal),
+		CustomFee:    amount(order.Payment.CustomFee),
+		Items:        make([]itemAmounts, len(order.Items)),
+	}
+	for i, item := range order.Items {
+		original.Items[i] = itemAmounts{
+			ChrtID:     item.ChrtID,
+			Price:      amount(item.Price),
+			TotalPrice: amount(item.TotalPrice),
+		}
+	}
+	amounts := &orderAmounts{Original: original}
+	if converter == nil {
+		return amounts
+	}
+
+	// converted at the rate of the day the order was placed
+	at := order.DateCreated
+	if at.IsZero() {
+		at = time.Now()
+	}
+	rate, ok := converter.Rate(currency, at)
+	if !ok {
+		return amounts
+	}
+
+	// an amount too large to convert leaves the order without the
+	// reporting amounts rather than with a wrong one
+	to := converter.Reporting()
+	var overflow error
+	convert := func(a money.Amount) money.Amount {
+		converted, err := a.Convert(rate.Rate, to)
+		if err != nil {
+			overflow = err
+		}
+		return converted
+	}
+	reporting := &reportingSet{
+		amountSet: amountSet{
+			Amount:       convert(original.Amount),
+			DeliveryCost: convert(original.DeliveryCost),
+			GoodsTotal:   convert(original.GoodsTotal),
+			CustomFee:    convert(original.CustomFee),
+			Items:        make([]itemAmounts, len(original.Items)),
+		},
+		Rate: strings.TrimRight(strings.TrimRight(rate.Rate.FloatString(12), "0"), "."),
+	}
+	for i, item := range original.Items {
+		reporting.Items[i] = itemAmounts{ChrtID: item.ChrtID, Price: convert(item.Price), TotalPrice: convert(item.TotalPrice)}
+	}
+	if overflow != nil {
+		log.Printf("Failed to convert the amounts of order %s to %s: %v", order.OrderUID, to.Code, overflow)
+		return amounts
+	}
+	if !rate.ValidFrom.IsZero() {
+		reporting.RateDate = rate.ValidFrom.Format(time.DateOnly)
+	}
+	amounts.Reporting = reporting
+	return amounts
+}
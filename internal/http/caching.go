@@ -0,0 +1,74 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// etag derives an entity tag from the response body. Weak tags are used
+// where the body carries diagnostics that change between requests.
+func etag(body []byte, weak bool) string {
+	sum := sha256.Sum256(body)
+	tag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if weak {
+		return "W/" + tag
+	}
+	return tag
+}
+
+// setValidators adds ETag and, when known, Last-Modified to the response.
+func setValidators(w http.ResponseWriter, tag string, lastModified time.Time) {
+	w.Header().Set("ETag", tag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified evaluates If-None-Match and, only when it is absent,
+// If-Modified-Since (RFC 9110, section 13.2.2).
+func notModified(r *http.Request, tag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || opaqueTag(candidate) == opaqueTag(tag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// Last-Modified has one second precision
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// opaqueTag strips the weak prefix and the content-coding suffix the
+// compression middleware adds, so a client revalidating a gzip variant
+// still matches (weak comparison).
+func opaqueTag(tag string) string {
+	tag = strings.TrimPrefix(tag, "W/")
+	for _, encoding := range []string{encodingBrotli, encodingGzip} {
+		if suffixed := "-" + encoding + `"`; strings.HasSuffix(tag, suffixed) {
+			return strings.TrimSuffix(tag, suffixed) + `"`
+		}
+	}
+	return tag
+}
+
+// withCacheControl applies the route's caching policy. Handlers may still
+// override it, as the streaming ones do.
+func withCacheControl(policy string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", policy)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,257 @@
+package http
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+)
+
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+
+	// smaller bodies are not worth the encoder overhead
+	minCompressSize = 1024
+)
+
+var compressibleTypes = map[string]bool{
+	"application/json":         true,
+	"application/problem+json": true,
+	"application/javascript":   true,
+	"text/html":                true,
+	"text/css":                 true,
+	"text/plain":               true,
+	"text/javascript":          true,
+	"image/svg+xml":            true,
+}
+
+var (
+	gzipWriters = sync.Pool{New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return w
+	}}
+	brotliWriters = sync.Pool{New: func() interface{} {
+		return brotli.NewWriterLevel(nil, 4)
+	}}
+)
+
+// compress encodes responses with brotli or gzip, whichever the client
+// prefers in Accept-Encoding. Event streams, WebSocket upgrades, small and
+// already encoded bodies are sent as is.
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding picks the supported coding with the highest q-value,
+// brotli on ties.
+func negotiateEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	q := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				weight = parsed
+			}
+		}
+		q[strings.ToLower(strings.TrimSpace(name))] = weight
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range []string{encodingBrotli, encodingGzip} {
+		weight, ok := q[encoding]
+		if !ok {
+			weight, ok = q["*"]
+		}
+		if ok && weight > bestQ {
+			best, bestQ = encoding, weight
+		}
+	}
+	return best
+}
+
+// compressWriter holds back the first minCompressSize bytes of a
+// compressible response, unless Content-Length already tells its size, and
+// only encodes bodies that turn out to be larger.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+
+	status      int
+	wroteHeader bool // WriteHeader was called by the handler
+	decided     bool // headers were passed on
+	buf         []byte
+	enc         io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+
+	if !cw.compressible(status) {
+		cw.commit(false)
+		return
+	}
+	if length, err := strconv.Atoi(cw.Header().Get("Content-Length")); err == nil {
+		cw.commit(length >= minCompressSize)
+	}
+}
+
+func (cw *compressWriter) compressible(status int) bool {
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	return err == nil && compressibleTypes[mediaType]
+}
+
+// commit sends the headers, switching to the encoder if asked to.
+func (cw *compressWriter) commit(encode bool) {
+	cw.decided = true
+
+	if encode {
+		h := cw.Header()
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+		// a strong tag must differ between representations
+		if tag := h.Get("ETag"); tag != "" && !strings.HasPrefix(tag, "W/") {
+			h.Set("ETag", strings.TrimSuffix(tag, `"`)+"-"+cw.encoding+`"`)
+		}
+		cw.enc = cw.newEncoder()
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+func (cw *compressWriter) newEncoder() io.WriteCloser {
+	if cw.encoding == encodingBrotli {
+		w := brotliWriters.Get().(*brotli.Writer)
+		w.Reset(cw.ResponseWriter)
+		return w
+	}
+
+	w := gzipWriters.Get().(*gzip.Writer)
+	w.Reset(cw.ResponseWriter)
+	return w
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < minCompressSize {
+			return len(b), nil
+		}
+		cw.commit(true)
+		if err := cw.drain(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if cw.enc == nil {
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.enc.Write(b)
+}
+
+// drain writes out what was held back.
+func (cw *compressWriter) drain() error {
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush sends a held back body as is: a handler that flushes wants the
+// bytes out now.
+func (cw *compressWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.commit(false)
+		cw.drain()
+	}
+	if flusher, ok := cw.enc.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close finishes the response and returns the encoder to its pool.
+func (cw *compressWriter) Close() {
+	if cw.wroteHeader && !cw.decided {
+		cw.commit(false)
+		cw.drain()
+	}
+	if cw.enc == nil {
+		return
+	}
+
+	cw.enc.Close()
+	switch w := cw.enc.(type) {
+	case *brotli.Writer:
+		brotliWriters.Put(w)
+	case *gzip.Writer:
+		gzipWriters.Put(w)
+	}
+	cw.enc = nil
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,346 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"order-service/internal/bench"
+	"order-service/internal/cache"
+	"order-service/internal/database"
+	"order-service/internal/events"
+	"order-service/internal/models"
+	"order-service/internal/openapi"
+	"order-service/internal/replay"
+	"order-service/internal/search"
+	"order-service/internal/service"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+const testAdminToken = "test-token"
+
+// The handlers and the OpenAPI spec must not drift apart: every route is
+// in the spec, and every GET operation answers as the spec says, both for
+// the examples of the spec and for an order that does not exist.
+
+func TestRoutesMatchSpec(t *testing.T) {
+	doc := loadSpec(t)
+
+	_, patterns, err := newTestServer(t).routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range openapi.CheckRoutes(doc, patterns) {
+		t.Error(problem)
+	}
+}
+
+func TestResponsesMatchSpec(t *testing.T) {
+	doc := loadSpec(t)
+	validator, err := openapi.NewValidator(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler, err := newTestServer(t).Handler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := doc.Paths.InMatchingOrder()
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		op := doc.Paths.Value(path).Get
+		if op == nil {
+			continue
+		}
+		if _, streaming := op.Extensions["x-streaming"]; streaming {
+			continue
+		}
+
+		examples := map[string]string{}
+		t.Run("GET "+path, func(t *testing.T) {
+			status := checkResponse(t, validator, handler, fillPath(path, op, examples), op.Security != nil)
+			// there are no admin jobs to find
+			if status != http.StatusOK && !strings.HasSuffix(path, "{id}") {
+				t.Errorf("status is %d, want 200 for the examples", status)
+			}
+		})
+
+		if strings.Contains(path, "{order_uid}") {
+			examples["order_uid"] = "missing-order"
+			t.Run("GET "+path+" not found", func(t *testing.T) {
+				status := checkResponse(t, validator, handler, fillPath(path, op, examples), false)
+				if status != http.StatusNotFound {
+					t.Errorf("status is %d, want 404", status)
+				}
+			})
+		}
+	}
+}
+
+func TestServedSpec(t *testing.T) {
+	handler, err := newTestServer(t).Handler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if !bytes.Equal(rec.Body.Bytes(), openapi.Spec) {
+		t.Error("the service serves a different version of the spec")
+	}
+}
+
+// checkResponse calls the handler and validates the response against the
+// operation of the spec, returning the status.
+func checkResponse(t *testing.T, validator *openapi.Validator, handler http.Handler, target string, admin bool) int {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if admin {
+		req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	}
+
+	route, pathParams, err := validator.FindRoute(req)
+	if err != nil {
+		t.Fatalf("no route in spec: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	input := &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: pathParams,
+		Route:      route,
+	}
+	if err := validator.ValidateResponse(context.Background(), input, rec.Code, rec.Header(), rec.Body.Bytes()); err != nil {
+		t.Errorf("status %d: %v\n%s", rec.Code, err, rec.Body)
+	}
+	return rec.Code
+}
+
+// fillPath substitutes the path parameters with their examples, or with
+// values, and adds the query parameters that have examples.
+func fillPath(path string, op *openapi3.Operation, values map[string]string) string {
+	query := make([]string, 0)
+	for _, param := range op.Parameters {
+		p := param.Value
+		if p == nil || p.Example == nil {
+			continue
+		}
+
+		value, ok := values[p.Name]
+		if !ok {
+			value = fmt.Sprint(p.Example)
+		}
+		switch p.In {
+		case openapi3.ParameterInPath:
+			path = strings.ReplaceAll(path, "{"+p.Name+"}", value)
+		case openapi3.ParameterInQuery:
+			query = append(query, p.Name+"="+strings.ReplaceAll(value, " ", "+"))
+		}
+	}
+	if len(query) > 0 {
+		path += "?" + strings.Join(query, "&")
+	}
+	return path
+}
+
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	store := newFakeStore(testOrder())
+	memory := cache.NewMemoryCache(time.Minute, time.Minute)
+	filler := cache.NewFiller(memory, 10, 1)
+	t.Cleanup(filler.Close)
+
+	orders := service.NewOrders(memory, cache.NewLocalCache(100, 0, time.Minute), store, filler)
+	return NewServer(orders, events.NewBroker(10, nil), bench.NewJobs(ctx, nil), replay.NewJobs(ctx, nil),
+		service.NewReports(store), nil, time.Second, false, nil, false, testAdminToken)
+}
+
+// testOrder is the order the examples of the spec refer to.
+func testOrder() models.Order {
+	return models.Order{
+		OrderUID:    "test-order-123",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			Name:    "Test Testov",
+			Phone:   "+79161234567",
+			Zip:     "2639809",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Region:  "Kraiot",
+			Email:   "test@gmail.com",
+		},
+		Payment: models.Payment{
+			Transaction:  "test-order-123",
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       1817,
+			PaymentDt:    1637907727,
+			Bank:         "alpha",
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+		},
+		Items: []models.Item{{
+			ChrtID:      9934930,
+			TrackNumber: "WBILMTESTTRACK",
+			Price:       453,
+			Rid:         "ab4219087a764ae0btest",
+			Name:        "Mascaras",
+			Sale:        30,
+			Size:        "0",
+			TotalPrice:  317,
+			NmID:        2389212,
+			Brand:       "Vivienne Sabo",
+			Status:      202,
+		}},
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		Shardkey:        "9",
+		SmID:            99,
+		DateCreated:     time.Date(2026, 1, 10, 6, 22, 19, 0, time.UTC),
+		OofShard:        "1",
+		UpdatedAt:       time.Date(2026, 1, 10, 6, 22, 20, 0, time.UTC),
+	}
+}
+
+// fakeStore serves a fixed set of orders in place of Postgres.
+type fakeStore struct {
+	orders map[string]models.Order
+	uids   []string
+}
+
+func newFakeStore(orders ...models.Order) *fakeStore {
+	s := &fakeStore{orders: make(map[string]models.Order)}
+	for _, order := range orders {
+		s.orders[order.OrderUID] = order
+		s.uids = append(s.uids, order.OrderUID)
+	}
+	slices.Sort(s.uids)
+	return s
+}
+
+func (s *fakeStore) GetOrder(ctx context.Context, orderUID string) (*models.Order, error) {
+	order, ok := s.orders[orderUID]
+	if !ok {
+		return nil, nil
+	}
+	return &order, nil
+}
+
+func (s *fakeStore) GetOrdersByUIDs(ctx context.Context, orderUIDs []string) ([]models.Order, error) {
+	var orders []models.Order
+	for _, uid := range orderUIDs {
+		if order, ok := s.orders[uid]; ok {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func (s *fakeStore) ListOrderUIDs(ctx context.Context, filter database.OrderFilter, afterUID string, limit int) ([]string, error) {
+	var uids []string
+	for _, uid := range s.uids {
+		if uid > afterUID && len(uids) < limit {
+			uids = append(uids, uid)
+		}
+	}
+	return uids, nil
+}
+
+func (s *fakeStore) ListOrders(ctx context.Context, filter database.OrderFilter, afterUID string, limit int) ([]models.Order, error) {
+	uids, _ := s.ListOrderUIDs(ctx, filter, afterUID, limit)
+	return s.GetOrdersByUIDs(ctx, uids)
+}
+
+func (s *fakeStore) OrderUIDsByTrack(ctx context.Context, trackNumber string, limit int) ([]string, error) {
+	return s.match(limit, func(order models.Order) bool { return order.TrackNumber == trackNumber }), nil
+}
+
+func (s *fakeStore) OrderUIDsByCustomer(ctx context.Context, customerID string, limit int) ([]string, error) {
+	return s.match(limit, func(order models.Order) bool { return order.CustomerID == customerID }), nil
+}
+
+func (s *fakeStore) SearchOrders(ctx context.Context, q search.Query, limit, offset int) ([]database.SearchHit, error) {
+	var hits []database.SearchHit
+	for _, uid := range s.match(offset+limit, func(order models.Order) bool {
+		return strings.Contains(strings.TrimPrefix(order.Delivery.Phone, "+"), q.Term)
+	}) {
+		hits = append(hits, database.SearchHit{Order: s.orders[uid], Rank: 1})
+	}
+	return hits[min(offset, len(hits)):], nil
+}
+
+func (s *fakeStore) match(limit int, matches func(order models.Order) bool) []string {
+	var uids []string
+	for _, uid := range s.uids {
+		if matches(s.orders[uid]) && len(uids) < limit {
+			uids = append(uids, uid)
+		}
+	}
+	return uids
+}
+
+func (s *fakeStore) RefreshReports(ctx context.Context) error {
+	return nil
+}
+
+func (s *fakeStore) ReportsRefreshedAt(ctx context.Context) (time.Time, error) {
+	return time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), nil
+}
+
+func (s *fakeStore) Revenue(ctx context.Context, filter database.ReportFilter, byDay, byProvider bool) ([]database.RevenueRow, error) {
+	row := database.RevenueRow{Currency: "USD", Orders: 1, Amount: 1817, GoodsTotal: 317, DeliveryCost: 1500}
+	if byDay {
+		row.Day = "2026-01-10"
+	}
+	if byProvider {
+		row.Provider = "wbpay"
+	}
+	return []database.RevenueRow{row}, nil
+}
+
+func (s *fakeStore) TopBrands(ctx context.Context, filter database.ReportFilter, limit int) ([]database.SalesRow, error) {
+	return []database.SalesRow{{Brand: "Vivienne Sabo", Items: 1, Revenue: []database.CurrencyAmount{{Currency: "USD", Amount: 317}}}}, nil
+}
+
+func (s *fakeStore) TopProducts(ctx context.Context, filter database.ReportFilter, limit int) ([]database.SalesRow, error) {
+	return []database.SalesRow{{Brand: "Vivienne Sabo", NmID: 2389212, Items: 1, Revenue: []database.CurrencyAmount{{Currency: "USD", Amount: 317}}}}, nil
+}
+
+func (s *fakeStore) DeliveryCosts(ctx context.Context, filter database.ReportFilter) ([]database.DeliveryRow, error) {
+	return []database.DeliveryRow{{DeliveryService: "meest", Region: "Kraiot", Currency: "USD", Orders: 1, AverageDeliveryCost: "1500.00"}}, nil
+}
+
+func (s *fakeStore) TopCustomers(ctx context.Context, filter database.ReportFilter, limit int) ([]database.CustomerRow, error) {
+	return []database.CustomerRow{{CustomerID: "test", Orders: 1, FirstDay: "2026-01-10", LastDay: "2026-01-10"}}, nil
+}
@@ -0,0 +1,94 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"order-service/internal/breaker"
+	"order-service/internal/models"
+	"order-service/internal/service"
+)
+
+const defaultCustomerOrders = 100
+
+type trackOrdersResponse struct {
+	TrackNumber string          `json:"track_number"`
+	Orders      []orderResponse `json:"orders"`
+}
+
+type customerOrdersResponse struct {
+	CustomerID string          `json:"customer_id"`
+	Orders     []orderResponse `json:"orders"`
+}
+
+// ordersByTrackHandler finds the orders a customer's track number belongs
+// to, whether it is the order's or one of its items'.
+func (s *Server) ordersByTrackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	trackNumber := r.PathValue("track_number")
+	orders, source, err := s.orders.OrdersByTrack(r.Context(), trackNumber)
+	if err != nil {
+		lookupError(w, r, err)
+		return
+	}
+
+	w.Header().Set("X-Data-Source", source)
+	if len(orders) == 0 {
+		writeError(w, r, http.StatusNotFound, CodeOrderNotFound, "Order not found", fmt.Sprintf("No order has track number %s", trackNumber))
+		return
+	}
+	writeJSON(w, http.StatusOK, trackOrdersResponse{TrackNumber: trackNumber, Orders: s.orderResponses(orders)})
+}
+
+// customerOrdersHandler lists the newest orders of a customer; a customer
+// without orders has an empty list.
+func (s *Server) customerOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	limit := defaultCustomerOrders
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > service.MaxLookupOrders {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid query", fmt.Sprintf("limit must be between 1 and %d", service.MaxLookupOrders))
+			return
+		}
+	}
+
+	customerID := r.PathValue("customer_id")
+	orders, source, err := s.orders.OrdersByCustomer(r.Context(), customerID, limit)
+	if err != nil {
+		lookupError(w, r, err)
+		return
+	}
+
+	w.Header().Set("X-Data-Source", source)
+	writeJSON(w, http.StatusOK, customerOrdersResponse{CustomerID: customerID, Orders: s.orderResponses(orders)})
+}
+
+func (s *Server) orderResponses(orders []*models.Order) []orderResponse {
+	responses := make([]orderResponse, len(orders))
+	for i, order := range orders {
+		responses[i] = orderResponse{Order: order, Amounts: amountsOf(order, s.converter)}
+	}
+	return responses
+}
+
+func lookupError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, breaker.ErrOpen) {
+		w.Header().Set("Retry-After", "5")
+		writeError(w, r, http.StatusServiceUnavailable, CodeServiceUnavailable, "Service temporarily unavailable", "The order database is unavailable")
+		return
+	}
+	log.Printf("Failed to look up orders %s: %v", r.URL.Path, err)
+	writeError(w, r, http.StatusInternalServerError, CodeInternal, "Error retrieving orders", "")
+}
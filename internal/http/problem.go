@@ -0,0 +1,64 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const apiV1 = "/api/v1/"
+
+// Machine-readable error codes of the v1 API.
+const (
+	CodeInvalidRequest     = "invalid_request"
+	CodeUnauthorized       = "unauthorized"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeNotFound           = "not_found"
+	CodeOrderNotFound      = "order_not_found"
+	CodeConflict           = "conflict"
+	CodeServiceUnavailable = "service_unavailable"
+	CodeInternal           = "internal_error"
+)
+
+// Problem is an RFC 7807 error body. Code repeats the last segment of Type
+// so clients can switch on it without parsing the URI.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+}
+
+// writeError reports an error as problem+json on v1 routes and as plain
+// text, the way it always was, on the legacy ones.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, title, detail string) {
+	if !strings.HasPrefix(r.URL.Path, apiV1) {
+		http.Error(w, title, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Problem{
+		Type:     "urn:order-service:problem:" + code,
+		Title:    title,
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     code,
+	})
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request, allowed string) {
+	w.Header().Set("Allow", allowed)
+	writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed", "")
+}
+
+// notFoundHandler answers unknown /api/v1/ paths, which would otherwise end
+// up in the static file server.
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, CodeNotFound, "Not found", "No such endpoint: "+r.URL.Path)
+}
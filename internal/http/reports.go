@@ -0,0 +1,197 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"order-service/internal/breaker"
+	"order-service/internal/database"
+	"order-service/internal/money"
+)
+
+const (
+	defaultReportLimit = 10
+	maxReportLimit     = 1000
+)
+
+// reportResponse wraps the rows of every report with the range it covers
+// and the time of the data.
+type reportResponse[T any] struct {
+	From        string    `json:"from,omitempty"`
+	To          string    `json:"to,omitempty"`
+	RefreshedAt time.Time `json:"refreshed_at"`
+	Rows        []T       `json:"rows"`
+}
+
+// reportQuery is the query string shared by the reports.
+type reportQuery struct {
+	filter database.ReportFilter
+	limit  int
+}
+
+func parseReportQuery(r *http.Request) (reportQuery, error) {
+	q := reportQuery{limit: defaultReportLimit}
+	values := r.URL.Query()
+
+	var err error
+	if v := values.Get("from"); v != "" {
+		if q.filter.From, err = time.Parse(time.DateOnly, v); err != nil {
+			return q, fmt.Errorf("from: expected YYYY-MM-DD")
+		}
+	}
+	if v := values.Get("to"); v != "" {
+		if q.filter.To, err = time.Parse(time.DateOnly, v); err != nil {
+			return q, fmt.Errorf("to: expected YYYY-MM-DD")
+		}
+	}
+	if !q.filter.From.IsZero() && !q.filter.To.IsZero() && q.filter.To.Before(q.filter.From) {
+		return q, fmt.Errorf("to is before from")
+	}
+	if v := values.Get("currency"); v != "" {
+		currency, err := money.Lookup(v)
+		if err != nil {
+			return q, err
+		}
+		q.filter.Currency = currency.Code
+	}
+	if v := values.Get("limit"); v != "" {
+		if q.limit, err = strconv.Atoi(v); err != nil || q.limit < 1 || q.limit > maxReportLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxReportLimit)
+		}
+	}
+	return q, nil
+}
+
+// report answers a report request: rows runs the query.
+func report[T any](s *Server, w http.ResponseWriter, r *http.Request, rows func(ctx context.Context, q reportQuery) ([]T, error)) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	if s.reports == nil {
+		writeError(w, r, http.StatusServiceUnavailable, CodeServiceUnavailable, "Reports are disabled", "")
+		return
+	}
+
+	q, err := parseReportQuery(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid report query", err.Error())
+		return
+	}
+
+	refreshedAt, err := s.reports.RefreshedAt(r.Context())
+	if err != nil {
+		reportError(w, r, err)
+		return
+	}
+	result, err := rows(r.Context(), q)
+	if err != nil {
+		reportError(w, r, err)
+		return
+	}
+	if result == nil {
+		result = []T{}
+	}
+
+	response := reportResponse[T]{RefreshedAt: refreshedAt, Rows: result}
+	if !q.filter.From.IsZero() {
+		response.From = q.filter.From.Format(time.DateOnly)
+	}
+	if !q.filter.To.IsZero() {
+		response.To = q.filter.To.Format(time.DateOnly)
+	}
+	w.Header().Set("Last-Modified", refreshedAt.UTC().Format(http.TimeFormat))
+	writeJSON(w, http.StatusOK, response)
+}
+
+func reportError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, database.ErrReportsNotReady):
+		w.Header().Set("Retry-After", "30")
+		writeError(w, r, http.StatusServiceUnavailable, CodeServiceUnavailable, "Reports are not ready yet", "The report views have not been computed yet")
+	case errors.Is(err, breaker.ErrOpen):
+		w.Header().Set("Retry-After", "5")
+		writeError(w, r, http.StatusServiceUnavailable, CodeServiceUnavailable, "Service temporarily unavailable", "The order database is unavailable")
+	default:
+		log.Printf("Failed to build report %s: %v", r.URL.Path, err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Error building report", "")
+	}
+}
+
+// revenueReportHandler groups by currency and by whatever group_by adds:
+// day, provider or both.
+func (s *Server) revenueReportHandler(w http.ResponseWriter, r *http.Request) {
+	byDay, byProvider := true, false
+	if v := r.URL.Query().Get("group_by"); v != "" {
+		byDay = false
+		for _, field := range strings.Split(v, ",") {
+			switch strings.TrimSpace(field) {
+			case "day":
+				byDay = true
+			case "provider":
+				byProvider = true
+			case "currency":
+			default:
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid report query", "group_by: expected day, currency or provider")
+				return
+			}
+		}
+	}
+
+	report(s, w, r, func(ctx context.Context, q reportQuery) ([]database.RevenueRow, error) {
+		return s.reports.Revenue(ctx, q.filter, byDay, byProvider)
+	})
+}
+
+func (s *Server) topBrandsReportHandler(w http.ResponseWriter, r *http.Request) {
+	report(s, w, r, func(ctx context.Context, q reportQuery) ([]database.SalesRow, error) {
+		return s.reports.TopBrands(ctx, q.filter, q.limit)
+	})
+}
+
+func (s *Server) topProductsReportHandler(w http.ResponseWriter, r *http.Request) {
+	report(s, w, r, func(ctx context.Context, q reportQuery) ([]database.SalesRow, error) {
+		return s.reports.TopProducts(ctx, q.filter, q.limit)
+	})
+}
+
+func (s *Server) deliveryCostsReportHandler(w http.ResponseWriter, r *http.Request) {
+	report(s, w, r, func(ctx context.Context, q reportQuery) ([]database.DeliveryRow, error) {
+		return s.reports.DeliveryCosts(ctx, q.filter)
+	})
+}
+
+func (s *Server) customersReportHandler(w http.ResponseWriter, r *http.Request) {
+	report(s, w, r, func(ctx context.Context, q reportQuery) ([]database.CustomerRow, error) {
+		return s.reports.TopCustomers(ctx, q.filter, q.limit)
+	})
+}
+
+// refreshReportsHandler recomputes the report views now instead of waiting
+// for the schedule.
+func (s *Server) refreshReportsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost)
+		return
+	}
+	if s.reports == nil {
+		writeError(w, r, http.StatusServiceUnavailable, CodeServiceUnavailable, "Reports are disabled", "")
+		return
+	}
+
+	refreshedAt, err := s.reports.Refresh(r.Context())
+	if errors.Is(err, database.ErrRefreshRunning) {
+		writeError(w, r, http.StatusConflict, CodeConflict, "Refresh already running", err.Error())
+		return
+	} else if err != nil {
+		reportError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]time.Time{"refreshed_at": refreshedAt})
+}
@@ -0,0 +1,123 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"order-service/internal/breaker"
+	"order-service/internal/database"
+	"order-service/internal/models"
+	"order-service/internal/search"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	maxSearchOffset    = 1000
+)
+
+type searchResponse struct {
+	Query   string         `json:"query"`
+	Limit   int            `json:"limit"`
+	Offset  int            `json:"offset"`
+	Results []searchResult `json:"results"`
+}
+
+// searchResult is the part of an order support needs to pick the right one;
+// the order itself is one more request away.
+type searchResult struct {
+	OrderUID    string          `json:"order_uid"`
+	TrackNumber string          `json:"track_number"`
+	CustomerID  string          `json:"customer_id"`
+	DateCreated time.Time       `json:"date_created"`
+	Delivery    models.Delivery `json:"delivery"`
+	Items       int             `json:"items"`
+	Rank        float64         `json:"rank"`
+	// matched fields HTML-escaped, matches wrapped in <mark>
+	Highlights map[string]string `json:"highlights"`
+}
+
+func (s *Server) searchOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	values := r.URL.Query()
+	q, err := search.Parse(values.Get("q"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid search query", err.Error())
+		return
+	}
+	limit, offset := defaultSearchLimit, 0
+	if v := values.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxSearchLimit {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid search query", fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit))
+			return
+		}
+	}
+	if v := values.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 || offset > maxSearchOffset {
+			writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid search query", fmt.Sprintf("offset must be between 0 and %d", maxSearchOffset))
+			return
+		}
+	}
+
+	hits, err := s.orders.SearchOrders(r.Context(), q, limit, offset)
+	if errors.Is(err, breaker.ErrOpen) {
+		w.Header().Set("Retry-After", "5")
+		writeError(w, r, http.StatusServiceUnavailable, CodeServiceUnavailable, "Service temporarily unavailable", "The order database is unavailable")
+		return
+	} else if err != nil {
+		log.Printf("Failed to search orders: %v", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Error searching orders", "")
+		return
+	}
+
+	response := searchResponse{Query: values.Get("q"), Limit: limit, Offset: offset, Results: make([]searchResult, len(hits))}
+	for i, hit := range hits {
+		response.Results[i] = searchResult{
+			OrderUID:    hit.Order.OrderUID,
+			TrackNumber: hit.Order.TrackNumber,
+			CustomerID:  hit.Order.CustomerID,
+			DateCreated: hit.Order.DateCreated,
+			Delivery:    hit.Order.Delivery,
+			Items:       len(hit.Order.Items),
+			Rank:        hit.Rank,
+			Highlights:  highlights(hit, q),
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// highlights marks the query in every searched field of the order.
+func highlights(hit database.SearchHit, q search.Query) map[string]string {
+	fields := map[string]string{
+		"delivery.name":    hit.Order.Delivery.Name,
+		"delivery.phone":   hit.Order.Delivery.Phone,
+		"delivery.email":   hit.Order.Delivery.Email,
+		"delivery.address": hit.Order.Delivery.Address,
+		"delivery.city":    hit.Order.Delivery.City,
+		"delivery.region":  hit.Order.Delivery.Region,
+	}
+	for i, item := range hit.Order.Items {
+		fields[fmt.Sprintf("items[%d].name", i)] = item.Name
+		fields[fmt.Sprintf("items[%d].brand", i)] = item.Brand
+	}
+
+	result := make(map[string]string)
+	for field, value := range fields {
+		// phone numbers match on digits only, and nothing else is a phone
+		if q.Phone != (field == "delivery.phone") {
+			continue
+		}
+		if marked, ok := search.Highlight(value, q); ok {
+			result[field] = marked
+		}
+	}
+	return result
+}
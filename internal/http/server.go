@@ -2,48 +2,187 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
-	"context"
 
-	"order-service/internal/cache"
-	"order-service/internal/database"
+	"order-service/internal/bench"
+	"order-service/internal/breaker"
+	"order-service/internal/events"
+	"order-service/internal/graphql"
 	"order-service/internal/models"
+	"order-service/internal/money"
+	"order-service/internal/openapi"
+	"order-service/internal/replay"
+	"order-service/internal/service"
 )
 
 type Server struct {
-	cache *cache.RedisCache
-	db    *database.PostgresRepository
+	orders    *service.Orders
+	events    *events.Broker
+	jobs      *bench.Jobs
+	replays   *replay.Jobs
+	reports   *service.Reports
+	converter *money.Converter // nil without a reporting currency
+	heartbeat time.Duration
+	devMode   bool
+
+	// Cache-Control policy by route pattern
+	cacheControl map[string]string
+	compression  bool
+	// bearer token of the admin API, which is off when empty
+	adminToken string
 }
 
-func NewServer(cache *cache.RedisCache, db *database.PostgresRepository) *Server {
+func NewServer(orders *service.Orders, broker *events.Broker, jobs *bench.Jobs, replays *replay.Jobs, reports *service.Reports, converter *money.Converter, heartbeat time.Duration, devMode bool, cacheControl map[string]string, compression bool, adminToken string) *Server {
+	if heartbeat <= 0 {
+		heartbeat = 15 * time.Second
+	}
+
 	return &Server{
-		cache: cache,
-		db:    db,
+		orders:    orders,
+		events:    broker,
+		jobs:      jobs,
+		replays:   replays,
+		reports:   reports,
+		converter: converter,
+		heartbeat: heartbeat,
+		devMode:   devMode,
+
+		cacheControl: cacheControl,
+		compression:  compression,
+		adminToken:   adminToken,
 	}
 }
 
 func (s *Server) Start(addr string) error {
+	handler, err := s.Handler()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Starting HTTP server on %s", addr)
+	return http.ListenAndServe(addr, handler)
+}
+
+// Handler builds the router with every endpoint, applies the per-route
+// Cache-Control policies and response compression. In dev mode requests and
+// responses are also validated against the OpenAPI spec.
+func (s *Server) Handler() (http.Handler, error) {
+	mux, patterns, err := s.routes()
+	if err != nil {
+		return nil, err
+	}
+
+	var handler http.Handler = mux
+	if s.devMode {
+		validator, err := s.validator(patterns)
+		if err != nil {
+			return nil, err
+		}
+		handler = validator.Middleware(handler)
+	}
+
+	// outermost, so the validator sees plain bodies
+	if s.compression {
+		handler = compress(handler)
+	}
+
+	return handler, nil
+}
+
+// routes registers every endpoint and returns the patterns of those the
+// OpenAPI spec describes.
+func (s *Server) routes() (*http.ServeMux, []string, error) {
 	mux := http.NewServeMux()
 
-	// API endpoints
-	mux.HandleFunc("/api/health", s.healthHandler)
-	mux.HandleFunc("/api/order/", s.getOrderHandler)
-	mux.HandleFunc("/api/benchmark", s.benchmarkHandler) // Новый эндпоинт для бенчмарка
+	var patterns []string
+	handle := func(pattern string, handler http.Handler) {
+		mux.Handle(pattern, s.withCacheControl(pattern, handler))
+		patterns = append(patterns, pattern)
+	}
+
+	gql, err := graphql.NewHandler(s.orders)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// API v1
+	handle("/api/v1/health", http.HandlerFunc(s.healthHandler))
+	handle("/api/v1/orders/{order_uid}", http.HandlerFunc(s.getOrderV1Handler))
+	handle("/api/v1/orders/search", http.HandlerFunc(s.searchOrdersHandler))
+	handle("/api/v1/orders/by-track/{track_number}", http.HandlerFunc(s.ordersByTrackHandler))
+	handle("/api/v1/customers/{customer_id}/orders", http.HandlerFunc(s.customerOrdersHandler))
+	handle("/api/v1/orders/stream", http.HandlerFunc(s.streamHandler))
+	handle("/api/v1/orders/ws", http.HandlerFunc(s.websocketHandler))
+	handle("/api/v1/cache/stats", http.HandlerFunc(s.cacheStatsHandler))
+	handle("/api/v1/admin/benchmarks", s.admin(http.HandlerFunc(s.benchmarksHandler)))
+	handle("/api/v1/admin/benchmarks/{id}", s.admin(http.HandlerFunc(s.benchmarkHandler)))
+	handle("/api/v1/admin/replays", s.admin(http.HandlerFunc(s.replaysHandler)))
+	handle("/api/v1/admin/replays/{id}", s.admin(http.HandlerFunc(s.replayHandler)))
+	handle("/api/v1/admin/reports/refresh", s.admin(http.HandlerFunc(s.refreshReportsHandler)))
+	handle("/api/v1/reports/revenue", http.HandlerFunc(s.revenueReportHandler))
+	handle("/api/v1/reports/top-brands", http.HandlerFunc(s.topBrandsReportHandler))
+	handle("/api/v1/reports/top-products", http.HandlerFunc(s.topProductsReportHandler))
+	handle("/api/v1/reports/delivery-costs", http.HandlerFunc(s.deliveryCostsReportHandler))
+	handle("/api/v1/reports/customers", http.HandlerFunc(s.customersReportHandler))
+	mux.HandleFunc(apiV1, notFoundHandler)
+
+	// Legacy endpoints, kept until clients move to v1
+	handle("/api/health", http.HandlerFunc(s.healthHandler))
+	handle("/api/order/", http.HandlerFunc(s.getOrderHandler))
+	handle("/api/orders/stream", http.HandlerFunc(s.streamHandler))
+	handle("/api/orders/ws", http.HandlerFunc(s.websocketHandler))
+	handle("/api/orders/by-track/{track_number}", http.HandlerFunc(s.ordersByTrackHandler))
+	handle("/api/customers/{customer_id}/orders", http.HandlerFunc(s.customerOrdersHandler))
+	handle("/api/cache/stats", http.HandlerFunc(s.cacheStatsHandler))
+
+	handle("/api/openapi.json", http.HandlerFunc(openapi.Handler))
+	handle("/graphql", gql)
 
 	// Serve static files
 	fs := http.FileServer(http.Dir("./web/static"))
-	mux.Handle("/", fs)
+	mux.Handle("/", s.withCacheControl("/", fs))
 
-	log.Printf("Starting HTTP server on %s", addr)
-	return http.ListenAndServe(addr, mux)
+	return mux, patterns, nil
+}
+
+func (s *Server) withCacheControl(pattern string, handler http.Handler) http.Handler {
+	policy, ok := s.cacheControl[pattern]
+	if !ok {
+		return handler
+	}
+	return withCacheControl(policy, handler)
+}
+
+// validator loads the OpenAPI spec and reports routes it doesn't describe.
+func (s *Server) validator(patterns []string) (*openapi.Validator, error) {
+	doc, err := openapi.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, problem := range openapi.CheckRoutes(doc, patterns) {
+		log.Printf("OpenAPI spec is out of sync: %s", problem)
+	}
+
+	validator, err := openapi.NewValidator(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("Dev mode: validating requests and responses against the OpenAPI spec")
+	return validator, nil
 }
 
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, r, http.MethodGet)
 		return
 	}
 
@@ -54,6 +193,8 @@ func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// getOrderHandler serves the legacy order response with diagnostics in
+// the body.
 func (s *Server) getOrderHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
@@ -75,146 +216,133 @@ func (s *Server) getOrderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Fetching order: %s", orderUID)
-
-	var order *models.Order
-	var err error
-	var source string
-	var duration time.Duration
-
-	// Try cache first
-	cacheStart := time.Now()
-	order, err = s.cache.GetOrder(r.Context(), orderUID)
-	cacheDuration := time.Since(cacheStart)
-
-	if err != nil {
-		log.Printf("Error accessing cache: %v", err)
-	} else if order != nil {
-		source = "cache"
-		duration = cacheDuration
-	} else {
-		// If not in cache, try database
-		log.Printf("Order %s not found in cache, checking database", orderUID)
-		dbStart := time.Now()
-		order, err = s.db.GetOrder(r.Context(), orderUID)
-		dbDuration := time.Since(dbStart)
-
-		if err != nil {
-			log.Printf("Error retrieving order from database: %v", err)
-			http.Error(w, "Error retrieving order", http.StatusInternalServerError)
-			return
-		}
-
-		if order == nil {
-			log.Printf("Order %s not found in database", orderUID)
-			http.Error(w, "Order not found", http.StatusNotFound)
-			return
-		}
-
-		source = "database"
-		duration = dbDuration
-
-		// Save to cache for future requests
-		go func() {
-			if err := s.cache.SetOrder(context.Background(), order); err != nil {
-				log.Printf("Failed to set order in cache: %v", err)
-			}
-		}()
+	order, source, duration, ok := s.fetchOrder(w, r, orderUID)
+	if !ok {
+		return
 	}
 
 	totalDuration := time.Since(start)
 
 	// Add info about data source and time
 	response := map[string]interface{}{
-		"order":    order,
-		"source":   source,
+		"order":  order,
+		"source": source,
 		"timing": map[string]interface{}{
-			"total":    totalDuration.String(),
-			"fetch":    duration.String(),
-			"source":   source,
+			"total":  totalDuration.String(),
+			"fetch":  duration.String(),
+			"source": source,
 		},
 	}
 
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Link", fmt.Sprintf("<%sorders/%s>; rel=\"successor-version\"", apiV1, url.PathEscape(orderUID)))
+
+	// the body changes with every timing, so only the order part is tagged
+	orderJSON, err := json.Marshal(order)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Error encoding order", "")
+		return
+	}
+	tag := etag(orderJSON, true)
+	setValidators(w, tag, order.UpdatedAt)
+	if notModified(r, tag, order.UpdatedAt) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 
 	log.Printf("Order %s fetched from %s in %s (fetch: %s)", orderUID, source, totalDuration.String(), duration.String())
 }
 
-// New benchmark handler
-func (s *Server) benchmarkHandler(w http.ResponseWriter, r *http.Request) {
+// getOrderV1Handler returns the bare order. Where it came from and how long
+// that took are reported in the X-Data-Source and Server-Timing headers.
+func (s *Server) getOrderV1Handler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, r, http.MethodGet)
 		return
 	}
 
-	// orders ID for test (5 in cache, 5 in db)
-	cachedOrderIDs := []string{"test-order-1", "test-order-2", "test-order-3", "test-order-4", "test-order-5"}
-	dbOnlyOrderIDs := []string{"test-order-6", "test-order-7", "test-order-8", "test-order-9", "test-order-10"}
+	orderUID := r.PathValue("order_uid")
+	if orderUID == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Order ID is required", "")
+		return
+	}
 
-	// Preload first 5
-	ctx := context.Background()
-	for _, id := range cachedOrderIDs {
-		if order, err := s.db.GetOrder(ctx, id); err == nil && order != nil {
-			s.cache.SetOrder(ctx, order)
-		}
+	order, source, duration, ok := s.fetchOrder(w, r, orderUID)
+	if !ok {
+		return
+	}
+
+	body, err := json.Marshal(orderResponse{Order: order, Amounts: amountsOf(order, s.converter)})
+	if err != nil {
+		log.Printf("Failed to encode order %s: %v", orderUID, err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Error encoding order", "")
+		return
 	}
 
-	results := make(map[string]interface{})
-	totalCacheTime := time.Duration(0)
-	totalDBTime := time.Duration(0)
+	tag := etag(body, false)
+	setValidators(w, tag, order.UpdatedAt)
 
-	// test cache orders
-	for _, id := range cachedOrderIDs {
-		start := time.Now()
-		order, err := s.cache.GetOrder(ctx, id)
-		duration := time.Since(start)
+	totalDuration := time.Since(start)
+	w.Header().Set("X-Data-Source", source)
+	w.Header().Set("Server-Timing", fmt.Sprintf("%s;dur=%s, total;dur=%s", source, millis(duration), millis(totalDuration)))
 
-		if err == nil && order != nil {
-			totalCacheTime += duration
-			results[id] = map[string]interface{}{
-				"source":   "cache",
-				"duration": duration.String(),
-				"success":  true,
-			}
-		}
+	if notModified(r, tag, order.UpdatedAt) {
+		w.WriteHeader(http.StatusNotModified)
+		log.Printf("Order %s not modified (%s)", orderUID, source)
+		return
 	}
 
-	// test db orders
-	for _, id := range dbOnlyOrderIDs {
-		start := time.Now()
-		order, err := s.db.GetOrder(ctx, id)
-		duration := time.Since(start)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body)
+
+	log.Printf("Order %s fetched from %s in %s (fetch: %s)", orderUID, source, totalDuration.String(), duration.String())
+}
+
+// fetchOrder looks the order up and writes the error response when there is
+// nothing to return.
+func (s *Server) fetchOrder(w http.ResponseWriter, r *http.Request, orderUID string) (*models.Order, string, time.Duration, bool) {
+	log.Printf("Fetching order: %s", orderUID)
 
-		if err == nil && order != nil {
-			totalDBTime += duration
-			results[id] = map[string]interface{}{
-				"source":   "database",
-				"duration": duration.String(),
-				"success":  true,
-			}
-		}
+	order, source, duration, err := s.orders.GetOrder(r.Context(), orderUID)
+	if errors.Is(err, breaker.ErrOpen) {
+		log.Printf("Database is unavailable, order %s can't be served", orderUID)
+		w.Header().Set("Retry-After", "5")
+		writeError(w, r, http.StatusServiceUnavailable, CodeServiceUnavailable, "Service temporarily unavailable", "The order database is unavailable")
+		return nil, "", 0, false
+	} else if err != nil {
+		log.Printf("Error retrieving order from database: %v", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Error retrieving order", "")
+		return nil, "", 0, false
 	}
 
-	// calc mid time
-	avgCacheTime := totalCacheTime / time.Duration(len(cachedOrderIDs))
-	avgDBTime := totalDBTime / time.Duration(len(dbOnlyOrderIDs))
+	if order == nil {
+		log.Printf("Order %s not found", orderUID)
+		w.Header().Set("X-Data-Source", source)
+		writeError(w, r, http.StatusNotFound, CodeOrderNotFound, "Order not found", fmt.Sprintf("Order %s does not exist", orderUID))
+		return nil, "", 0, false
+	}
 
-	response := map[string]interface{}{
-		"results": results,
-		"summary": map[string]interface{}{
-			"cache_requests": len(cachedOrderIDs),
-			"db_requests":    len(dbOnlyOrderIDs),
-			"avg_cache_time": avgCacheTime.String(),
-			"avg_db_time":    avgDBTime.String(),
-			"speed_ratio":    float64(avgDBTime.Nanoseconds()) / float64(avgCacheTime.Nanoseconds()),
-		},
+	return order, source, duration, true
+}
+
+// millis formats a duration for Server-Timing, which uses milliseconds.
+func millis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// cacheStatsHandler reports hit rates of each lookup tier.
+func (s *Server) cacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
-
-	log.Printf("Benchmark completed: Cache avg=%s, DB avg=%s, Ratio=%.2fx faster",
-		avgCacheTime.String(), avgDBTime.String(),
-		float64(avgDBTime.Nanoseconds())/float64(avgCacheTime.Nanoseconds()))
+	json.NewEncoder(w).Encode(s.orders.Stats())
 }
@@ -0,0 +1,171 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"order-service/internal/events"
+
+	"github.com/gorilla/websocket"
+)
+
+const streamBuffer = 64
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	// failed handshakes get the same error body as the other endpoints
+	Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+		code := CodeInvalidRequest
+		if status == http.StatusMethodNotAllowed {
+			code = CodeMethodNotAllowed
+		}
+		writeError(w, r, status, code, http.StatusText(status), reason.Error())
+	},
+}
+
+// streamHandler pushes order events as Server-Sent Events. Clients resume
+// with the standard Last-Event-ID header or the resume query parameter.
+func (s *Server) streamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Streaming unsupported", "")
+		return
+	}
+
+	customerID := r.URL.Query().Get("customer_id")
+	orderUID := r.URL.Query().Get("order_uid")
+	resume := r.Header.Get("Last-Event-ID")
+	if resume == "" {
+		resume = r.URL.Query().Get("resume")
+	}
+
+	backlog, updates, unsubscribe := s.events.SubscribeFrom(resume, streamBuffer)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func(event events.OrderEvent) error {
+		if !event.Matches(customerID, orderUID) {
+			return nil
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		flusher.Flush()
+		return err
+	}
+
+	for _, event := range backlog {
+		if err := send(event); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(s.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-updates:
+			if !ok {
+				return
+			}
+			if err := send(event); err != nil {
+				log.Printf("Failed to write event: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// websocketHandler is the WebSocket equivalent of streamHandler. Each
+// message is one JSON-encoded event, heartbeats are ping frames.
+func (s *Server) websocketHandler(w http.ResponseWriter, r *http.Request) {
+	customerID := r.URL.Query().Get("customer_id")
+	orderUID := r.URL.Query().Get("order_uid")
+	resume := r.URL.Query().Get("resume")
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade to WebSocket: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	backlog, updates, unsubscribe := s.events.SubscribeFrom(resume, streamBuffer)
+	defer unsubscribe()
+
+	// the client never sends anything, but reading is needed to notice it leaving
+	closed := make(chan struct{})
+	conn.SetReadDeadline(time.Now().Add(2 * s.heartbeat))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * s.heartbeat))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(event events.OrderEvent) error {
+		if !event.Matches(customerID, orderUID) {
+			return nil
+		}
+		conn.SetWriteDeadline(time.Now().Add(s.heartbeat))
+		return conn.WriteJSON(event)
+	}
+
+	for _, event := range backlog {
+		if err := send(event); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(s.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-heartbeat.C:
+			deadline := time.Now().Add(s.heartbeat)
+			if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return
+			}
+		case event, ok := <-updates:
+			if !ok {
+				return
+			}
+			if err := send(event); err != nil {
+				log.Printf("Failed to write event: %v", err)
+				return
+			}
+		}
+	}
+}
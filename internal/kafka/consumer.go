@@ -2,91 +2,209 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
+	"strconv"
+	"sync"
 	"time"
 
-	"order-service/internal/models"
+	"order-service/internal/breaker"
 	"order-service/internal/database"
 
 	"github.com/segmentio/kafka-go"
 )
 
+// Headers added to the messages sent to a dead letter topic.
+const (
+	HeaderDLQTopic     = "dlq-original-topic"
+	HeaderDLQPartition = "dlq-original-partition"
+	HeaderDLQOffset    = "dlq-original-offset"
+	HeaderDLQError     = "dlq-error"
+	HeaderDLQAttempts  = "dlq-attempts"
+)
+
 type Consumer struct {
-	reader  *kafka.Reader
-	db      *database.PostgresRepository
-	timeout time.Duration
+	readers  []*kafka.Reader
+	dlq      *kafka.Writer
+	db       *database.PostgresRepository
+	handlers *Handlers
 }
 
-func NewConsumer(brokers []string, topic string, db *database.PostgresRepository) *Consumer {
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:     brokers,
-		Topic:       topic,
-		StartOffset: kafka.FirstOffset, // read from begin
-		MinBytes:    10e3,              // 10KB
-		MaxBytes:    10e6,              // 10MB
-		MaxWait:     1 * time.Second,
-	})
+// NewConsumer reads every topic registered in handlers as a member of the
+// consumer group groupID, so that replicas share the partitions instead of
+// each handling every message. dialer may be nil for plain connections.
+func NewConsumer(brokers []string, groupID string, dialer *kafka.Dialer, handlers *Handlers, db *database.PostgresRepository) *Consumer {
+	if dialer == nil {
+		dialer = kafka.DefaultDialer
+	}
+
+	var readers []*kafka.Reader
+	for _, topic := range handlers.Topics() {
+		readers = append(readers, kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     brokers,
+			Topic:       topic,
+			GroupID:     groupID,
+			Dialer:      dialer,
+			StartOffset: kafka.FirstOffset, // read from begin until the group has committed
+			MinBytes:    10e3,              // 10KB
+			MaxBytes:    10e6,              // 10MB
+			MaxWait:     1 * time.Second,
+		}))
+	}
 
 	return &Consumer{
-		reader:  reader,
-		db:      db,
-		timeout: 10 * time.Second,
+		readers: readers,
+		dlq: &kafka.Writer{
+			Addr:                   kafka.TCP(brokers...),
+			Transport:              NewTransport(dialer),
+			AllowAutoTopicCreation: true,
+		},
+		db:       db,
+		handlers: handlers,
 	}
 }
 
+// Start reads all topics until ctx is done.
 func (c *Consumer) Start(ctx context.Context) {
-	log.Println("Starting Kafka consumer...")
+	log.Printf("Starting Kafka consumer for %v...", c.handlers.Topics())
+
+	var wg sync.WaitGroup
+	for _, reader := range c.readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.consume(ctx, reader)
+		}()
+	}
+	wg.Wait()
+}
 
+func (c *Consumer) consume(ctx context.Context, reader *kafka.Reader) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			msg, err := c.reader.ReadMessage(ctx)
+			// don't fetch while the database can't take the messages
+			if !c.waitForDatabase(ctx) {
+				return
+			}
+
+			msg, err := reader.FetchMessage(ctx)
 			if err != nil {
-				log.Printf("Error reading message: %v", err)
+				log.Printf("Error reading message from %s: %v", reader.Config().Topic, err)
 				time.Sleep(5 * time.Second) // Пауза перед повторной попыткой
 				continue
 			}
 
-			log.Printf("Received message: %s", string(msg.Value))
+			log.Printf("Received message from %s: %s", msg.Topic, string(msg.Value))
 
-			if err := c.processMessage(ctx, msg.Value); err != nil {
-				log.Printf("Error processing message: %v", err)
+			if !c.handle(ctx, msg) {
+				return
+			}
+			// committed once handled, so a restart doesn't lose the message
+			if err := reader.CommitMessages(ctx, msg); err != nil {
+				log.Printf("Failed to commit message at %s/%d/%d: %v", msg.Topic, msg.Partition, msg.Offset, err)
 			}
 		}
 	}
 }
 
-func (c *Consumer) processMessage(ctx context.Context, data []byte) error {
-	log.Printf("Processing raw message: %s", string(data))
-	
-	var order models.Order
-	if err := json.Unmarshal(data, &order); err != nil {
-		log.Printf("Failed to unmarshal order: %v", err)
-		return fmt.Errorf("failed to unmarshal order: %v", err)
+// handle runs the handler of msg under its retry policy. It returns false if
+// ctx is done first.
+func (c *Consumer) handle(ctx context.Context, msg kafka.Message) bool {
+	handler, ok := c.handlers.route(msg)
+	if !ok {
+		log.Printf("No handler for message from %s (type %q), dropping it", msg.Topic, header(msg, HeaderMessageType))
+		return true
+	}
+
+	for attempt := 1; ; {
+		err := handler.Handle(ctx, msg)
+		if err == nil {
+			return true
+		}
+		log.Printf("Error processing %s message (attempt %d): %v", handler.Name, attempt, err)
+
+		// keep the message while the database breaker is open, without
+		// counting the attempt
+		if !c.db.Available() || errors.Is(err, breaker.ErrOpen) {
+			if !c.waitForDatabase(ctx) {
+				return false
+			}
+			continue
+		}
+
+		if IsInvalid(err) || attempt >= handler.Policy.MaxAttempts {
+			c.deadLetter(ctx, handler, msg, err, attempt)
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(handler.Policy.delay(attempt)):
+		}
+		attempt++
 	}
+}
 
-	// Data validation
-	if order.OrderUID == "" {
-		log.Printf("Order UID is empty")
-		return fmt.Errorf("order UID is required")
+// deadLetter sends a message that failed to the dead letter topic of its
+// handler, or drops it if there is none.
+func (c *Consumer) deadLetter(ctx context.Context, handler Handler, msg kafka.Message, cause error, attempts int) {
+	if handler.Policy.DLQTopic == "" {
+		log.Printf("Dropping %s message at %s/%d/%d: %v", handler.Name, msg.Topic, msg.Partition, msg.Offset, cause)
+		return
 	}
 
-	log.Printf("Processing order: %s", order.OrderUID)
+	dead := kafka.Message{
+		Topic: handler.Policy.DLQTopic,
+		Key:   msg.Key,
+		Value: msg.Value,
+		Headers: append(append([]kafka.Header(nil), msg.Headers...),
+			kafka.Header{Key: HeaderDLQTopic, Value: []byte(msg.Topic)},
+			kafka.Header{Key: HeaderDLQPartition, Value: []byte(strconv.Itoa(msg.Partition))},
+			kafka.Header{Key: HeaderDLQOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+			kafka.Header{Key: HeaderDLQError, Value: []byte(cause.Error())},
+			kafka.Header{Key: HeaderDLQAttempts, Value: []byte(strconv.Itoa(attempts))},
+		),
+	}
+	if err := c.dlq.WriteMessages(ctx, dead); err != nil {
+		log.Printf("Failed to send %s message to %s, dropping it: %v", handler.Name, handler.Policy.DLQTopic, err)
+		return
+	}
+	log.Printf("Sent %s message at %s/%d/%d to %s: %v", handler.Name, msg.Topic, msg.Partition, msg.Offset, handler.Policy.DLQTopic, cause)
+}
 
-	// save
-	if err := c.db.SaveOrder(ctx, &order); err != nil {
-		log.Printf("Failed to save order to database: %v", err)
-		return fmt.Errorf("failed to save order to database: %v", err)
+// waitForDatabase blocks while the database circuit breaker is open.
+// It returns false if ctx is done first.
+func (c *Consumer) waitForDatabase(ctx context.Context) bool {
+	if c.db.Available() {
+		return true
 	}
 
-	log.Printf("Successfully processed order %s", order.OrderUID)
-	return nil
+	log.Println("Database is unavailable, pausing consumer")
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			if c.db.Available() {
+				log.Println("Database is available again, resuming consumer")
+				return true
+			}
+		}
+	}
 }
 
 func (c *Consumer) Close() error {
-	return c.reader.Close()
+	var errs []error
+	for _, reader := range c.readers {
+		errs = append(errs, reader.Close())
+	}
+	errs = append(errs, c.dlq.Close())
+	return errors.Join(errs...)
 }
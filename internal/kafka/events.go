@@ -0,0 +1,154 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"order-service/internal/database"
+	"order-service/internal/models"
+	"order-service/internal/money"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// errOrderNotFound is retried: the order may still be on its way through the
+// orders topic.
+var errOrderNotFound = errors.New("order not found")
+
+// StatusEvent changes the status of the items of an order, of all of them
+// when ChrtIDs is empty.
+type StatusEvent struct {
+	OrderUID string `json:"order_uid"`
+	Status   int    `json:"status"`
+	ChrtIDs  []int  `json:"chrt_ids,omitempty"`
+}
+
+// PaymentEvent replaces the payment of an order.
+type PaymentEvent struct {
+	OrderUID string         `json:"order_uid"`
+	Payment  models.Payment `json:"payment"`
+}
+
+// CancellationEvent cancels every item of an order.
+type CancellationEvent struct {
+	OrderUID string `json:"order_uid"`
+	Reason   string `json:"reason"`
+}
+
+// ProcessStatus handles a message of the order-status topic.
+func (p *Processor) ProcessStatus(ctx context.Context, msg kafka.Message) error {
+	var event StatusEvent
+	if err := decodeEvent(msg, &event); err != nil {
+		return err
+	}
+	if event.Status <= 0 {
+		return Invalid(fmt.Errorf("status is required"))
+	}
+
+	return p.update(ctx, event.OrderUID, func(order *models.Order) error {
+		changed := 0
+		for i := range order.Items {
+			if len(event.ChrtIDs) == 0 || slices.Contains(event.ChrtIDs, order.Items[i].ChrtID) {
+				order.Items[i].Status = event.Status
+				changed++
+			}
+		}
+		if changed == 0 {
+			return Invalid(fmt.Errorf("order %s has none of the items %v", order.OrderUID, event.ChrtIDs))
+		}
+		return nil
+	})
+}
+
+// ProcessPayment handles a message of the payment-events topic.
+func (p *Processor) ProcessPayment(ctx context.Context, msg kafka.Message) error {
+	var event PaymentEvent
+	if err := decodeEvent(msg, &event); err != nil {
+		return err
+	}
+	if event.Payment.Transaction == "" {
+		return Invalid(fmt.Errorf("payment transaction is required"))
+	}
+	// amounts are minor units of this currency, as for whole orders
+	currency, err := money.Lookup(event.Payment.Currency)
+	if err != nil {
+		return Invalid(fmt.Errorf("payment: %v", err))
+	}
+	event.Payment.Currency = currency.Code
+
+	return p.update(ctx, event.OrderUID, func(order *models.Order) error {
+		order.Payment = event.Payment
+		return nil
+	})
+}
+
+// ProcessCancellation handles a message of the cancellations topic.
+func (p *Processor) ProcessCancellation(ctx context.Context, msg kafka.Message) error {
+	var event CancellationEvent
+	if err := decodeEvent(msg, &event); err != nil {
+		return err
+	}
+
+	return p.update(ctx, event.OrderUID, func(order *models.Order) error {
+		log.Printf("Canceling order %s: %s", order.OrderUID, event.Reason)
+		for i := range order.Items {
+			order.Items[i].Status = models.ItemStatusCanceled
+		}
+		return nil
+	})
+}
+
+// updateAttempts is how many times update reads the order again when
+// another replica saved it in the meantime.
+const updateAttempts = 5
+
+// update applies change to the stored order and saves it like a new version
+// received on the orders topic. Events of one order arrive on different
+// topics and may be handled by different replicas, so the save only goes
+// ahead if the order is still the version that was read; the change is
+// made again to the newer one otherwise.
+func (p *Processor) update(ctx context.Context, orderUID string, change func(*models.Order) error) error {
+	unlock := p.lock(orderUID)
+	defer unlock()
+
+	for attempt := 1; ; attempt++ {
+		// the replica may not have the previous event yet
+		order, err := p.db.GetOrder(database.Primary(ctx), orderUID)
+		if err != nil {
+			return fmt.Errorf("failed to load order %s: %w", orderUID, err)
+		}
+		if order == nil {
+			return fmt.Errorf("%w: %s", errOrderNotFound, orderUID)
+		}
+
+		readAt := order.UpdatedAt
+		if err := change(order); err != nil {
+			return err
+		}
+		err = p.apply(ctx, order, readAt)
+		if !errors.Is(err, database.ErrConflict) || attempt == updateAttempts {
+			return err
+		}
+		log.Printf("Order %s was changed while it was updated, retrying", orderUID)
+	}
+}
+
+// decodeEvent unmarshals a JSON event that must name an order.
+func decodeEvent(msg kafka.Message, event any) error {
+	if err := json.Unmarshal(msg.Value, event); err != nil {
+		return Invalid(fmt.Errorf("failed to unmarshal event: %v", err))
+	}
+
+	var target struct {
+		OrderUID string `json:"order_uid"`
+	}
+	json.Unmarshal(msg.Value, &target)
+	if target.OrderUID == "" {
+		return Invalid(fmt.Errorf("order UID is required"))
+	}
+	return nil
+}
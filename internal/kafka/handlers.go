@@ -0,0 +1,118 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// HeaderMessageType routes a message to the handler registered for its type
+// instead of the one of its topic.
+const HeaderMessageType = "message-type"
+
+// Policy is what happens when a handler fails: transient errors are retried
+// MaxAttempts times in total with exponential backoff from Backoff up to
+// MaxBackoff, then the message goes to DLQTopic, or is dropped when it is
+// empty. Invalid messages go there right away.
+type Policy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	DLQTopic    string
+}
+
+// delay is the pause after the given failed attempt.
+func (p Policy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxBackoff)
+}
+
+// HandlerFunc processes one message.
+type HandlerFunc func(ctx context.Context, msg kafka.Message) error
+
+// Handler is a processing function with its failure policy.
+type Handler struct {
+	Name   string
+	Handle HandlerFunc
+	Policy Policy
+}
+
+// invalidError marks a message that will never succeed, so it is not
+// retried.
+type invalidError struct {
+	err error
+}
+
+func (e invalidError) Error() string { return e.err.Error() }
+func (e invalidError) Unwrap() error { return e.err }
+
+// Invalid marks err as caused by the message itself rather than by the
+// environment.
+func Invalid(err error) error {
+	return invalidError{err: err}
+}
+
+// IsInvalid reports whether err was marked with Invalid.
+func IsInvalid(err error) bool {
+	var invalid invalidError
+	return errors.As(err, &invalid)
+}
+
+// Handlers maps topics and message types to handlers.
+type Handlers struct {
+	byTopic map[string]Handler
+	byType  map[string]Handler
+}
+
+func NewHandlers() *Handlers {
+	return &Handlers{byTopic: make(map[string]Handler), byType: make(map[string]Handler)}
+}
+
+// HandleTopic registers the handler of every message on topic.
+func (h *Handlers) HandleTopic(topic string, handler Handler) {
+	h.byTopic[topic] = handler
+}
+
+// HandleType registers the handler of messages whose message-type header is
+// messageType, whatever topic they come from.
+func (h *Handlers) HandleType(messageType string, handler Handler) {
+	h.byType[messageType] = handler
+}
+
+// Topics lists the topics to subscribe to.
+func (h *Handlers) Topics() []string {
+	topics := make([]string, 0, len(h.byTopic))
+	for topic := range h.byTopic {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// route finds the handler of a message.
+func (h *Handlers) route(msg kafka.Message) (Handler, bool) {
+	if messageType := header(msg, HeaderMessageType); messageType != "" {
+		if handler, ok := h.byType[messageType]; ok {
+			return handler, true
+		}
+	}
+	handler, ok := h.byTopic[msg.Topic]
+	return handler, ok
+}
+
+// header returns the value of the first header with the key, ignoring case.
+func header(msg kafka.Message, key string) string {
+	for _, h := range msg.Headers {
+		if strings.EqualFold(h.Key, key) {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,108 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"order-service/internal/cache"
+	"order-service/internal/database"
+	"order-service/internal/decoder"
+	"order-service/internal/events"
+	"order-service/internal/models"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Processor applies order messages: it validates them, saves the order,
+// drops cached copies and announces the change. The consumer and replays
+// share it, so reprocessed history goes through the same code.
+type Processor struct {
+	db       *database.PostgresRepository
+	cache    cache.Cache
+	events   *events.Broker
+	decoders *decoder.Registry
+	locks    [64]sync.Mutex
+}
+
+// NewProcessor creates a processor. cache and broker may be nil.
+func NewProcessor(db *database.PostgresRepository, cache cache.Cache, broker *events.Broker, decoders *decoder.Registry) *Processor {
+	return &Processor{db: db, cache: cache, events: broker, decoders: decoders}
+}
+
+// Process handles one message.
+func (p *Processor) Process(ctx context.Context, msg kafka.Message) error {
+	log.Printf("Processing raw message: %s", string(msg.Value))
+
+	order, err := p.Decode(msg)
+	if err != nil {
+		log.Printf("Rejected order: %v", err)
+		return Invalid(err)
+	}
+
+	unlock := p.lock(order.OrderUID)
+	defer unlock()
+	return p.Apply(ctx, order)
+}
+
+// Decode validates a message and turns it into an order, using the decoder
+// and schema version named by its headers.
+func (p *Processor) Decode(msg kafka.Message) (*models.Order, error) {
+	return p.decoders.Decode(header(msg, decoder.HeaderContentType), header(msg, decoder.HeaderSchemaVersion), msg.Value)
+}
+
+// Apply saves an already validated order.
+func (p *Processor) Apply(ctx context.Context, order *models.Order) error {
+	return p.apply(ctx, order, time.Time{})
+}
+
+// apply saves the order, with readAt set only if it is still the version
+// read at readAt; database.ErrConflict is returned as is otherwise.
+func (p *Processor) apply(ctx context.Context, order *models.Order, readAt time.Time) error {
+	log.Printf("Processing order: %s", order.OrderUID)
+
+	// save
+	created, err := p.db.UpdateOrder(ctx, order, readAt)
+	if errors.Is(err, database.ErrConflict) {
+		return err
+	} else if err != nil {
+		log.Printf("Failed to save order to database: %v", err)
+		return fmt.Errorf("failed to save order to database: %v", err)
+	}
+
+	// drop stale copies from every cache tier
+	if p.cache != nil {
+		if err := p.cache.InvalidateOrder(ctx, order.OrderUID); err != nil {
+			log.Printf("Failed to invalidate cached order %s: %v", order.OrderUID, err)
+		}
+		if err := p.cache.InvalidateLookups(ctx, cache.LookupKeys(order)); err != nil {
+			log.Printf("Failed to invalidate lookups of order %s: %v", order.OrderUID, err)
+		}
+	}
+
+	if p.events != nil {
+		eventType := events.TypeUpdated
+		if created {
+			eventType = events.TypeCreated
+		}
+		p.events.Publish(ctx, eventType, order)
+	}
+
+	log.Printf("Successfully processed order %s", order.OrderUID)
+	return nil
+}
+
+// lock serializes the changes of one order within the process, so that
+// events applied to it by different handlers rarely conflict; across
+// replicas the conditional save of update keeps them apart.
+func (p *Processor) lock(orderUID string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(orderUID))
+	mu := &p.locks[h.Sum32()%uint32(len(p.locks))]
+	mu.Lock()
+	return mu.Unlock
+}
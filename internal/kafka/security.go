@@ -0,0 +1,114 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// SASL mechanisms.
+const (
+	SASLPlain       = "PLAIN"
+	SASLScramSHA256 = "SCRAM-SHA-256"
+	SASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+// Security holds how to connect to the brokers. The zero value is a plain
+// connection without authentication.
+type Security struct {
+	TLS bool
+	// CAFile verifies the brokers instead of the system roots.
+	CAFile string
+	// CertFile and KeyFile are the client certificate for mutual TLS.
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+	// SASLMechanism is empty for no authentication, or one of the SASL
+	// constants.
+	SASLMechanism string
+	Username      string
+	Password      string
+}
+
+// TLSConfig returns nil when TLS is off.
+func (s Security) TLSConfig() (*tls.Config, error) {
+	if !s.TLS {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: s.InsecureSkipVerify,
+	}
+	if s.CAFile != "" {
+		pem, err := os.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read CA file: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates in CA file %s", s.CAFile)
+		}
+	}
+	if s.CertFile != "" || s.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// Mechanism returns nil when SASL is off.
+func (s Security) Mechanism() (sasl.Mechanism, error) {
+	switch strings.ToUpper(s.SASLMechanism) {
+	case "":
+		return nil, nil
+	case SASLPlain:
+		return plain.Mechanism{Username: s.Username, Password: s.Password}, nil
+	case SASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, s.Username, s.Password)
+	case SASLScramSHA512:
+		return scram.Mechanism(scram.SHA512, s.Username, s.Password)
+	default:
+		return nil, fmt.Errorf("Unknown SASL mechanism %q", s.SASLMechanism)
+	}
+}
+
+// NewDialer builds the dialer of readers and admin connections. Writers get
+// the same settings from NewTransport.
+func NewDialer(security Security) (*kafka.Dialer, error) {
+	tlsConfig, err := security.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	mechanism, err := security.Mechanism()
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Dialer{
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		TLS:           tlsConfig,
+		SASLMechanism: mechanism,
+	}, nil
+}
+
+// NewTransport returns a writer transport connecting like dialer.
+func NewTransport(dialer *kafka.Dialer) *kafka.Transport {
+	return &kafka.Transport{
+		DialTimeout: dialer.Timeout,
+		TLS:         dialer.TLS,
+		SASL:        dialer.SASLMechanism,
+	}
+}
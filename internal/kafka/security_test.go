@@ -0,0 +1,290 @@
+package kafka
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestDialerTrustsCA(t *testing.T) {
+	ca := newTestCA(t, "broker CA")
+	addr, handshakes := serveTLS(t, ca.issue(t, "broker", false), nil)
+
+	dialer, err := NewDialer(Security{TLS: true, CAFile: ca.file(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dial(t, dialer, addr)
+	if err := <-handshakes; err != nil {
+		t.Fatalf("broker handshake: %v", err)
+	}
+}
+
+func TestDialerRejectsUntrustedCA(t *testing.T) {
+	ca := newTestCA(t, "broker CA")
+	other := newTestCA(t, "other CA")
+	addr, _ := serveTLS(t, ca.issue(t, "broker", false), nil)
+
+	dialer, err := NewDialer(Security{TLS: true, CAFile: other.file(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err == nil {
+		conn.Close()
+		t.Fatal("connected to a broker signed by an untrusted CA")
+	}
+	var unknown x509.UnknownAuthorityError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("error is not about the CA: %v", err)
+	}
+
+	insecure, err := NewDialer(Security{TLS: true, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dial(t, insecure, addr)
+}
+
+func TestDialerMutualTLS(t *testing.T) {
+	ca := newTestCA(t, "broker CA")
+	clients := newTestCA(t, "client CA")
+	client := clients.issue(t, "order-service", true)
+	addr, handshakes := serveTLS(t, ca.issue(t, "broker", false), clients.pool())
+
+	certFile, keyFile := certFiles(t, client)
+	dialer, err := NewDialer(Security{TLS: true, CAFile: ca.file(t), CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dial(t, dialer, addr)
+	if err := <-handshakes; err != nil {
+		t.Fatalf("broker rejected the client certificate: %v", err)
+	}
+
+	// without the certificate the broker refuses the connection
+	anonymous, err := NewDialer(Security{TLS: true, CAFile: ca.file(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if conn, err := anonymous.DialContext(ctx, "tcp", addr); err == nil {
+		conn.Close()
+	}
+	if err := <-handshakes; err == nil {
+		t.Fatal("broker accepted a client without a certificate")
+	}
+}
+
+func TestSecurityFiles(t *testing.T) {
+	if _, err := NewDialer(Security{TLS: true, CAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("missing CA file accepted")
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(empty, []byte("no certificates"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDialer(Security{TLS: true, CAFile: empty}); err == nil {
+		t.Error("CA file without certificates accepted")
+	}
+	if _, err := NewDialer(Security{TLS: true, CertFile: empty, KeyFile: empty}); err == nil {
+		t.Error("invalid client certificate accepted")
+	}
+
+	dialer, err := NewDialer(Security{CAFile: empty})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dialer.TLS != nil {
+		t.Error("TLS configured while it is off")
+	}
+}
+
+func TestSecurityMechanism(t *testing.T) {
+	for _, name := range []string{SASLPlain, SASLScramSHA256, "scram-sha-512"} {
+		mechanism, err := Security{SASLMechanism: name, Username: "user", Password: "secret"}.Mechanism()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if mechanism == nil {
+			t.Errorf("%s: no mechanism", name)
+		}
+	}
+
+	if mechanism, err := (Security{}).Mechanism(); err != nil || mechanism != nil {
+		t.Errorf("no mechanism configured, got %v, %v", mechanism, err)
+	}
+
+	if _, err := NewDialer(Security{SASLMechanism: "GSSAPI"}); err == nil {
+		t.Error("unknown SASL mechanism accepted")
+	}
+}
+
+// dial connects and closes the connection, failing the test on an error.
+func dial(t *testing.T, dialer *kafka.Dialer, addr string) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+// serveTLS accepts TLS connections as a broker with cert would, requiring
+// client certificates signed by clientCAs if set, and reports the result of
+// every handshake.
+func serveTLS(t *testing.T, cert tls.Certificate, clientCAs *x509.CertPool) (string, <-chan error) {
+	t.Helper()
+
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if clientCAs != nil {
+		config.ClientCAs = clientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	handshakes := make(chan error, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			handshakes <- conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String(), handshakes
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+
+	key := newKey(t)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, der: der}
+}
+
+// issue signs a certificate for 127.0.0.1 and localhost, or a client
+// certificate.
+func (ca *testCA) issue(t *testing.T, name string, client bool) tls.Certificate {
+	t.Helper()
+
+	key := newKey(t)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if client {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.DNSNames = []string{"localhost"}
+		template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// file writes the CA certificate as PEM, as Security.CAFile expects.
+func (ca *testCA) file(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	writePEM(t, path, "CERTIFICATE", ca.der)
+	return path
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// certFiles writes a certificate and its key as Security.CertFile and
+// Security.KeyFile expect.
+func certFiles(t *testing.T, cert tls.Certificate) (string, string) {
+	t.Helper()
+
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", cert.Certificate[0])
+	writePEM(t, keyFile, "PRIVATE KEY", key)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -17,6 +17,8 @@ type Order struct {
 	SmID				int			`json:"sm_id"`
 	DateCreated			time.Time	`json:"date_created"`
 	OofShard			string		`json:"oof_shard"`
+	// set by the database on every save, not part of incoming messages
+	UpdatedAt			time.Time	`json:"updated_at,omitzero"`
 }
 
 type Delivery struct {
@@ -29,6 +31,7 @@ type Delivery struct {
 	Email				string		`json:"email"`
 }
 
+// Payment amounts are minor units of Currency: 1817 USD is $18.17.
 type Payment struct {
 	Transaction			string		`json:"transaction"`
 	RequestID			string		`json:"request_id"`
@@ -42,6 +45,7 @@ type Payment struct {
 	CustomFee			int			`json:"custom_fee"`
 }
 
+// Item prices are minor units of the payment currency of the order.
 type Item struct {
 	ChrtID				int			`json:"chrt_id"`
 	TrackNumber			string		`json:"track_number"`
@@ -55,3 +59,6 @@ type Item struct {
 	Brand				string		`json:"brand"`
 	Status				int			`json:"status"`
 }
+
+// ItemStatusCanceled is the status of the items of a canceled order.
+const ItemStatusCanceled = 410
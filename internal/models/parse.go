@@ -0,0 +1,31 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"order-service/internal/money"
+)
+
+// ParseOrder decodes an incoming order message and checks the fields every
+// order must have. The consumer and the importer accept exactly the same
+// payloads.
+func ParseOrder(data []byte) (*Order, error) {
+	var order Order
+	if err := json.Unmarshal(data, &order); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal order: %v", err)
+	}
+
+	if order.OrderUID == "" {
+		return nil, fmt.Errorf("order UID is required")
+	}
+
+	// amounts are minor units of this currency
+	currency, err := money.Lookup(order.Payment.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("payment: %v", err)
+	}
+	order.Payment.Currency = currency.Code
+
+	return &order, nil
+}
@@ -0,0 +1,51 @@
+package money
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Currency is an ISO 4217 currency. MinorUnits is the number of decimal
+// digits of its minor unit: 2 for USD cents, 0 for JPY, 3 for KWD fils.
+type Currency struct {
+	Code       string
+	MinorUnits int
+}
+
+// Lookup finds a currency by its alphabetic code, in any case.
+func Lookup(code string) (Currency, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	minor, ok := minorUnits[code]
+	if !ok {
+		return Currency{}, fmt.Errorf("unknown currency %q", code)
+	}
+	return Currency{Code: code, MinorUnits: minor}, nil
+}
+
+// minorUnits lists the active ISO 4217 currencies. Most have two decimals,
+// so only the others are spelled out below.
+var minorUnits = func() map[string]int {
+	units := make(map[string]int)
+	for _, code := range strings.Fields(`
+		AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BMD BND BOB BOV
+		BRL BSD BTN BWP BYN BZD CAD CDF CHE CHF CHW CNY COP COU CRC CUP CVE CZK
+		DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GTQ GYD HKD HNL
+		HTG HUF IDR ILS INR IRR JMD KES KGS KHR KPW KYD KZT LAK LBP LKR LRD LSL
+		MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MXV MYR MZN NAD NGN NIO
+		NOK NPR NZD PAB PEN PGK PHP PKR PLN QAR RON RSD RUB SAR SBD SCR SDG SEK
+		SGD SHP SLE SOS SRD SSP STN SVC SYP SZL THB TJS TMT TOP TRY TTD TWD TZS
+		UAH USD USN UYU UZS VED VES WST XCD XCG YER ZAR ZMW ZWG`) {
+		units[code] = 2
+	}
+	for _, code := range strings.Fields(`
+		BIF CLP DJF GNF ISK JPY KMF KRW PYG RWF UGX UYI VND VUV XAF XOF XPF`) {
+		units[code] = 0
+	}
+	for _, code := range strings.Fields(`BHD IQD JOD KWD LYD OMR TND`) {
+		units[code] = 3
+	}
+	for _, code := range strings.Fields(`CLF UYW`) {
+		units[code] = 4
+	}
+	return units
+}()
@@ -0,0 +1,77 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ErrOverflow is returned by conversions whose result doesn't fit an Amount.
+var ErrOverflow = errors.New("amount out of range")
+
+// Amount is an exact sum of money in minor units of its currency, which is
+// also the unit of the amounts in order messages.
+type Amount struct {
+	Minor    int64
+	Currency Currency
+}
+
+// String formats the amount with all the decimals of its currency, e.g.
+// "18.17" for 1817 USD cents or "1817" for 1817 JPY.
+func (a Amount) String() string {
+	digits := strconv.FormatInt(a.Minor, 10)
+	sign := ""
+	if a.Minor < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	if a.Currency.MinorUnits == 0 {
+		return sign + digits
+	}
+	if pad := a.Currency.MinorUnits + 1 - len(digits); pad > 0 {
+		digits = strings.Repeat("0", pad) + digits
+	}
+	point := len(digits) - a.Currency.MinorUnits
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// MarshalJSON writes the decimal value as a string so it survives clients
+// that parse numbers as floats, next to the exact minor units.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Value    string `json:"value"`
+		Minor    int64  `json:"minor"`
+		Currency string `json:"currency"`
+	}{a.String(), a.Minor, a.Currency.Code})
+}
+
+// Convert multiplies the amount by rate, the price of one unit of a's
+// currency in units of to, rounding half away from zero to the minor unit
+// of to. It fails with ErrOverflow instead of wrapping around.
+func (a Amount) Convert(rate *big.Rat, to Currency) (Amount, error) {
+	v := new(big.Rat).SetInt64(a.Minor)
+	v.Mul(v, rate)
+	v.Mul(v, new(big.Rat).SetFrac64(pow10(to.MinorUnits), pow10(a.Currency.MinorUnits)))
+
+	// round |v| half up, then restore the sign
+	num := new(big.Int).Abs(v.Num())
+	num.Mul(num, big.NewInt(2))
+	num.Add(num, v.Denom())
+	num.Quo(num, new(big.Int).Mul(v.Denom(), big.NewInt(2)))
+	if v.Sign() < 0 {
+		num.Neg(num)
+	}
+	if !num.IsInt64() {
+		return Amount{}, ErrOverflow
+	}
+	return Amount{Minor: num.Int64(), Currency: to}, nil
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for range n {
+		p *= 10
+	}
+	return p
+}
@@ -0,0 +1,59 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestAmountString(t *testing.T) {
+	usd, _ := Lookup("usd")
+	jpy, _ := Lookup("JPY")
+	kwd, _ := Lookup("KWD")
+
+	for _, tc := range []struct {
+		amount Amount
+		want   string
+	}{
+		{Amount{1817, usd}, "18.17"},
+		{Amount{5, usd}, "0.05"},
+		{Amount{-1817, usd}, "-18.17"},
+		{Amount{1817, jpy}, "1817"},
+		{Amount{1817, kwd}, "1.817"},
+	} {
+		if got := tc.amount.String(); got != tc.want {
+			t.Errorf("%d %s is %q, want %q", tc.amount.Minor, tc.amount.Currency.Code, got, tc.want)
+		}
+	}
+}
+
+func TestAmountConvert(t *testing.T) {
+	usd, _ := Lookup("USD")
+	jpy, _ := Lookup("JPY")
+	kwd, _ := Lookup("KWD")
+
+	for _, tc := range []struct {
+		amount Amount
+		rate   *big.Rat
+		to     Currency
+		want   int64
+	}{
+		{Amount{1817, usd}, big.NewRat(150, 1), jpy, 2726},   // 2725.5 yen
+		{Amount{-1817, usd}, big.NewRat(150, 1), jpy, -2726}, // half away from zero
+		{Amount{1000, jpy}, big.NewRat(1, 150), usd, 667},    // 6.666... dollars
+		{Amount{1817, usd}, big.NewRat(3, 10), kwd, 5451},
+	} {
+		got, err := tc.amount.Convert(tc.rate, tc.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Minor != tc.want || got.Currency != tc.to {
+			t.Errorf("%s %s at %s is %d %s, want %d", tc.amount, tc.amount.Currency.Code, tc.rate, got.Minor, got.Currency.Code, tc.want)
+		}
+	}
+
+	if _, err := (Amount{math.MaxInt64 / 2, usd}).Convert(big.NewRat(1000, 1), jpy); !errors.Is(err, ErrOverflow) {
+		t.Errorf("overflowing conversion returned %v", err)
+	}
+}
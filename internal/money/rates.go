@@ -0,0 +1,112 @@
+package money
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Rate is the price of one unit of Base in units of Quote from ValidFrom on.
+type Rate struct {
+	Base      string
+	Quote     string
+	Rate      *big.Rat
+	ValidFrom time.Time
+}
+
+type pair struct{ base, quote string }
+
+// Rates is an immutable exchange rate table.
+type Rates struct {
+	pairs map[pair][]Rate // by ValidFrom
+}
+
+func NewRates(rates []Rate) *Rates {
+	r := &Rates{pairs: make(map[pair][]Rate)}
+	for _, rate := range rates {
+		p := pair{rate.Base, rate.Quote}
+		r.pairs[p] = append(r.pairs[p], rate)
+	}
+	for _, list := range r.pairs {
+		sort.Slice(list, func(i, j int) bool { return list[i].ValidFrom.Before(list[j].ValidFrom) })
+	}
+	return r
+}
+
+// Find returns the rate from base to quote in effect at the given time. A
+// stored quote→base rate is inverted when there is no direct one.
+func (r *Rates) Find(base, quote string, at time.Time) (Rate, bool) {
+	if base == quote {
+		return Rate{Base: base, Quote: quote, Rate: big.NewRat(1, 1)}, true
+	}
+	if rate, ok := r.find(pair{base, quote}, at); ok {
+		return rate, true
+	}
+	if rate, ok := r.find(pair{quote, base}, at); ok && rate.Rate.Sign() != 0 {
+		return Rate{Base: base, Quote: quote, Rate: new(big.Rat).Inv(rate.Rate), ValidFrom: rate.ValidFrom}, true
+	}
+	return Rate{}, false
+}
+
+func (r *Rates) find(p pair, at time.Time) (Rate, bool) {
+	list := r.pairs[p]
+	i := sort.Search(len(list), func(i int) bool { return list[i].ValidFrom.After(at) })
+	if i == 0 {
+		return Rate{}, false
+	}
+	return list[i-1], true
+}
+
+// Converter converts amounts to the reporting currency with rates reloaded
+// from a store, so new rates apply without a restart.
+type Converter struct {
+	reporting Currency
+	load      func(ctx context.Context) ([]Rate, error)
+	rates     atomic.Pointer[Rates]
+}
+
+func NewConverter(reporting Currency, load func(ctx context.Context) ([]Rate, error)) *Converter {
+	c := &Converter{reporting: reporting, load: load}
+	c.rates.Store(NewRates(nil))
+	return c
+}
+
+// Reporting is the currency amounts are converted to.
+func (c *Converter) Reporting() Currency {
+	return c.reporting
+}
+
+// Refresh reloads the rates. The previous table stays in use on errors.
+func (c *Converter) Refresh(ctx context.Context) error {
+	rates, err := c.load(ctx)
+	if err != nil {
+		return err
+	}
+	c.rates.Store(NewRates(rates))
+	return nil
+}
+
+// Run refreshes the rates every interval until ctx is done.
+func (c *Converter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Refresh(ctx); err != nil {
+				log.Printf("Failed to refresh exchange rates: %v", err)
+			}
+		}
+	}
+}
+
+// Rate finds the rate to the reporting currency at the given time.
+func (c *Converter) Rate(from Currency, at time.Time) (Rate, bool) {
+	return c.rates.Load().Find(from.Code, c.reporting.Code, at)
+}
@@ -0,0 +1,189 @@
+package openapi
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+)
+
+// Spec is the OpenAPI 3 description of the REST API. It is the contract:
+// handlers change together with it.
+//
+//go:embed openapi.json
+var Spec []byte
+
+// Load parses and validates Spec.
+func Load() (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(Spec)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse OpenAPI spec: %w", err)
+	}
+
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("Invalid OpenAPI spec: %w", err)
+	}
+
+	return doc, nil
+}
+
+// Handler serves the spec as JSON.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(Spec)
+}
+
+// Validator checks requests and responses against the spec.
+type Validator struct {
+	router routers.Router
+}
+
+func NewValidator(doc *openapi3.T) (*Validator, error) {
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to build OpenAPI router: %w", err)
+	}
+
+	return &Validator{router: router}, nil
+}
+
+// Middleware rejects requests that don't match the spec with 400 and
+// replaces responses that don't match it with 500, so drift between the
+// handlers and the contract shows up immediately. It is meant for
+// development: every response is buffered. Paths missing from the spec and
+// streaming operations (marked with x-streaming) are passed through.
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, pathParams, err := v.router.FindRoute(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, streaming := route.Operation.Extensions["x-streaming"]; streaming {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			log.Printf("Request %s %s violates the OpenAPI spec: %v", r.Method, r.URL.Path, err)
+			http.Error(w, fmt.Sprintf("Request does not match the API spec: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		rec := newRecorder()
+		next.ServeHTTP(rec, r)
+
+		err = v.ValidateResponse(r.Context(), input, rec.status, rec.header, rec.body.Bytes())
+		if err != nil {
+			log.Printf("Response to %s %s violates the OpenAPI spec: %v", r.Method, r.URL.Path, err)
+			http.Error(w, fmt.Sprintf("Response does not match the API spec: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		rec.copyTo(w)
+	})
+}
+
+// ValidateResponse checks one response of a request already matched to a route.
+func (v *Validator) ValidateResponse(ctx context.Context, input *openapi3filter.RequestValidationInput, status int, header http.Header, body []byte) error {
+	resp := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 status,
+		Header:                 header,
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+	}
+	resp.SetBodyBytes(body)
+
+	return openapi3filter.ValidateResponse(ctx, resp)
+}
+
+// FindRoute matches a request to an operation of the spec.
+func (v *Validator) FindRoute(r *http.Request) (*routers.Route, map[string]string, error) {
+	return v.router.FindRoute(r)
+}
+
+// CheckRoutes compares the mux patterns with the paths in the spec and
+// returns a description of every mismatch.
+func CheckRoutes(doc *openapi3.T, patterns []string) []string {
+	var problems []string
+
+	// a spec path is served either by a pattern with the same wildcards or,
+	// for the legacy routes, by a prefix pattern: "/api/order/{order_uid}"
+	// is served by "/api/order/"
+	specPatterns := make(map[string]string)
+	for path := range doc.Paths.Map() {
+		specPatterns[path] = path
+		if i := strings.Index(path, "{"); i >= 0 {
+			specPatterns[path[:i]] = path
+		}
+	}
+
+	served := make(map[string]bool)
+	for _, pattern := range patterns {
+		path, ok := specPatterns[pattern]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("route %s is not in the OpenAPI spec", pattern))
+			continue
+		}
+		served[path] = true
+	}
+
+	for path := range doc.Paths.Map() {
+		if !served[path] {
+			problems = append(problems, fmt.Sprintf("spec path %s has no handler", path))
+		}
+	}
+
+	return problems
+}
+
+// recorder buffers a response so it can be validated before being sent.
+type recorder struct {
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func newRecorder() *recorder {
+	return &recorder{status: http.StatusOK, header: make(http.Header)}
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+}
+
+func (r *recorder) copyTo(w http.ResponseWriter) {
+	for key, values := range r.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(r.status)
+	w.Write(r.body.Bytes())
+}
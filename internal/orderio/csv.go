@@ -0,0 +1,75 @@
+package orderio
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"order-service/internal/models"
+)
+
+var csvHeader = []string{
+	"order_uid", "track_number", "entry", "locale", "internal_signature",
+	"customer_id", "delivery_service", "shardkey", "sm_id", "date_created", "oof_shard",
+	"delivery_name", "delivery_phone", "delivery_zip", "delivery_city",
+	"delivery_address", "delivery_region", "delivery_email",
+	"payment_transaction", "payment_request_id", "payment_currency", "payment_provider",
+	"payment_amount", "payment_dt", "payment_bank", "payment_delivery_cost",
+	"payment_goods_total", "payment_custom_fee",
+	"item_chrt_id", "item_track_number", "item_price", "item_rid", "item_name",
+	"item_sale", "item_size", "item_total_price", "item_nm_id", "item_brand", "item_status",
+}
+
+// CSVWriter flattens orders into one row per item, repeating the order
+// columns. An order without items still gets a row, with empty item columns.
+type CSVWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{w: csv.NewWriter(w)}
+}
+
+func (w *CSVWriter) Write(order *models.Order) error {
+	if !w.wroteHeader {
+		if err := w.w.Write(csvHeader); err != nil {
+			return err
+		}
+		w.wroteHeader = true
+	}
+
+	d, p := order.Delivery, order.Payment
+	row := []string{
+		order.OrderUID, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
+		order.CustomerID, order.DeliveryService, order.Shardkey, strconv.Itoa(order.SmID),
+		order.DateCreated.Format(time.RFC3339), order.OofShard,
+		d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email,
+		p.Transaction, p.RequestID, p.Currency, p.Provider, strconv.Itoa(p.Amount),
+		strconv.FormatInt(p.PaymentDt, 10), p.Bank, strconv.Itoa(p.DeliveryCost),
+		strconv.Itoa(p.GoodsTotal), strconv.Itoa(p.CustomFee),
+	}
+	orderColumns := len(row)
+
+	if len(order.Items) == 0 {
+		return w.w.Write(append(row, make([]string, len(csvHeader)-orderColumns)...))
+	}
+
+	for _, item := range order.Items {
+		row = append(row[:orderColumns],
+			strconv.Itoa(item.ChrtID), item.TrackNumber, strconv.Itoa(item.Price), item.Rid, item.Name,
+			strconv.Itoa(item.Sale), item.Size, strconv.Itoa(item.TotalPrice), strconv.Itoa(item.NmID),
+			item.Brand, strconv.Itoa(item.Status),
+		)
+		if err := w.w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *CSVWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
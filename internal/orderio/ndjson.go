@@ -0,0 +1,72 @@
+package orderio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"order-service/internal/models"
+)
+
+// NDJSONWriter writes one order per line in the format of Kafka messages.
+type NDJSONWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	bw := bufio.NewWriter(w)
+	return &NDJSONWriter{w: bw, enc: json.NewEncoder(bw)}
+}
+
+func (w *NDJSONWriter) Write(order *models.Order) error {
+	return w.enc.Encode(order)
+}
+
+func (w *NDJSONWriter) Close() error {
+	return w.w.Flush()
+}
+
+// Line is one non-empty line of an NDJSON file. Offset is where the next
+// line starts, so reading can resume from it.
+type Line struct {
+	Number int
+	Offset int64
+	Data   []byte
+}
+
+// NDJSONReader reads lines of any length, keeping track of their position.
+type NDJSONReader struct {
+	r      *bufio.Reader
+	number int
+	offset int64
+}
+
+// NewNDJSONReader reads from r, which is positioned at offset and line
+// number (both zero at the start of a file).
+func NewNDJSONReader(r io.Reader, offset int64, number int) *NDJSONReader {
+	return &NDJSONReader{r: bufio.NewReaderSize(r, 64*1024), offset: offset, number: number}
+}
+
+// Next returns the next non-empty line, or io.EOF.
+func (r *NDJSONReader) Next() (Line, error) {
+	for {
+		data, err := r.r.ReadBytes('\n')
+		if len(data) == 0 && err != nil {
+			return Line{}, err
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return Line{}, err
+		}
+
+		r.number++
+		r.offset += int64(len(data))
+
+		data = bytes.TrimSpace(data)
+		if len(data) > 0 {
+			return Line{Number: r.number, Offset: r.offset, Data: data}, nil
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package orderio
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"order-service/internal/models"
+)
+
+// Supported formats.
+const (
+	FormatNDJSON  = "ndjson"
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+// Writer writes orders one by one. Close flushes what is buffered; it does
+// not close the underlying io.Writer.
+type Writer interface {
+	Write(order *models.Order) error
+	Close() error
+}
+
+// NewWriter creates a writer of the given format.
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatNDJSON:
+		return NewNDJSONWriter(w), nil
+	case FormatCSV:
+		return NewCSVWriter(w), nil
+	case FormatParquet:
+		return NewParquetWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// FormatFromPath guesses the format from the file extension, falling back
+// to NDJSON.
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV
+	case ".parquet":
+		return FormatParquet
+	default:
+		return FormatNDJSON
+	}
+}
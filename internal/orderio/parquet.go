@@ -0,0 +1,138 @@
+package orderio
+
+import (
+	"io"
+	"time"
+
+	"order-service/internal/models"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetOrder keeps the nesting of the JSON message: delivery and payment
+// are groups and items a repeated group.
+type parquetOrder struct {
+	OrderUID          string          `parquet:"order_uid"`
+	TrackNumber       string          `parquet:"track_number"`
+	Entry             string          `parquet:"entry"`
+	Delivery          parquetDelivery `parquet:"delivery"`
+	Payment           parquetPayment  `parquet:"payment"`
+	Items             []parquetItem   `parquet:"items,list"`
+	Locale            string          `parquet:"locale"`
+	InternalSignature string          `parquet:"internal_signature"`
+	CustomerID        string          `parquet:"customer_id"`
+	DeliveryService   string          `parquet:"delivery_service"`
+	Shardkey          string          `parquet:"shardkey"`
+	SmID              int64           `parquet:"sm_id"`
+	DateCreated       time.Time       `parquet:"date_created,timestamp(millisecond)"`
+	OofShard          string          `parquet:"oof_shard"`
+}
+
+type parquetDelivery struct {
+	Name    string `parquet:"name"`
+	Phone   string `parquet:"phone"`
+	Zip     string `parquet:"zip"`
+	City    string `parquet:"city"`
+	Address string `parquet:"address"`
+	Region  string `parquet:"region"`
+	Email   string `parquet:"email"`
+}
+
+type parquetPayment struct {
+	Transaction  string `parquet:"transaction"`
+	RequestID    string `parquet:"request_id"`
+	Currency     string `parquet:"currency"`
+	Provider     string `parquet:"provider"`
+	Amount       int64  `parquet:"amount"`
+	PaymentDt    int64  `parquet:"payment_dt"`
+	Bank         string `parquet:"bank"`
+	DeliveryCost int64  `parquet:"delivery_cost"`
+	GoodsTotal   int64  `parquet:"goods_total"`
+	CustomFee    int64  `parquet:"custom_fee"`
+}
+
+type parquetItem struct {
+	ChrtID      int64  `parquet:"chrt_id"`
+	TrackNumber string `parquet:"track_number"`
+	Price       int64  `parquet:"price"`
+	Rid         string `parquet:"rid"`
+	Name        string `parquet:"name"`
+	Sale        int64  `parquet:"sale"`
+	Size        string `parquet:"size"`
+	TotalPrice  int64  `parquet:"total_price"`
+	NmID        int64  `parquet:"nm_id"`
+	Brand       string `parquet:"brand"`
+	Status      int64  `parquet:"status"`
+}
+
+// parquetBatch is how many orders are buffered per Write call to the
+// underlying writer; row groups are cut by the writer itself.
+const parquetBatch = 1000
+
+// ParquetWriter writes zstd-compressed Parquet with one row per order.
+type ParquetWriter struct {
+	w     *parquet.GenericWriter[parquetOrder]
+	batch []parquetOrder
+}
+
+func NewParquetWriter(w io.Writer) *ParquetWriter {
+	return &ParquetWriter{
+		w:     parquet.NewGenericWriter[parquetOrder](w, parquet.Compression(&parquet.Zstd)),
+		batch: make([]parquetOrder, 0, parquetBatch),
+	}
+}
+
+func (w *ParquetWriter) Write(order *models.Order) error {
+	d, p := order.Delivery, order.Payment
+	row := parquetOrder{
+		OrderUID:    order.OrderUID,
+		TrackNumber: order.TrackNumber,
+		Entry:       order.Entry,
+		Delivery: parquetDelivery{
+			Name: d.Name, Phone: d.Phone, Zip: d.Zip, City: d.City,
+			Address: d.Address, Region: d.Region, Email: d.Email,
+		},
+		Payment: parquetPayment{
+			Transaction: p.Transaction, RequestID: p.RequestID, Currency: p.Currency,
+			Provider: p.Provider, Amount: int64(p.Amount), PaymentDt: p.PaymentDt, Bank: p.Bank,
+			DeliveryCost: int64(p.DeliveryCost), GoodsTotal: int64(p.GoodsTotal), CustomFee: int64(p.CustomFee),
+		},
+		Items:             make([]parquetItem, len(order.Items)),
+		Locale:            order.Locale,
+		InternalSignature: order.InternalSignature,
+		CustomerID:        order.CustomerID,
+		DeliveryService:   order.DeliveryService,
+		Shardkey:          order.Shardkey,
+		SmID:              int64(order.SmID),
+		DateCreated:       order.DateCreated,
+		OofShard:          order.OofShard,
+	}
+	for i, item := range order.Items {
+		row.Items[i] = parquetItem{
+			ChrtID: int64(item.ChrtID), TrackNumber: item.TrackNumber, Price: int64(item.Price),
+			Rid: item.Rid, Name: item.Name, Sale: int64(item.Sale), Size: item.Size,
+			TotalPrice: int64(item.TotalPrice), NmID: int64(item.NmID), Brand: item.Brand,
+			Status: int64(item.Status),
+		}
+	}
+
+	w.batch = append(w.batch, row)
+	if len(w.batch) == parquetBatch {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *ParquetWriter) flush() error {
+	_, err := w.w.Write(w.batch)
+	w.batch = w.batch[:0]
+	return err
+}
+
+// Close writes the footer; a Parquet file is unreadable without it.
+func (w *ParquetWriter) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.w.Close()
+}
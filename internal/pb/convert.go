@@ -0,0 +1,137 @@
+package pb
+
+import (
+	"order-service/internal/models"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// FromModel converts models.Order into its protobuf representation.
+func FromModel(order *models.Order) *Order {
+	items := make([]*Item, 0, len(order.Items))
+	for _, item := range order.Items {
+		items = append(items, &Item{
+			ChrtId:      int64(item.ChrtID),
+			TrackNumber: item.TrackNumber,
+			Price:       int64(item.Price),
+			Rid:         item.Rid,
+			Name:        item.Name,
+			Sale:        int64(item.Sale),
+			Size:        item.Size,
+			TotalPrice:  int64(item.TotalPrice),
+			NmId:        int64(item.NmID),
+			Brand:       item.Brand,
+			Status:      int64(item.Status),
+		})
+	}
+
+	pbOrder := &Order{
+		OrderUid:    order.OrderUID,
+		TrackNumber: order.TrackNumber,
+		Entry:       order.Entry,
+		Delivery: &Delivery{
+			Name:    order.Delivery.Name,
+			Phone:   order.Delivery.Phone,
+			Zip:     order.Delivery.Zip,
+			City:    order.Delivery.City,
+			Address: order.Delivery.Address,
+			Region:  order.Delivery.Region,
+			Email:   order.Delivery.Email,
+		},
+		Payment: &Payment{
+			Transaction:  order.Payment.Transaction,
+			RequestId:    order.Payment.RequestID,
+			Currency:     order.Payment.Currency,
+			Provider:     order.Payment.Provider,
+			Amount:       int64(order.Payment.Amount),
+			PaymentDt:    order.Payment.PaymentDt,
+			Bank:         order.Payment.Bank,
+			DeliveryCost: int64(order.Payment.DeliveryCost),
+			GoodsTotal:   int64(order.Payment.GoodsTotal),
+			CustomFee:    int64(order.Payment.CustomFee),
+		},
+		Items:             items,
+		Locale:            order.Locale,
+		InternalSignature: order.InternalSignature,
+		CustomerId:        order.CustomerID,
+		DeliveryService:   order.DeliveryService,
+		Shardkey:          order.Shardkey,
+		SmId:              int64(order.SmID),
+		DateCreated:       timestamppb.New(order.DateCreated),
+		OofShard:          order.OofShard,
+	}
+	if !order.UpdatedAt.IsZero() {
+		pbOrder.UpdatedAt = timestamppb.New(order.UpdatedAt)
+	}
+
+	return pbOrder
+}
+
+// ToModel converts a protobuf order back into models.Order.
+func ToModel(o *Order) *models.Order {
+	order := &models.Order{
+		OrderUID:          o.GetOrderUid(),
+		TrackNumber:       o.GetTrackNumber(),
+		Entry:             o.GetEntry(),
+		Locale:            o.GetLocale(),
+		InternalSignature: o.GetInternalSignature(),
+		CustomerID:        o.GetCustomerId(),
+		DeliveryService:   o.GetDeliveryService(),
+		Shardkey:          o.GetShardkey(),
+		SmID:              int(o.GetSmId()),
+		OofShard:          o.GetOofShard(),
+		Items:             make([]models.Item, 0, len(o.GetItems())),
+	}
+
+	if o.DateCreated != nil {
+		order.DateCreated = o.DateCreated.AsTime()
+	}
+	if o.UpdatedAt != nil {
+		order.UpdatedAt = o.UpdatedAt.AsTime()
+	}
+
+	if d := o.GetDelivery(); d != nil {
+		order.Delivery = models.Delivery{
+			Name:    d.GetName(),
+			Phone:   d.GetPhone(),
+			Zip:     d.GetZip(),
+			City:    d.GetCity(),
+			Address: d.GetAddress(),
+			Region:  d.GetRegion(),
+			Email:   d.GetEmail(),
+		}
+	}
+
+	if p := o.GetPayment(); p != nil {
+		order.Payment = models.Payment{
+			Transaction:  p.GetTransaction(),
+			RequestID:    p.GetRequestId(),
+			Currency:     p.GetCurrency(),
+			Provider:     p.GetProvider(),
+			Amount:       int(p.GetAmount()),
+			PaymentDt:    p.GetPaymentDt(),
+			Bank:         p.GetBank(),
+			DeliveryCost: int(p.GetDeliveryCost()),
+			GoodsTotal:   int(p.GetGoodsTotal()),
+			CustomFee:    int(p.GetCustomFee()),
+		}
+	}
+
+	for _, item := range o.GetItems() {
+		order.Items = append(order.Items, models.Item{
+			ChrtID:      int(item.GetChrtId()),
+			TrackNumber: item.GetTrackNumber(),
+			Price:       int(item.GetPrice()),
+			Rid:         item.GetRid(),
+			Name:        item.GetName(),
+			Sale:        int(item.GetSale()),
+			Size:        item.GetSize(),
+			TotalPrice:  int(item.GetTotalPrice()),
+			NmID:        int(item.GetNmId()),
+			Brand:       item.GetBrand(),
+			Status:      int(item.GetStatus()),
+		})
+	}
+
+	return order
+}
@@ -0,0 +1,61 @@
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"order-service/internal/models"
+)
+
+// diff lists the JSON fields that differ between two versions of an order,
+// as paths like "payment.amount". Fields the database sets are ignored.
+func diff(old, new *models.Order) []string {
+	return diffJSON("", normalize(old), normalize(new))
+}
+
+func normalize(order *models.Order) []byte {
+	o := *order
+	o.UpdatedAt = time.Time{}
+	// the database returns times in its own zone
+	o.DateCreated = o.DateCreated.UTC()
+	data, _ := json.Marshal(o)
+	return data
+}
+
+func diffJSON(prefix string, old, new []byte) []string {
+	var oldFields, newFields map[string]json.RawMessage
+	if json.Unmarshal(old, &oldFields) != nil || json.Unmarshal(new, &newFields) != nil {
+		// not objects: the whole value changed
+		return []string{prefix}
+	}
+
+	var fields []string
+	for key, value := range newFields {
+		if prev, ok := oldFields[key]; ok && bytes.Equal(prev, value) {
+			continue
+		}
+
+		path := prefix + key
+		prev, ok := oldFields[key]
+		if ok && isObject(prev) && isObject(value) {
+			fields = append(fields, diffJSON(path+".", prev, value)...)
+		} else {
+			fields = append(fields, path)
+		}
+	}
+	for key := range oldFields {
+		if _, ok := newFields[key]; !ok {
+			fields = append(fields, prefix+key)
+		}
+	}
+
+	slices.Sort(fields)
+	return fields
+}
+
+func isObject(value json.RawMessage) bool {
+	value = bytes.TrimSpace(value)
+	return len(value) > 0 && value[0] == '{'
+}
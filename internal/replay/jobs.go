@@ -0,0 +1,158 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Job states.
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// keepJobs is how many finished jobs are remembered for polling.
+const keepJobs = 20
+
+// ErrBusy is returned when a replay is started while another one runs: two
+// replays could apply versions of an order out of order.
+var ErrBusy = errors.New("a replay is already running")
+
+// Job is a replay in the background. Result shows the progress while it
+// runs and where it stopped when it failed or was canceled.
+type Job struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Options    Options    `json:"options"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Result     *Result    `json:"result,omitempty"`
+	Error      string     `json:"error,omitempty"`
+
+	cancel context.CancelFunc
+}
+
+// Jobs runs replays one at a time and keeps their outcome.
+type Jobs struct {
+	ctx      context.Context
+	replayer *Replayer
+
+	mu     sync.Mutex
+	jobs   []*Job // oldest first
+	nextID atomic.Uint64
+}
+
+// NewJobs creates the job manager. Running jobs are canceled with ctx.
+func NewJobs(ctx context.Context, replayer *Replayer) *Jobs {
+	return &Jobs{ctx: ctx, replayer: replayer}
+}
+
+// Start validates opts and launches a job.
+func (j *Jobs) Start(opts Options) (Job, error) {
+	if err := opts.Validate(); err != nil {
+		return Job{}, err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, job := range j.jobs {
+		if job.Status == StatusRunning {
+			return Job{}, ErrBusy
+		}
+	}
+
+	ctx, cancel := context.WithCancel(j.ctx)
+	job := &Job{
+		ID:        fmt.Sprintf("replay-%d", j.nextID.Add(1)),
+		Status:    StatusRunning,
+		Options:   opts,
+		StartedAt: time.Now(),
+		cancel:    cancel,
+	}
+
+	j.jobs = append(j.jobs, job)
+	if len(j.jobs) > keepJobs {
+		j.jobs = j.jobs[len(j.jobs)-keepJobs:]
+	}
+
+	go j.run(ctx, job)
+
+	log.Printf("Replay %s started", job.ID)
+	return *job, nil
+}
+
+func (j *Jobs) run(ctx context.Context, job *Job) {
+	result, err := j.replayer.Run(ctx, job.Options, func(progress *Result) {
+		j.mu.Lock()
+		job.Result = progress
+		j.mu.Unlock()
+	})
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	job.FinishedAt = &now
+	if result != nil {
+		job.Result = result
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		job.Status = StatusCanceled
+	case err != nil:
+		job.Status = StatusFailed
+		job.Error = err.Error()
+		log.Printf("Replay %s failed: %v", job.ID, err)
+	default:
+		job.Status = StatusSucceeded
+	}
+	job.cancel()
+}
+
+// Get returns a copy of the job.
+func (j *Jobs) Get(id string) (Job, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, job := range j.jobs {
+		if job.ID == id {
+			return *job, true
+		}
+	}
+	return Job{}, false
+}
+
+// List returns copies of the remembered jobs, newest first.
+func (j *Jobs) List() []Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	list := make([]Job, 0, len(j.jobs))
+	for i := len(j.jobs) - 1; i >= 0; i-- {
+		list = append(list, *j.jobs[i])
+	}
+	return list
+}
+
+// Cancel stops a running job. It reports false for unknown ids.
+func (j *Jobs) Cancel(id string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, job := range j.jobs {
+		if job.ID == id {
+			job.cancel()
+			return true
+		}
+	}
+	return false
+}
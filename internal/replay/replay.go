@@ -0,0 +1,418 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"time"
+
+	"order-service/internal/models"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// keepSamples bounds the changes and errors listed in a result
+	keepSamples = 100
+	// idleTimeout ends a partition whose remaining offsets hold no
+	// messages (transaction markers, compacted records)
+	idleTimeout = 10 * time.Second
+	// progressEvery is how many messages pass between progress reports
+	progressEvery = 1000
+)
+
+var shadowName = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// Options select the part of the topic to reprocess and where it goes. The
+// range applies to every selected partition: it starts at FromOffset or at
+// the first message at or after Since and ends before ToOffset or the
+// first message at or after Until, and never goes past the messages that
+// existed when the replay started.
+type Options struct {
+	Partitions []int     `json:"partitions,omitempty"`
+	FromOffset *int64    `json:"from_offset,omitempty"`
+	ToOffset   *int64    `json:"to_offset,omitempty"`
+	Since      time.Time `json:"since,omitzero"`
+	Until      time.Time `json:"until,omitzero"`
+	// DryRun writes nothing and reports how the replay would change the
+	// orders table
+	DryRun bool `json:"dry_run"`
+	// Shadow is a table with the layout of orders to write to instead of
+	// the live one; it is created when missing
+	Shadow string `json:"shadow,omitempty"`
+}
+
+// Validate rejects impossible combinations.
+func (o *Options) Validate() error {
+	switch {
+	case o.FromOffset != nil && !o.Since.IsZero():
+		return errors.New("from_offset and since are exclusive")
+	case o.ToOffset != nil && !o.Until.IsZero():
+		return errors.New("to_offset and until are exclusive")
+	case o.FromOffset != nil && *o.FromOffset < 0, o.ToOffset != nil && *o.ToOffset < 0:
+		return errors.New("offsets must not be negative")
+	case o.DryRun && o.Shadow != "":
+		return errors.New("dry_run and shadow are exclusive")
+	case o.Shadow != "" && (!shadowName.MatchString(o.Shadow) || o.Shadow == "orders"):
+		return fmt.Errorf("invalid shadow table name %q", o.Shadow)
+	}
+	return nil
+}
+
+// Processor decodes messages the way the consumer does and applies orders
+// to the live table with everything that goes with it (cache invalidation,
+// events). kafka.Processor is one.
+type Processor interface {
+	Decode(msg kafka.Message) (*models.Order, error)
+	Apply(ctx context.Context, order *models.Order) error
+}
+
+// Store is what replays need from the database.
+type Store interface {
+	GetOrdersByUIDs(ctx context.Context, uids []string) ([]models.Order, error)
+	CreateShadowTable(ctx context.Context, table string) error
+	SaveOrderIn(ctx context.Context, table string, order *models.Order) (bool, error)
+}
+
+// Partition is the range of one partition and how far the replay got.
+type Partition struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Next  int64 `json:"next"`
+}
+
+// Change is how a dry run would change one order.
+type Change struct {
+	OrderUID string   `json:"order_uid"`
+	Status   string   `json:"status"`
+	Fields   []string `json:"fields,omitempty"`
+}
+
+// Change statuses.
+const (
+	ChangeNew     = "new"
+	ChangeChanged = "changed"
+)
+
+// MessageError is a message that failed validation.
+type MessageError struct {
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Error     string `json:"error"`
+}
+
+// Result is the outcome of a replay, or its progress while it runs.
+type Result struct {
+	DryRun     bool               `json:"dry_run"`
+	Target     string             `json:"target"`
+	Partitions map[int]*Partition `json:"partitions"`
+	Messages   int                `json:"messages"`
+	Invalid    int                `json:"invalid"`
+	Applied    int                `json:"applied"`
+	// dry runs only: distinct orders and how they compare with the table
+	Orders    int            `json:"orders,omitempty"`
+	New       int            `json:"new,omitempty"`
+	Changed   int            `json:"changed,omitempty"`
+	Unchanged int            `json:"unchanged,omitempty"`
+	Changes   []Change       `json:"changes,omitempty"`
+	Errors    []MessageError `json:"errors,omitempty"`
+}
+
+func (r *Result) clone() *Result {
+	c := *r
+	c.Partitions = make(map[int]*Partition, len(r.Partitions))
+	for p, part := range r.Partitions {
+		copied := *part
+		c.Partitions[p] = &copied
+	}
+	c.Changes = slices.Clone(r.Changes)
+	c.Errors = slices.Clone(r.Errors)
+	return &c
+}
+
+// Replayer reads a range of the topic again and reprocesses it.
+type Replayer struct {
+	brokers   []string
+	topic     string
+	dialer    *kafka.Dialer
+	store     Store
+	processor Processor
+}
+
+// NewReplayer creates a replayer. dialer may be nil for plain connections.
+func NewReplayer(brokers []string, topic string, dialer *kafka.Dialer, store Store, processor Processor) *Replayer {
+	if dialer == nil {
+		dialer = kafka.DefaultDialer
+	}
+	return &Replayer{brokers: brokers, topic: topic, dialer: dialer, store: store, processor: processor}
+}
+
+// Run replays the range selected by opts. progress, if not nil, receives
+// snapshots of the result while it runs. When the replay stops early the
+// partial result tells where each partition got to.
+func (r *Replayer) Run(ctx context.Context, opts Options, progress func(*Result)) (*Result, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	result := &Result{DryRun: opts.DryRun, Target: "orders", Partitions: make(map[int]*Partition)}
+	if opts.Shadow != "" {
+		result.Target = opts.Shadow
+		if err := r.store.CreateShadowTable(ctx, opts.Shadow); err != nil {
+			return nil, err
+		}
+	}
+
+	partitions := opts.Partitions
+	if len(partitions) == 0 {
+		var err error
+		if partitions, err = r.partitions(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, p := range partitions {
+		part, err := r.bounds(ctx, p, opts)
+		if err != nil {
+			return nil, err
+		}
+		result.Partitions[p] = part
+	}
+
+	log.Printf("Replaying topic %s into %s (dry run: %t): %d partitions", r.topic, result.Target, opts.DryRun, len(partitions))
+
+	// the last version of every order, for the dry run comparison
+	var latest map[string]*models.Order
+	if opts.DryRun {
+		latest = make(map[string]*models.Order)
+	}
+
+	for _, p := range partitions {
+		err := r.replayPartition(ctx, p, result.Partitions[p], func(msg kafka.Message) error {
+			result.Messages++
+			defer func() {
+				if progress != nil && result.Messages%progressEvery == 0 {
+					progress(result.clone())
+				}
+			}()
+
+			order, err := r.processor.Decode(msg)
+			if err != nil {
+				result.Invalid++
+				if len(result.Errors) < keepSamples {
+					result.Errors = append(result.Errors, MessageError{Partition: msg.Partition, Offset: msg.Offset, Error: err.Error()})
+				}
+				return nil
+			}
+
+			switch {
+			case opts.DryRun:
+				latest[order.OrderUID] = order
+				return nil
+			case opts.Shadow != "":
+				_, err = r.store.SaveOrderIn(ctx, opts.Shadow, order)
+			default:
+				err = r.processor.Apply(ctx, order)
+			}
+			if err != nil {
+				return fmt.Errorf("Failed to apply order %s from partition %d offset %d: %w", order.OrderUID, msg.Partition, msg.Offset, err)
+			}
+			result.Applied++
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+		if progress != nil {
+			progress(result.clone())
+		}
+	}
+
+	if opts.DryRun {
+		if err := r.compare(ctx, latest, result); err != nil {
+			return result, err
+		}
+	}
+
+	log.Printf("Replay of %s finished: %d messages, %d invalid, %d applied", r.topic, result.Messages, result.Invalid, result.Applied)
+	return result, nil
+}
+
+// dial tries the brokers in turn.
+func (r *Replayer) dial(ctx context.Context, connect func(broker string) (*kafka.Conn, error)) (*kafka.Conn, error) {
+	var errs []error
+	for _, broker := range r.brokers {
+		conn, err := connect(broker)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("Failed to connect to Kafka: %w", errors.Join(errs...))
+}
+
+func (r *Replayer) partitions(ctx context.Context) ([]int, error) {
+	conn, err := r.dial(ctx, func(broker string) (*kafka.Conn, error) {
+		return r.dialer.DialContext(ctx, "tcp", broker)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	found, err := conn.ReadPartitions(r.topic)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read partitions of %s: %w", r.topic, err)
+	}
+
+	partitions := make([]int, 0, len(found))
+	for _, p := range found {
+		partitions = append(partitions, p.ID)
+	}
+	sort.Ints(partitions)
+	return partitions, nil
+}
+
+// bounds resolves the range of one partition to offsets.
+func (r *Replayer) bounds(ctx context.Context, partition int, opts Options) (*Partition, error) {
+	conn, err := r.dial(ctx, func(broker string) (*kafka.Conn, error) {
+		return r.dialer.DialLeader(ctx, "tcp", broker, r.topic, partition)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	first, last, err := conn.ReadOffsets()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read offsets of partition %d: %w", partition, err)
+	}
+
+	// the offset of the first message at or after t, last if there is none
+	offsetAt := func(t time.Time) (int64, error) {
+		offset, err := conn.ReadOffset(t)
+		if err != nil {
+			return 0, fmt.Errorf("Failed to look up offset at %s in partition %d: %w", t.Format(time.RFC3339), partition, err)
+		}
+		if offset < 0 {
+			return last, nil
+		}
+		return offset, nil
+	}
+
+	part := &Partition{Start: first, End: last}
+	switch {
+	case opts.FromOffset != nil:
+		part.Start = max(first, *opts.FromOffset)
+	case !opts.Since.IsZero():
+		if part.Start, err = offsetAt(opts.Since); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case opts.ToOffset != nil:
+		part.End = min(last, *opts.ToOffset)
+	case !opts.Until.IsZero():
+		if part.End, err = offsetAt(opts.Until); err != nil {
+			return nil, err
+		}
+	}
+	part.Start = min(part.Start, part.End)
+	part.Next = part.Start
+
+	return part, nil
+}
+
+func (r *Replayer) replayPartition(ctx context.Context, partition int, part *Partition, handle func(kafka.Message) error) error {
+	if part.Next >= part.End {
+		return nil
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   r.brokers,
+		Topic:     r.topic,
+		Partition: partition,
+		Dialer:    r.dialer,
+		MinBytes:  1,
+		MaxBytes:  10e6, // 10MB
+		MaxWait:   500 * time.Millisecond,
+	})
+	defer reader.Close()
+
+	if err := reader.SetOffset(part.Next); err != nil {
+		return fmt.Errorf("Failed to seek partition %d: %w", partition, err)
+	}
+
+	for part.Next < part.End {
+		fetchCtx, cancel := context.WithTimeout(ctx, idleTimeout)
+		msg, err := reader.FetchMessage(fetchCtx)
+		cancel()
+
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, context.DeadlineExceeded):
+			log.Printf("No messages in partition %d between offsets %d and %d, skipping them", partition, part.Next, part.End)
+			part.Next = part.End
+			return nil
+		case err != nil:
+			return fmt.Errorf("Failed to read partition %d at offset %d: %w", partition, part.Next, err)
+		}
+
+		if msg.Offset >= part.End {
+			part.Next = part.End
+			return nil
+		}
+		if err := handle(msg); err != nil {
+			return err
+		}
+		part.Next = msg.Offset + 1
+	}
+	return nil
+}
+
+// compareBatch is how many orders are loaded per query in a dry run.
+const compareBatch = 500
+
+// compare classifies the last replayed version of each order against the
+// stored one.
+func (r *Replayer) compare(ctx context.Context, latest map[string]*models.Order, result *Result) error {
+	uids := slices.Sorted(maps.Keys(latest))
+	result.Orders = len(uids)
+
+	for chunk := range slices.Chunk(uids, compareBatch) {
+		stored, err := r.store.GetOrdersByUIDs(ctx, chunk)
+		if err != nil {
+			return fmt.Errorf("Failed to load current orders: %w", err)
+		}
+
+		current := make(map[string]*models.Order, len(stored))
+		for i := range stored {
+			current[stored[i].OrderUID] = &stored[i]
+		}
+
+		for _, uid := range chunk {
+			var change Change
+			if old, ok := current[uid]; !ok {
+				result.New++
+				change = Change{OrderUID: uid, Status: ChangeNew}
+			} else if fields := diff(old, latest[uid]); len(fields) > 0 {
+				result.Changed++
+				change = Change{OrderUID: uid, Status: ChangeChanged, Fields: fields}
+			} else {
+				result.Unchanged++
+				continue
+			}
+
+			if len(result.Changes) < keepSamples {
+				result.Changes = append(result.Changes, change)
+			}
+		}
+	}
+	return nil
+}
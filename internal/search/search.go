@@ -0,0 +1,141 @@
+package search
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MinQueryLength = 2
+	MaxQueryLength = 200
+
+	// MinTermLength is the shortest term the trigram index can look up.
+	MinTermLength = 3
+)
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9\s().-]+$`)
+
+// Query is a search as typed by the user along with the forms it is matched in.
+type Query struct {
+	Text  string   // full-text query, empty for phone numbers
+	Term  string   // normalized substring: digits of a phone, lower-cased otherwise
+	Words []string // what to highlight in the results
+	Phone bool
+}
+
+// Parse normalizes a search query. Phone numbers are matched on their digits
+// only, so "+7 (916) 123-45-67" finds "79161234567"; e-mails and the rest
+// of the text are matched case-insensitively.
+func Parse(s string) (Query, error) {
+	s = strings.Join(strings.Fields(s), " ")
+	if n := utf8.RuneCountInString(s); n < MinQueryLength || n > MaxQueryLength {
+		return Query{}, fmt.Errorf("q must be between %d and %d characters", MinQueryLength, MaxQueryLength)
+	}
+
+	if phonePattern.MatchString(s) {
+		digits := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, s)
+		if digits != "" {
+			return Query{Term: digits, Words: []string{digits}, Phone: true}, nil
+		}
+	}
+
+	q := Query{Text: s, Term: strings.ToLower(s)}
+	if strings.Contains(s, "@") {
+		q.Words = []string{q.Term}
+		return q, nil
+	}
+	for _, word := range strings.Fields(q.Term) {
+		// websearch syntax: "or" joins the words, a leading minus excludes one
+		if word == "or" || strings.HasPrefix(word, "-") {
+			continue
+		}
+		word = strings.TrimFunc(word, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+		if word != "" {
+			q.Words = append(q.Words, word)
+		}
+	}
+	return q, nil
+}
+
+// Highlight returns value HTML-escaped with the parts that match q wrapped
+// in <mark>, or false when nothing matches.
+func Highlight(value string, q Query) (string, bool) {
+	runes := []rune(value)
+	var spans [][2]int
+	if q.Phone {
+		spans = phoneSpans(runes, q.Term)
+	} else {
+		lower := make([]rune, len(runes))
+		for i, r := range runes {
+			lower[i] = unicode.ToLower(r)
+		}
+		for _, word := range q.Words {
+			spans = append(spans, wordSpans(lower, []rune(word))...)
+		}
+	}
+	if len(spans) == 0 {
+		return "", false
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	var b strings.Builder
+	pos := 0
+	for _, span := range spans {
+		if span[1] <= pos {
+			continue
+		}
+		start := max(span[0], pos)
+		if start > pos {
+			b.WriteString(html.EscapeString(string(runes[pos:start])))
+		}
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(runes[start:span[1]])))
+		b.WriteString("</mark>")
+		pos = span[1]
+	}
+	b.WriteString(html.EscapeString(string(runes[pos:])))
+	return b.String(), true
+}
+
+// wordSpans finds every occurrence of word in text.
+func wordSpans(text, word []rune) [][2]int {
+	var spans [][2]int
+	if len(word) == 0 {
+		return nil
+	}
+	for i := 0; i+len(word) <= len(text); i++ {
+		if string(text[i:i+len(word)]) == string(word) {
+			spans = append(spans, [2]int{i, i + len(word)})
+			i += len(word) - 1
+		}
+	}
+	return spans
+}
+
+// phoneSpans finds digits in a formatted phone number, skipping the
+// formatting between them.
+func phoneSpans(text []rune, digits string) [][2]int {
+	var positions []int
+	var only []rune
+	for i, r := range text {
+		if r >= '0' && r <= '9' {
+			positions = append(positions, i)
+			only = append(only, r)
+		}
+	}
+	var spans [][2]int
+	for _, span := range wordSpans(only, []rune(digits)) {
+		spans = append(spans, [2]int{positions[span[0]], positions[span[1]-1] + 1})
+	}
+	return spans
+}
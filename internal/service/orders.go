@@ -0,0 +1,352 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"order-service/internal/cache"
+	"order-service/internal/database"
+	"order-service/internal/models"
+	"order-service/internal/search"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Possible values of the lookup source.
+const (
+	SourceMemory   = "memory"
+	SourceCache    = "cache"
+	SourceDatabase = "database"
+)
+
+// OrderStore is the order database Orders reads from, implemented by
+// *database.PostgresRepository.
+type OrderStore interface {
+	GetOrder(ctx context.Context, orderUID string) (*models.Order, error)
+	GetOrdersByUIDs(ctx context.Context, orderUIDs []string) ([]models.Order, error)
+	ListOrderUIDs(ctx context.Context, filter database.OrderFilter, afterUID string, limit int) ([]string, error)
+	ListOrders(ctx context.Context, filter database.OrderFilter, afterUID string, limit int) ([]models.Order, error)
+	OrderUIDsByTrack(ctx context.Context, trackNumber string, limit int) ([]string, error)
+	OrderUIDsByCustomer(ctx context.Context, customerID string, limit int) ([]string, error)
+	SearchOrders(ctx context.Context, q search.Query, limit, offset int) ([]database.SearchHit, error)
+}
+
+// Orders implements the cache-then-database order lookup shared by the
+// REST and gRPC APIs.
+type Orders struct {
+	cache  cache.Cache
+	local  *cache.LocalCache // nil when the in-process tier is disabled
+	db     OrderStore
+	filler *cache.Filler
+
+	// coalesces concurrent database lookups of the same order
+	lookups   singleflight.Group
+	dbQueries atomic.Uint64
+}
+
+func NewOrders(cache cache.Cache, local *cache.LocalCache, db OrderStore, filler *cache.Filler) *Orders {
+	return &Orders{
+		cache:  cache,
+		local:  local,
+		db:     db,
+		filler: filler,
+	}
+}
+
+// GetOrder walks the tiers (memory, Redis, Postgres) and reports which one
+// answered and how long that tier took. A nil order means it does not exist.
+func (s *Orders) GetOrder(ctx context.Context, orderUID string) (*models.Order, string, time.Duration, error) {
+	// Try in-process cache first
+	var localVersion uint64
+	if s.local != nil {
+		memoryStart := time.Now()
+		localVersion = s.local.Version(orderUID)
+		if order := s.local.GetOrder(orderUID); order != nil {
+			return order, SourceMemory, time.Since(memoryStart), nil
+		}
+	}
+
+	// Then Redis
+	cacheStart := time.Now()
+	order, err := s.cache.GetOrder(ctx, orderUID)
+	cacheDuration := time.Since(cacheStart)
+
+	if errors.Is(err, cache.ErrNotFound) {
+		log.Printf("Order %s is cached as missing", orderUID)
+		return nil, SourceCache, cacheDuration, nil
+	} else if err != nil {
+		log.Printf("Error accessing cache: %v", err)
+	} else if order != nil {
+		if s.local != nil {
+			s.local.FillOrder(order, localVersion)
+		}
+		return order, SourceCache, cacheDuration, nil
+	}
+
+	// If not in cache, try database
+	log.Printf("Order %s not found in cache, checking database", orderUID)
+	dbStart := time.Now()
+	order, err = s.loadOrder(ctx, orderUID)
+	return order, SourceDatabase, time.Since(dbStart), err
+}
+
+// GetOrders resolves a batch of uids with one round trip per tier: memory,
+// then a pipelined cache read, then a single database query for the rest.
+// Orders that don't exist are absent from the result.
+func (s *Orders) GetOrders(ctx context.Context, orderUIDs []string) (map[string]*models.Order, error) {
+	result := make(map[string]*models.Order, len(orderUIDs))
+
+	missing := orderUIDs
+	var localVersions map[string]uint64
+	if s.local != nil {
+		missing = nil
+		localVersions = make(map[string]uint64)
+		for _, orderUID := range orderUIDs {
+			localVersions[orderUID] = s.local.Version(orderUID)
+			if order := s.local.GetOrder(orderUID); order != nil {
+				result[orderUID] = order
+			} else {
+				missing = append(missing, orderUID)
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	cached, err := s.cache.GetOrders(ctx, missing)
+	if err != nil {
+		log.Printf("Error accessing cache: %v", err)
+	}
+
+	var uncached []string
+	for _, orderUID := range missing {
+		order, ok := cached[orderUID]
+		if !ok {
+			uncached = append(uncached, orderUID)
+			continue
+		}
+		if order != nil {
+			result[orderUID] = order
+			if s.local != nil {
+				s.local.FillOrder(order, localVersions[orderUID])
+			}
+		}
+	}
+	if len(uncached) == 0 {
+		return result, nil
+	}
+
+	// without versions the orders are served but not cached
+	versions, err := s.cache.FillVersions(ctx, uncached)
+	if err != nil {
+		log.Printf("Error accessing cache: %v", err)
+	}
+	fillVersions := make(map[string]string, len(versions))
+	for i, version := range versions {
+		fillVersions[uncached[i]] = version
+	}
+
+	// what is cached comes from the primary: a lagging replica could hand
+	// back an order older than a save already invalidated, and the fill
+	// would put it back
+	s.dbQueries.Add(1)
+	orders, err := s.db.GetOrdersByUIDs(database.Primary(ctx), uncached)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		order := &orders[i]
+		result[order.OrderUID] = order
+		if s.local != nil {
+			s.local.FillOrder(order, localVersions[order.OrderUID])
+		}
+		if version, ok := fillVersions[order.OrderUID]; ok {
+			s.filler.Enqueue(order, version)
+		}
+	}
+
+	return result, nil
+}
+
+// InvalidateOrder evicts the order from both cache tiers. Other replicas
+// drop their in-memory copies when the invalidation reaches them, this one
+// right away.
+func (s *Orders) InvalidateOrder(ctx context.Context, orderUID string) error {
+	if s.local != nil {
+		s.local.Delete(orderUID)
+	}
+	return s.cache.InvalidateOrder(ctx, orderUID)
+}
+
+// ListOrderUIDs pages through uids in the database ordered by uid.
+func (s *Orders) ListOrderUIDs(ctx context.Context, filter database.OrderFilter, afterUID string, limit int) ([]string, error) {
+	s.dbQueries.Add(1)
+	return s.db.ListOrderUIDs(ctx, filter, afterUID, limit)
+}
+
+// ListOrders pages through the database ordered by uid.
+func (s *Orders) ListOrders(ctx context.Context, filter database.OrderFilter, afterUID string, limit int) ([]models.Order, error) {
+	s.dbQueries.Add(1)
+	return s.db.ListOrders(ctx, filter, afterUID, limit)
+}
+
+// MaxLookupOrders is the most orders a track number or customer lookup
+// returns.
+const MaxLookupOrders = 1000
+
+// OrdersByTrack returns the orders with the track number on the order or on
+// one of its items, newest first, and the tier that knew their uids.
+func (s *Orders) OrdersByTrack(ctx context.Context, trackNumber string) ([]*models.Order, string, error) {
+	return s.lookup(ctx, cache.TrackKey(trackNumber), MaxLookupOrders,
+		func(ctx context.Context) ([]string, error) {
+			return s.db.OrderUIDsByTrack(ctx, trackNumber, MaxLookupOrders)
+		},
+		func(order *models.Order) bool {
+			if order.TrackNumber == trackNumber {
+				return true
+			}
+			for _, item := range order.Items {
+				if item.TrackNumber == trackNumber {
+					return true
+				}
+			}
+			return false
+		})
+}
+
+// OrdersByCustomer returns up to limit of the newest orders of a customer.
+func (s *Orders) OrdersByCustomer(ctx context.Context, customerID string, limit int) ([]*models.Order, string, error) {
+	return s.lookup(ctx, cache.CustomerKey(customerID), limit,
+		func(ctx context.Context) ([]string, error) {
+			return s.db.OrderUIDsByCustomer(ctx, customerID, MaxLookupOrders)
+		},
+		func(order *models.Order) bool { return order.CustomerID == customerID })
+}
+
+// lookup resolves a secondary key to orders: the uids come from the cached
+// lookup or from query, the orders themselves from GetOrders. Orders changed
+// since the lookup was cached no longer match and are skipped, and the
+// lookup is dropped so the next call reads it again.
+func (s *Orders) lookup(ctx context.Context, key string, limit int, query func(ctx context.Context) ([]string, error), matches func(order *models.Order) bool) ([]*models.Order, string, error) {
+	source := SourceCache
+	uids, ok, version, err := s.cache.GetLookup(ctx, key)
+	if err != nil {
+		log.Printf("Error accessing cache: %v", err)
+	}
+	if !ok {
+		source = SourceDatabase
+		s.dbQueries.Add(1)
+		cached := err == nil
+		if uids, err = query(ctx); err != nil {
+			return nil, source, err
+		}
+		// the version was read before the query, so a lookup invalidated
+		// while it ran is not overwritten with the old list
+		if cached {
+			if err := s.cache.SetLookup(ctx, key, uids, version); err != nil {
+				log.Printf("Failed to cache %s: %v", key, err)
+			}
+		}
+	}
+	if len(uids) > limit {
+		uids = uids[:limit]
+	}
+
+	found, err := s.GetOrders(ctx, uids)
+	if err != nil {
+		return nil, source, err
+	}
+
+	orders := make([]*models.Order, 0, len(uids))
+	stale := false
+	for _, uid := range uids {
+		order := found[uid]
+		if order == nil || !matches(order) {
+			stale = true
+			continue
+		}
+		orders = append(orders, order)
+	}
+	if stale && source == SourceCache {
+		if err := s.cache.InvalidateLookups(ctx, []string{key}); err != nil {
+			log.Printf("Failed to invalidate %s: %v", key, err)
+		}
+	}
+	return orders, source, nil
+}
+
+// SearchOrders finds orders by the delivery and item fields.
+func (s *Orders) SearchOrders(ctx context.Context, q search.Query, limit, offset int) ([]database.SearchHit, error) {
+	s.dbQueries.Add(1)
+	return s.db.SearchOrders(ctx, q, limit, offset)
+}
+
+// Stats reports hit rates of each lookup tier.
+func (s *Orders) Stats() map[string]interface{} {
+	stats := map[string]interface{}{
+		SourceCache: s.cache.Stats(),
+		SourceDatabase: map[string]interface{}{
+			"queries": s.dbQueries.Load(),
+		},
+	}
+	if s.local != nil {
+		stats[SourceMemory] = s.local.Stats()
+	}
+	return stats
+}
+
+// loadOrder reads the order from the database. Concurrent calls for the same
+// uid share one query, and the result (or its absence) is written back to the
+// cache unless the order was invalidated meanwhile.
+func (s *Orders) loadOrder(ctx context.Context, orderUID string) (*models.Order, error) {
+	// the shared query must not be cancelled by the first caller going away
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	result, err, _ := s.lookups.Do(orderUID, func() (interface{}, error) {
+		var localVersion uint64
+		if s.local != nil {
+			localVersion = s.local.Version(orderUID)
+		}
+		versions, err := s.cache.FillVersions(ctx, []string{orderUID})
+		if err != nil {
+			log.Printf("Error accessing cache: %v", err)
+		}
+
+		// from the primary, like GetOrders
+		s.dbQueries.Add(1)
+		order, err := s.db.GetOrder(database.Primary(ctx), orderUID)
+		if err != nil {
+			return nil, err
+		}
+
+		if order == nil {
+			if versions != nil {
+				if err := s.cache.SetNotFound(ctx, orderUID, versions[0]); err != nil {
+					log.Printf("Failed to set negative cache entry: %v", err)
+				}
+			}
+			return nil, nil
+		}
+
+		// Save to cache for future requests
+		if s.local != nil {
+			s.local.FillOrder(order, localVersion)
+		}
+		if versions != nil {
+			s.filler.Enqueue(order, versions[0])
+		}
+		return order, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	order, _ := result.(*models.Order)
+	return order, nil
+}
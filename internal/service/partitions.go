@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"order-service/internal/database"
+)
+
+// Partitions keeps the monthly partitions of orders created ahead of time
+// and, with a retention, moves the expired ones to the archive.
+type Partitions struct {
+	db        *database.PostgresRepository
+	ahead     int
+	retention int
+}
+
+// NewPartitions maintains the partitions of the ahead months after the
+// current one; retention is the number of months before the current one
+// kept in the table, 0 keeps everything.
+func NewPartitions(db *database.PostgresRepository, ahead, retention int) *Partitions {
+	return &Partitions{db: db, ahead: ahead, retention: retention}
+}
+
+// Run maintains the partitions right away and then every interval until ctx
+// is done. With several instances only one of them works at a time.
+func (s *Partitions) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Maintain(ctx); err != nil && !errors.Is(err, database.ErrMaintenanceRunning) && ctx.Err() == nil {
+			log.Printf("Failed to maintain partitions: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Partitions) Maintain(ctx context.Context) error {
+	done, err := s.db.MaintainPartitions(ctx, time.Now(), s.ahead, s.retention)
+	for _, name := range done.Created {
+		log.Printf("Created partition %s", name)
+	}
+	if len(done.Archived) > 0 {
+		log.Printf("Archived %d orders to %v", done.Orders, done.Archived)
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"order-service/internal/database"
+)
+
+// ReportStore is the database the reports come from, implemented by
+// *database.PostgresRepository.
+type ReportStore interface {
+	RefreshReports(ctx context.Context) error
+	ReportsRefreshedAt(ctx context.Context) (time.Time, error)
+	Revenue(ctx context.Context, filter database.ReportFilter, byDay, byProvider bool) ([]database.RevenueRow, error)
+	TopBrands(ctx context.Context, filter database.ReportFilter, limit int) ([]database.SalesRow, error)
+	TopProducts(ctx context.Context, filter database.ReportFilter, limit int) ([]database.SalesRow, error)
+	DeliveryCosts(ctx context.Context, filter database.ReportFilter) ([]database.DeliveryRow, error)
+	TopCustomers(ctx context.Context, filter database.ReportFilter, limit int) ([]database.CustomerRow, error)
+}
+
+// Reports serves the analytics reports from the report views and keeps them
+// fresh.
+type Reports struct {
+	db ReportStore
+}
+
+func NewReports(db ReportStore) *Reports {
+	return &Reports{db: db}
+}
+
+// Run refreshes the report views right away and then every interval until
+// ctx is done. With several instances only one of them refreshes at a time.
+func (s *Reports) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Refresh(ctx); err != nil && !errors.Is(err, database.ErrRefreshRunning) && ctx.Err() == nil {
+			log.Printf("Failed to refresh reports: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh recomputes the report views and returns the new refresh time.
+func (s *Reports) Refresh(ctx context.Context) (time.Time, error) {
+	start := time.Now()
+	if err := s.db.RefreshReports(ctx); err != nil {
+		return time.Time{}, err
+	}
+	log.Printf("Reports refreshed in %s", time.Since(start))
+	return s.db.ReportsRefreshedAt(ctx)
+}
+
+func (s *Reports) RefreshedAt(ctx context.Context) (time.Time, error) {
+	return s.db.ReportsRefreshedAt(ctx)
+}
+
+func (s *Reports) Revenue(ctx context.Context, filter database.ReportFilter, byDay, byProvider bool) ([]database.RevenueRow, error) {
+	return s.db.Revenue(ctx, filter, byDay, byProvider)
+}
+
+func (s *Reports) TopBrands(ctx context.Context, filter database.ReportFilter, limit int) ([]database.SalesRow, error) {
+	return s.db.TopBrands(ctx, filter, limit)
+}
+
+func (s *Reports) TopProducts(ctx context.Context, filter database.ReportFilter, limit int) ([]database.SalesRow, error) {
+	return s.db.TopProducts(ctx, filter, limit)
+}
+
+func (s *Reports) DeliveryCosts(ctx context.Context, filter database.ReportFilter) ([]database.DeliveryRow, error) {
+	return s.db.DeliveryCosts(ctx, filter)
+}
+
+func (s *Reports) TopCustomers(ctx context.Context, filter database.ReportFilter, limit int) ([]database.CustomerRow, error) {
+	return s.db.TopCustomers(ctx, filter, limit)
+}